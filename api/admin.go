@@ -0,0 +1,125 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// adminStats is the response of the admin stats endpoint.
+type adminStats struct {
+	Rows      int64             `json:"rows"`
+	RowsExact bool              `json:"rows_exact"`
+	Table     db.TableSizeInfo  `json:"table"`
+	Meta      map[string]string `json:"meta"`
+	Pool      db.PoolStats      `json:"pool"`
+}
+
+// adminKeyWrapper only allows requests with the ADMIN_API_KEY in the
+// Authorization header (as in `Authorization: Bearer <key>`).
+func (app *api) adminKeyWrapper(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if app.adminKey == "" || subtle.ConstantTimeCompare([]byte(k), []byte(app.adminKey)) != 1 {
+			messageResponse(w, http.StatusUnauthorized, "Chave de acesso administrativa inválida.")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (app *api) adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	var s adminStats
+	var err error
+	s.RowsExact = r.URL.Query().Get("exact") == "true"
+	if s.RowsExact {
+		s.Rows, err = app.db.RowCountExact(r.Context())
+	} else {
+		s.Rows, err = app.db.RowCountApproximate(r.Context())
+	}
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro contando as linhas da tabela.")
+		return
+	}
+	s.Table, err = app.db.TableSize(r.Context())
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro buscando o tamanho da tabela.")
+		return
+	}
+	s.Meta, err = app.db.MetaAll(r.Context())
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro buscando os metadados.")
+		return
+	}
+	s.Pool = app.db.PoolStats()
+	b, err := json.Marshal(s)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro serializando as estatísticas.")
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func (app *api) adminCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	b, err := json.Marshal(app.db.CacheStats())
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro serializando as estatísticas do cache.")
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func (app *api) adminImportReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	rep, err := app.db.GetImportReport(r.Context())
+	if err != nil {
+		messageResponse(w, http.StatusNotFound, "Relatório de importação não encontrado.")
+		return
+	}
+	b, err := json.Marshal(rep)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro serializando o relatório de importação.")
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func (app *api) adminStatusDistributionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	d, err := app.db.StatusDistribution(r.Context())
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro contando as empresas por situação cadastral.")
+		return
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro serializando a contagem por situação cadastral.")
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
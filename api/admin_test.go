@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminStatsHandler(t *testing.T) {
+	cases := []struct {
+		method  string
+		path    string
+		key     string
+		status  int
+		content string
+	}{
+		{
+			http.MethodGet,
+			"/admin/stats",
+			"Bearer 42",
+			http.StatusOK,
+			`{"rows":40,"rows_exact":false,"table":{"table_bytes":40,"index_bytes":2,"total_bytes":42},"meta":{"updated-at":"42"},"pool":{"total_conns":1,"acquired_conns":0,"idle_conns":0,"max_conns":4}}`,
+		},
+		{
+			http.MethodGet,
+			"/admin/stats?exact=true",
+			"Bearer 42",
+			http.StatusOK,
+			`{"rows":42,"rows_exact":true,"table":{"table_bytes":40,"index_bytes":2,"total_bytes":42},"meta":{"updated-at":"42"},"pool":{"total_conns":1,"acquired_conns":0,"idle_conns":0,"max_conns":4}}`,
+		},
+		{
+			http.MethodGet,
+			"/admin/stats",
+			"Bearer forty-two",
+			http.StatusUnauthorized,
+			`{"message":"Chave de acesso administrativa inválida."}`,
+		},
+		{
+			http.MethodGet,
+			"/admin/stats",
+			"",
+			http.StatusUnauthorized,
+			`{"message":"Chave de acesso administrativa inválida."}`,
+		},
+		{
+			http.MethodPost,
+			"/admin/stats",
+			"Bearer 42",
+			http.StatusMethodNotAllowed,
+			`{"message":"Essa URL aceita apenas o método GET."}`,
+		},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		if c.key != "" {
+			req.Header.Set("Authorization", c.key)
+		}
+		app := api{db: &mockDatabase{}, adminKey: "42"}
+		resp := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.adminKeyWrapper(app.adminStatsHandler))
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != c.status {
+			t.Errorf("Expected %s %s with %q to return %v, but got %v", c.method, c.path, c.key, c.status, resp.Code)
+		}
+		if strings.TrimSpace(resp.Body.String()) != c.content {
+			t.Errorf("\nExpected HTTP contents to be %s, got %s", c.content, resp.Body.String())
+		}
+	}
+}
+
+func TestAdminCacheHandler(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/admin/cache", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	req.Header.Set("Authorization", "Bearer 42")
+	app := api{db: &mockDatabase{}, adminKey: "42"}
+	resp := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.adminKeyWrapper(app.adminCacheHandler))
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected GET /admin/cache to return %v, but got %v", http.StatusOK, resp.Code)
+	}
+	expected := `{"hits":4,"misses":2,"evictions":0,"current_size":2}`
+	if strings.TrimSpace(resp.Body.String()) != expected {
+		t.Errorf("\nExpected HTTP contents to be %s, got %s", expected, resp.Body.String())
+	}
+}
+
+func TestAdminImportReportHandler(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/admin/import-report", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	req.Header.Set("Authorization", "Bearer 42")
+	app := api{db: &mockDatabase{}, adminKey: "42"}
+	resp := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.adminKeyWrapper(app.adminImportReportHandler))
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected GET /admin/import-report to return %v, but got %v", http.StatusOK, resp.Code)
+	}
+	expected := `{"step":"companies","rows_succeeded":40,"rows_failed":2,"errors":[{"base_cnpj":"19131243","message":"forty-two"}]}`
+	if strings.TrimSpace(resp.Body.String()) != expected {
+		t.Errorf("\nExpected HTTP contents to be %s, got %s", expected, resp.Body.String())
+	}
+}
+
+func TestAdminStatusDistributionHandler(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/admin/status-distribution", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	req.Header.Set("Authorization", "Bearer 42")
+	app := api{db: &mockDatabase{}, adminKey: "42"}
+	resp := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.adminKeyWrapper(app.adminStatusDistributionHandler))
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected GET /admin/status-distribution to return %v, but got %v", http.StatusOK, resp.Code)
+	}
+	expected := `{"2":40,"8":2}`
+	if strings.TrimSpace(resp.Body.String()) != expected {
+		t.Errorf("\nExpected HTTP contents to be %s, got %s", expected, resp.Body.String())
+	}
+}
@@ -4,16 +4,22 @@
 package api
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/cnpj"
+	"github.com/cuducos/minha-receita/db"
+	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
 const cacheMaxAge = time.Hour * 24
@@ -21,8 +27,28 @@ const cacheMaxAge = time.Hour * 24
 var cacheControl = fmt.Sprintf("max-age=%d", int(cacheMaxAge.Seconds()))
 
 type database interface {
-	GetCompany(string) (string, error)
+	GetCompany(context.Context, string) (string, error)
+	GetCompanyRaw(context.Context, string) ([]byte, error)
+	GetCompanyExcludeFields(context.Context, string, []string) (string, error)
 	MetaRead(string) (string, error)
+	GetImportSource(context.Context) (db.ImportSource, error)
+	TableSize(context.Context) (db.TableSizeInfo, error)
+	MetaAll(context.Context) (map[string]string, error)
+	PoolStats() db.PoolStats
+	RowCountApproximate(context.Context) (int64, error)
+	RowCountExact(context.Context) (int64, error)
+	TestConnection(context.Context) error
+	CacheStats() db.CacheStatistics
+	GetCompanyHistory(context.Context, string) ([]db.VersionedCompany, error)
+	GetImportReport(context.Context) (db.ImportReport, error)
+	Listen(context.Context, string, func(string)) error
+	CountByField(context.Context, string, int) ([]db.FieldCount, error)
+	StatusDistribution(context.Context) (map[string]int64, error)
+	GetCompaniesByBasePaged(context.Context, string, int, int64) ([]string, int64, error)
+	MetaSave(string, string) error
+	UpdateCompaniesFromReader(context.Context, io.Reader) (int64, error)
+	AcquireImportLock(context.Context) (*db.ImportLock, error)
+	SetImportStatus(string) error
 }
 
 // errorMessage is a helper to serialize an error message to JSON.
@@ -48,8 +74,17 @@ func messageResponse(w http.ResponseWriter, s int, m string) {
 }
 
 type api struct {
-	db   database
-	host string
+	db         database
+	host       string
+	adminKey   string
+	maxDataAge time.Duration
+	updates    *updatesHub
+	imports    *importJobs
+	source     *importSourceCache
+	static     http.Handler // web frontend served at / (optional)
+
+	// companies older than this are stale, see `companyAgeHeaders`
+	maxCompanyAge time.Duration
 }
 
 func (app *api) companyHandler(w http.ResponseWriter, r *http.Request) {
@@ -72,51 +107,378 @@ func (app *api) companyHandler(w http.ResponseWriter, r *http.Request) {
 	v := r.URL.Path
 
 	if v == "/" {
+		if app.static != nil {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Content-Security-Policy", staticContentSecurityPolicy)
+			app.static.ServeHTTP(w, r)
+			return
+		}
 		http.Redirect(w, r, "https://docs.minhareceita.org", http.StatusFound)
 		return
 	}
-	if !cnpj.IsValid(v) {
-		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", cnpj.Mask(v[1:])))
+	asCSV := r.URL.Query().Get("format") == "csv"
+	if strings.HasSuffix(v, ".csv") {
+		v, asCSV = strings.TrimSuffix(v, ".csv"), true
+	}
+	n, err := cnpj.ParseCNPJ(v[1:])
+	if err != nil {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v[1:]))
+		return
+	}
+	f, err := cnpj.FormatCNPJ(n)
+	if err != nil {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v[1:]))
 		return
 	}
 
-	s, err := app.db.GetCompany(cnpj.Unmask(v))
+	var b []byte
+	ctx, c := db.WithCacheResult(r.Context())
+	if e := r.URL.Query().Get("exclude"); e != "" {
+		var s string
+		s, err = app.db.GetCompanyExcludeFields(ctx, n, strings.Split(e, ","))
+		b = []byte(s)
+	} else {
+		b, err = app.db.GetCompanyRaw(ctx, n)
+	}
+	if s := c.String(); s != "" {
+		w.Header().Set("X-Cache", s)
+	}
+	if errors.Is(err, db.ErrUnknownField) {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Campos %s inválidos.", r.URL.Query().Get("exclude")))
+		return
+	}
+	if errors.Is(err, db.ErrDatabaseBusy) {
+		messageResponse(w, http.StatusServiceUnavailable, "Banco de dados sobrecarregado, tente novamente em instantes.")
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		messageResponse(w, http.StatusGatewayTimeout, fmt.Sprintf("Tempo esgotado buscando o CNPJ %s, tente novamente em instantes.", f))
+		return
+	}
+	if errors.Is(err, db.ErrMalformedData) {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Dados do CNPJ %s corrompidos.", f))
+		return
+	}
+	asOf := app.dataAgeHeaders(w, r)
 	if err != nil {
-		messageResponse(w, http.StatusNotFound, fmt.Sprintf("CNPJ %s não encontrado.", cnpj.Mask(v)))
+		messageResponse(w, http.StatusNotFound, fmt.Sprintf("CNPJ %s não encontrado.", f))
+		return
+	}
+	if !app.companyAgeHeaders(w, r, b, asOf, f) {
+		return
+	}
+	if notModified(w, r, b, asOf) {
+		return
+	}
+
+	if asCSV {
+		c, err := JSONToCSV(b)
+		if err != nil {
+			messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro convertendo o CNPJ %s para CSV.", f))
+			return
+		}
+		w.Header().Set("Content-type", csvContentType)
+		w.Header().Set("Content-Disposition", csvContentDisposition)
+		w.WriteHeader(http.StatusOK)
+		w.Write(c)
 		return
 	}
 
 	//check if the url contains url param "fields"
 	command := r.URL.Query().Get("fields") // "" = returns all data.
+	w.Header().Set("Vary", "Accept")
+	if command == "" && wantsXML(r.Header.Get("Accept")) {
+		x, err := JSONToXML(b)
+		if err != nil {
+			messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro convertendo o CNPJ %s para XML.", f))
+			return
+		}
+		w.Header().Set("Content-type", "application/xml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(x)
+		return
+	}
 	if command == "" {
 		w.Header().Set("Content-type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		io.WriteString(w, s)
+		w.Write(b)
 		return
 	}
 
 	//create a map to store the json
-	var data map[string]interface{}
-	json.Unmarshal([]byte(s), &data)
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(b, &data); err != nil {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro lendo os dados do CNPJ %s.", f))
+		return
+	}
 
 	//split the command to get the fields
 	fields := strings.Split(command, ",")
 
-	//iterate over fields
+	//iterate over fields, keeping only the requested ones
+	selected := make(map[string]json.RawMessage, len(fields))
 	for _, field := range fields {
-		//if the data exists, add it to the data map
+		//if the data exists, add it to the selected data
 		if val, ok := data[field]; ok {
-			data[field] = val
+			selected[field] = val
 		} else {
 			//if the data does not exist, return an error
-			messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Dados %s do CNPJ %s não encontrados.", field, cnpj.Mask(v)))
+			messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Dados %s do CNPJ %s não encontrados.", field, f))
+			return
+		}
+	}
+	s, err := json.Marshal(selected)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro serializando os dados do CNPJ %s.", f))
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s)
+}
+
+// cnpjHandler serves /cnpj/<cnpj>, where the CNPJ might be formatted. As the
+// slash of a formatted CNPJ splits the path (e.g. /cnpj/12.345.678/0001-90),
+// the base and the branch segments are joined back before the lookup.
+func (app *api) cnpjHandler(w http.ResponseWriter, r *http.Request) {
+	v := strings.Trim(strings.TrimPrefix(r.URL.Path, "/cnpj"), "/")
+	if v == "batch.csv" {
+		app.batchCSVHandler(w, r)
+		return
+	}
+	if h := strings.TrimSuffix(v, "/history"); h != v {
+		app.historyHandler(w, r, h)
+		return
+	}
+	if u := strings.TrimSuffix(v, "/updates"); u != v {
+		app.updatesHandler(w, r, u)
+		return
+	}
+	if b := strings.TrimSuffix(v, "/estabelecimentos"); b != v {
+		app.venuesHandler(w, r, b)
+		return
+	}
+	if strings.Count(v, "/") > 1 {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v))
+		return
+	}
+	c := r.Clone(r.Context())
+	c.URL.Path = "/" + v
+	app.companyHandler(w, c)
+}
+
+const (
+	// maximum number of CNPJs in /cnpj/batch.csv
+	maxCSVBatchSize = 100
+
+	csvContentType        = "text/csv; charset=utf-8"
+	csvContentDisposition = `attachment; filename="cnpj.csv"`
+)
+
+// batchCSVHandler serves /cnpj/batch.csv?cnpjs=<cnpj>,<cnpj>,…, streaming a
+// CSV with one row per company found. The header comes from the first company
+// found, since all companies have the same fields. CNPJs not found are
+// skipped.
+func (app *api) batchCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	q := r.URL.Query().Get("cnpjs")
+	if q == "" {
+		messageResponse(w, http.StatusBadRequest, "Informe os CNPJs separados por vírgula no parâmetro cnpjs.")
+		return
+	}
+	vs := strings.Split(q, ",")
+	if len(vs) > maxCSVBatchSize {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Limite de %d CNPJs por consulta excedido.", maxCSVBatchSize))
+		return
+	}
+	ns := make([]string, len(vs))
+	for i, v := range vs {
+		n, err := cnpj.ParseCNPJ(strings.TrimSpace(v))
+		if err != nil {
+			messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v))
 			return
 		}
+		ns[i] = n
 	}
+	var out *csv.Writer
+	var keys []string
+	for _, n := range ns {
+		b, err := app.db.GetCompanyRaw(r.Context(), n)
+		if errors.Is(err, db.ErrDatabaseBusy) && out == nil {
+			messageResponse(w, http.StatusServiceUnavailable, "Banco de dados sobrecarregado, tente novamente em instantes.")
+			return
+		}
+		if err != nil {
+			continue
+		}
+		ks, vals, err := csvFields(b)
+		if err != nil {
+			continue
+		}
+		if out == nil {
+			app.dataAgeHeaders(w, r)
+			w.Header().Set("Content-type", csvContentType)
+			w.Header().Set("Content-Disposition", csvContentDisposition)
+			w.WriteHeader(http.StatusOK)
+			out = csv.NewWriter(w)
+			keys = ks
+			out.Write(keys)
+		}
+		row := make([]string, len(keys))
+		for i, k := range keys {
+			row[i] = vals[k]
+		}
+		out.Write(row)
+	}
+	if out == nil {
+		messageResponse(w, http.StatusNotFound, "Nenhum CNPJ encontrado.")
+		return
+	}
+	out.Flush()
+}
 
+// companySnapshot is a version of a company in the history endpoint.
+type companySnapshot struct {
+	ImportedAt time.Time       `json:"imported_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+func (app *api) historyHandler(w http.ResponseWriter, r *http.Request, v string) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	n, err := cnpj.ParseCNPJ(v)
+	if err != nil {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v))
+		return
+	}
+	f, err := cnpj.FormatCNPJ(n)
+	if err != nil {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v))
+		return
+	}
+	h, err := app.db.GetCompanyHistory(r.Context(), n)
+	if err != nil || len(h) == 0 {
+		messageResponse(w, http.StatusNotFound, fmt.Sprintf("Histórico do CNPJ %s não encontrado.", f))
+		return
+	}
+	s := make([]companySnapshot, len(h))
+	for i, c := range h {
+		s[i] = companySnapshot{c.ImportedAt, json.RawMessage(c.JSON)}
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro serializando o histórico do CNPJ %s.", f))
+		return
+	}
+	w.Header().Set("Cache-Control", cacheControl)
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, fmt.Sprintf("%v", data))
+	w.Write(b)
+}
+
+const (
+	// default and maximum number of venues per page in /cnpj/<base>/estabelecimentos
+	defaultVenuesPageSize = 100
+	maxVenuesPageSize     = 1000
+)
+
+// venuesHandler serves /cnpj/<base>/estabelecimentos, a page of the venues of
+// a company given its base CNPJ (or any of its CNPJs). The X-Next-Cursor
+// header has the value of the cursor parameter for the next page, or 0 if
+// this is the last one.
+func (app *api) venuesHandler(w http.ResponseWriter, r *http.Request, v string) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	b := strings.NewReplacer(".", "", "/", "", "-", "").Replace(v)
+	if len(b) != 8 {
+		var err error
+		b, err = cnpj.BaseCNPJ(v)
+		if err != nil {
+			messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v))
+			return
+		}
+	}
+	n := defaultVenuesPageSize
+	if q := r.URL.Query().Get("limit"); q != "" {
+		var err error
+		n, err = strconv.Atoi(q)
+		if err != nil || n < 1 || n > maxVenuesPageSize {
+			messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Limite %s inválido, use um número entre 1 e %d.", q, maxVenuesPageSize))
+			return
+		}
+	}
+	var c int64
+	if q := r.URL.Query().Get("cursor"); q != "" {
+		var err error
+		c, err = strconv.ParseInt(q, 10, 64)
+		if err != nil {
+			messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Cursor %s inválido.", q))
+			return
+		}
+	}
+	cs, next, err := app.db.GetCompaniesByBasePaged(r.Context(), b, n, c)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Cursor %d inválido para o CNPJ base %s.", c, b))
+		return
+	}
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro buscando os estabelecimentos do CNPJ base %s.", b))
+		return
+	}
+	if c == 0 && len(cs) == 0 {
+		messageResponse(w, http.StatusNotFound, fmt.Sprintf("Estabelecimentos do CNPJ base %s não encontrados.", b))
+		return
+	}
+	js := make([]json.RawMessage, len(cs))
+	for i, j := range cs {
+		js[i] = json.RawMessage(j)
+	}
+	resp, err := json.Marshal(js)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro serializando os estabelecimentos do CNPJ base %s.", b))
+		return
+	}
+	w.Header().Set("X-Next-Cursor", strconv.FormatInt(next, 10))
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (app *api) nfeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	k := strings.TrimPrefix(r.URL.Path, "/nfe/")
+	n, err := cnpj.ParseNFeAccessKey(k)
+	if err != nil {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Chave de acesso %s inválida.", k))
+		return
+	}
+	f, err := cnpj.FormatCNPJ(n)
+	if err != nil {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Chave de acesso %s inválida.", k))
+		return
+	}
+	s, err := app.db.GetCompany(r.Context(), n)
+	if err != nil {
+		messageResponse(w, http.StatusNotFound, fmt.Sprintf("CNPJ %s não encontrado.", f))
+		return
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	app.dataAgeHeaders(w, r)
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, s)
 }
 
 func (app *api) updatedHandler(w http.ResponseWriter, r *http.Request) {
@@ -142,7 +504,70 @@ func (app *api) healthHandler(w http.ResponseWriter, r *http.Request) {
 		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
 		return
 	}
+	if err := app.db.TestConnection(r.Context()); err != nil {
+		if errors.Is(err, db.ErrTableMissing) {
+			messageResponse(w, http.StatusServiceUnavailable, "Tabelas do banco de dados ainda não foram criadas.")
+			return
+		}
+		messageResponse(w, http.StatusServiceUnavailable, "Banco de dados indisponível.")
+		return
+	}
+	src, err := app.db.GetImportSource(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	b, err := json.Marshal(struct {
+		Source db.ImportSource `json:"source"`
+	}{src})
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+const (
+	// default and maximum number of values in the analytics endpoint
+	defaultAnalyticsLimit = 10
+	maxAnalyticsLimit     = 100
+)
+
+func (app *api) analyticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	f := strings.TrimPrefix(r.URL.Path, "/analytics/")
+	n := defaultAnalyticsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAnalyticsLimit {
+			messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Limite %s inválido, use um número entre 1 e %d.", v, maxAnalyticsLimit))
+			return
+		}
+	}
+	c, err := app.db.CountByField(r.Context(), f, n)
+	if errors.Is(err, db.ErrUnknownField) {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Campo %s inválido, use um dos campos: %s.", f, strings.Join(db.AnalyticsFields, ", ")))
+		return
+	}
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro contando empresas por %s.", f))
+		return
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, fmt.Sprintf("Erro contando empresas por %s.", f))
+		return
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	w.Write(b)
 }
 
 func (app *api) allowedHostWrapper(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
@@ -160,23 +585,108 @@ func (app *api) allowedHostWrapper(h func(http.ResponseWriter, *http.Request)) f
 	return w
 }
 
-// Serve spins up the HTTP server.
-func Serve(db database, p, n string) {
-	if !strings.HasPrefix(p, ":") {
-		p = ":" + p
-	}
-	nr := newRelicApp(n)
-	app := api{db: db, host: os.Getenv("ALLOWED_HOST")}
+// router creates the handler with all the routes of the API. The New Relic
+// application is optional.
+func (app *api) router(nr *newrelic.Application) http.Handler {
+	m := http.NewServeMux()
 	for _, r := range []struct {
 		path    string
 		handler func(http.ResponseWriter, *http.Request)
 	}{
 		{"/", app.companyHandler},
+		{"/cnpj/", app.cnpjHandler},
+		{"/nfe/", app.nfeHandler},
 		{"/updated", app.updatedHandler},
 		{"/healthz", app.healthHandler},
+		{"/analytics/", app.analyticsHandler},
 	} {
-		http.HandleFunc(newRelicHandle(nr, r.path, app.allowedHostWrapper(r.handler)))
+		m.HandleFunc(newRelicHandle(nr, r.path, app.allowedHostWrapper(r.handler)))
+	}
+	if app.adminKey != "" {
+		m.HandleFunc(newRelicHandle(nr, "/admin/stats", app.allowedHostWrapper(app.adminKeyWrapper(app.adminStatsHandler))))
+		m.HandleFunc(newRelicHandle(nr, "/admin/cache", app.allowedHostWrapper(app.adminKeyWrapper(app.adminCacheHandler))))
+		m.HandleFunc(newRelicHandle(nr, "/admin/import-report", app.allowedHostWrapper(app.adminKeyWrapper(app.adminImportReportHandler))))
+		m.HandleFunc(newRelicHandle(nr, "/admin/status-distribution", app.allowedHostWrapper(app.adminKeyWrapper(app.adminStatusDistributionHandler))))
+		imports := ContentTypeMiddleware("application/json")(http.HandlerFunc(app.adminImportHandler)).ServeHTTP
+		m.HandleFunc(newRelicHandle(nr, "/admin/import", app.allowedHostWrapper(app.adminKeyWrapper(imports))))
+		m.HandleFunc(newRelicHandle(nr, "/admin/import/", app.allowedHostWrapper(app.adminKeyWrapper(imports))))
+	}
+	return SecureHeadersMiddleware()(MaxBodySizeMiddleware(DefaultMaxBodySize)(NormalizePathMiddleware()(m)))
+}
+
+// NewRouter creates the handler with all the routes of the API, without the
+// settings from environment variables used by `Serve` (host validation, admin
+// endpoints, etc.), which is useful for tests.
+func NewRouter(db database) http.Handler {
+	app := api{db: db, updates: newUpdatesHub(), imports: newImportJobs(), source: &importSourceCache{}}
+	return app.router(nil)
+}
+
+// how long the HTTP server waits for open requests when shutting down
+const shutdownTimeout = 10 * time.Second
+
+// Serve spins up the HTTP server, until the context is cancelled (e.g. on
+// SIGTERM), when it stops accepting new requests and waits for the open ones.
+// The web frontend (see `StaticHandler`) is optional: if static is nil, /
+// redirects to the documentation.
+func Serve(ctx context.Context, db database, p, n string, static http.Handler) {
+	if !strings.HasPrefix(p, ":") {
+		p = ":" + p
+	}
+	nr := newRelicApp(n)
+	app := api{db: db, host: os.Getenv("ALLOWED_HOST"), adminKey: os.Getenv("ADMIN_API_KEY"), updates: newUpdatesHub(), imports: newImportJobs(), source: &importSourceCache{}, static: static}
+	if v := os.Getenv("MAX_DATA_AGE_DAYS"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(fmt.Errorf("could not parse MAX_DATA_AGE_DAYS %s: %w", v, err))
+		}
+		app.maxDataAge = time.Duration(d) * 24 * time.Hour
+	}
+	if v := os.Getenv("COMPANY_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(fmt.Errorf("could not parse COMPANY_MAX_AGE %s: %w", v, err))
+		}
+		app.maxCompanyAge = d
+	}
+	app.checkDataAge(ctx)
+	h := app.router(nr)
+	allow, deny, trusted := os.Getenv("ALLOWED_IPS"), os.Getenv("DENIED_IPS"), os.Getenv("TRUSTED_PROXIES")
+	if allow != "" || deny != "" {
+		t, err := ParseCIDRList(trusted)
+		if err != nil {
+			log.Fatal(fmt.Errorf("could not parse TRUSTED_PROXIES: %w", err))
+		}
+		a, err := ParseCIDRList(allow)
+		if err != nil {
+			log.Fatal(fmt.Errorf("could not parse ALLOWED_IPS: %w", err))
+		}
+		d, err := ParseCIDRList(deny)
+		if err != nil {
+			log.Fatal(fmt.Errorf("could not parse DENIED_IPS: %w", err))
+		}
+		h = IPFilterMiddleware(a, d, t)(h)
+	}
+	cfg, err := ServerConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 	log.Output(1, fmt.Sprintf("Serving at http://0.0.0.0%s", p))
-	log.Fatal(http.ListenAndServe(p, nil))
+	srv := newServer(p, withDefaultMiddlewares(h), cfg)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		log.Output(1, "Shutting down the HTTP server…")
+		c, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(c); err != nil {
+			log.Output(1, fmt.Sprintf("Warning: could not shut down the HTTP server gracefully: %s", err))
+			srv.Close()
+		}
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-done
 }
@@ -1,23 +1,35 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
 )
 
 type mockDatabase struct{}
 
-func (mockDatabase) GetCompany(n string) (string, error) {
+func (mockDatabase) GetCompany(_ context.Context, n string) (string, error) {
 	n = cnpj.Unmask(n)
-	if n != "19131243000197" {
+	switch n {
+	case "19131243000197":
+		break
+	case "11222333000181":
+		return "", fmt.Errorf("error looking for cnpj %s: %w", n, context.DeadlineExceeded)
+	case "11444777000161":
+		return "", fmt.Errorf("%w for cnpj %s: {", db.ErrMalformedData, n)
+	default:
 		return "", errors.New("Company not found")
 	}
 
@@ -28,8 +40,130 @@ func (mockDatabase) GetCompany(n string) (string, error) {
 	return string(b), nil
 }
 
+func (m mockDatabase) GetCompanyRaw(ctx context.Context, n string) ([]byte, error) {
+	s, err := m.GetCompany(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+func (m mockDatabase) GetCompanyExcludeFields(ctx context.Context, n string, fs []string) (string, error) {
+	s, err := m.GetCompany(ctx, n)
+	if err != nil {
+		return "", err
+	}
+	var c map[string]any
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		return "", err
+	}
+	for _, f := range fs {
+		if _, ok := c[f]; !ok {
+			return "", db.ErrUnknownField
+		}
+		delete(c, f)
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
 func (mockDatabase) MetaRead(k string) (string, error) { return "42", nil }
 
+func (mockDatabase) MetaSave(_, _ string) error { return nil }
+
+func (mockDatabase) AcquireImportLock(_ context.Context) (*db.ImportLock, error) {
+	return &db.ImportLock{}, nil
+}
+
+func (mockDatabase) SetImportStatus(_ string) error { return nil }
+
+func (mockDatabase) UpdateCompaniesFromReader(_ context.Context, r io.Reader) (int64, error) {
+	return db.ValidateUpdates(r)
+}
+
+func (mockDatabase) GetImportSource(_ context.Context) (db.ImportSource, error) {
+	return db.ImportSource{
+		Date:     time.Date(2022, 10, 16, 0, 0, 0, 0, time.UTC),
+		URL:      "https://dados.gov.br/",
+		Checksum: "42",
+	}, nil
+}
+
+func (mockDatabase) TableSize(_ context.Context) (db.TableSizeInfo, error) {
+	return db.TableSizeInfo{TableBytes: 40, IndexBytes: 2, TotalBytes: 42}, nil
+}
+
+func (mockDatabase) MetaAll(_ context.Context) (map[string]string, error) {
+	return map[string]string{"updated-at": "42"}, nil
+}
+
+func (mockDatabase) PoolStats() db.PoolStats { return db.PoolStats{TotalConns: 1, MaxConns: 4} }
+
+func (mockDatabase) RowCountApproximate(_ context.Context) (int64, error) { return 40, nil }
+
+func (mockDatabase) RowCountExact(_ context.Context) (int64, error) { return 42, nil }
+
+func (mockDatabase) TestConnection(_ context.Context) error { return nil }
+
+func (mockDatabase) GetCompanyHistory(_ context.Context, n string) ([]db.VersionedCompany, error) {
+	if n != "19131243000197" {
+		return nil, nil
+	}
+	return []db.VersionedCompany{
+		{ImportedAt: time.Date(2022, 10, 16, 0, 0, 0, 0, time.UTC), JSON: `{"answer":42}`},
+	}, nil
+}
+
+func (mockDatabase) GetImportReport(_ context.Context) (db.ImportReport, error) {
+	return db.ImportReport{
+		Step:          "companies",
+		RowsSucceeded: 40,
+		RowsFailed:    2,
+		Errors:        []db.RowError{{BaseCNPJ: "19131243", Message: "forty-two"}},
+	}, nil
+}
+
+func (mockDatabase) Listen(_ context.Context, _ string, _ func(string)) error { return nil }
+
+func (mockDatabase) StatusDistribution(_ context.Context) (map[string]int64, error) {
+	return map[string]int64{"2": 40, "8": 2}, nil
+}
+
+func (m mockDatabase) GetCompaniesByBasePaged(ctx context.Context, b string, n int, c int64) ([]string, int64, error) {
+	if b != "19131243" {
+		return nil, 0, nil
+	}
+	switch c {
+	case 0:
+		s, err := m.GetCompany(ctx, "19131243000197")
+		if err != nil {
+			return nil, 0, err
+		}
+		if n == 1 {
+			return []string{s}, 19131243000197, nil
+		}
+		return []string{s}, 0, nil
+	case 19131243000197:
+		return []string{}, 0, nil
+	}
+	return nil, 0, db.ErrInvalidCursor
+}
+
+func (mockDatabase) CountByField(_ context.Context, f string, n int) ([]db.FieldCount, error) {
+	if f != "uf" {
+		return nil, fmt.Errorf("%w: %s", db.ErrUnknownField, f)
+	}
+	r := []db.FieldCount{{Value: "SP", Count: 42}, {Value: "RJ", Count: 21}, {Value: "DF", Count: 7}}
+	if n < len(r) {
+		r = r[:n]
+	}
+	return r, nil
+}
+
+func (mockDatabase) CacheStats() db.CacheStatistics {
+	return db.CacheStatistics{Hits: 4, Misses: 2, CurrentSize: 2}
+}
+
 func TestCompanyHandler(t *testing.T) {
 	f, err := filepath.Abs(filepath.Join("..", "testdata", "response.json"))
 	if err != nil {
@@ -95,6 +229,18 @@ func TestCompanyHandler(t *testing.T) {
 			http.StatusNotFound,
 			`{"message":"CNPJ 00.000.000/0001-91 não encontrado."}`,
 		},
+		{
+			http.MethodGet,
+			"/11222333000181",
+			http.StatusGatewayTimeout,
+			`{"message":"Tempo esgotado buscando o CNPJ 11.222.333/0001-81, tente novamente em instantes."}`,
+		},
+		{
+			http.MethodGet,
+			"/11444777000161",
+			http.StatusInternalServerError,
+			`{"message":"Dados do CNPJ 11.444.777/0001-61 corrompidos."}`,
+		},
 		{
 			http.MethodGet,
 			"/19.131.243/0001-97",
@@ -112,6 +258,12 @@ func TestCompanyHandler(t *testing.T) {
 			http.MethodGet,
 			"/19.131.243/0001-97?fields=uf,cep",
 			http.StatusOK,
+			`{"cep":"","uf":""}`,
+		},
+		{
+			http.MethodGet,
+			"/19131243000197?fields=data_inicio_atividade,descricao_porte",
+			http.StatusOK,
 			`{"data_inicio_atividade":"2013-10-03","descricao_porte":"Não informado"}`,
 		},
 		{
@@ -119,7 +271,7 @@ func TestCompanyHandler(t *testing.T) {
 			"/19131243000197?fields=xolofompila",
 			http.StatusBadRequest,
 			`{"message":"Dados xolofompila do CNPJ 19.131.243/0001-97 não encontrados."}`,
-		}
+		},
 	}
 
 	for _, c := range cases {
@@ -148,10 +300,199 @@ func TestCompanyHandler(t *testing.T) {
 					t.Errorf("\nExpected content-type to be application/json, but got %s", c)
 				}
 			}
+			if c.status == http.StatusOK && c.content != "" {
+				if h := resp.Header().Get("X-Data-As-Of"); h != "2022-10-16" {
+					t.Errorf("\nExpected X-Data-As-Of to be 2022-10-16, but got %s", h)
+				}
+			}
 		})
 	}
 }
 
+func TestCompanyHandlerExclude(t *testing.T) {
+	for _, c := range []struct {
+		path    string
+		status  int
+		missing []string
+	}{
+		{"/19131243000197?exclude=qsa", http.StatusOK, []string{`"qsa"`}},
+		{"/19131243000197?exclude=qsa,capital_social", http.StatusOK, []string{`"qsa"`, `"capital_social"`}},
+		{"/19131243000197?exclude=xolofompila", http.StatusBadRequest, nil},
+	} {
+		req, err := http.NewRequest(http.MethodGet, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("Expected GET %s to return %v, but got %v", c.path, c.status, resp.Code)
+		}
+		if c.status == http.StatusOK && !strings.Contains(resp.Body.String(), `"razao_social"`) {
+			t.Errorf("Expected GET %s to return the company, got %s", c.path, resp.Body.String())
+		}
+		for _, m := range c.missing {
+			if strings.Contains(resp.Body.String(), m) {
+				t.Errorf("Expected GET %s not to include %s, got %s", c.path, m, resp.Body.String())
+			}
+		}
+	}
+}
+
+func TestCNPJHandler(t *testing.T) {
+	for _, c := range []struct {
+		path   string
+		status int
+	}{
+		{"/cnpj/19131243000197", http.StatusOK},
+		{"/cnpj/19.131.243/0001-97", http.StatusOK},
+		{"/cnpj/19.131.243/0001-97/", http.StatusOK},
+		{"/cnpj/19131243/000197", http.StatusOK},
+		{"/cnpj/19.131.243/0001/97", http.StatusBadRequest},
+		{"/cnpj/foobar", http.StatusBadRequest},
+		{"/cnpj/00.000.000/0001-91", http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(http.MethodGet, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.cnpjHandler).ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("Expected GET %s to return %v, but got %v", c.path, c.status, resp.Code)
+		}
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		content string
+	}{
+		{http.MethodGet, "/cnpj/19.131.243/0001-97/history", http.StatusOK, `[{"imported_at":"2022-10-16T00:00:00Z","data":{"answer":42}}]`},
+		{http.MethodGet, "/cnpj/33683111000280/history", http.StatusNotFound, `{"message":"Histórico do CNPJ 33.683.111/0002-80 não encontrado."}`},
+		{http.MethodGet, "/cnpj/foobar/history", http.StatusBadRequest, `{"message":"CNPJ foobar inválido."}`},
+		{http.MethodPost, "/cnpj/19131243000197/history", http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.cnpjHandler).ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("Expected %s %s to return %v, but got %v", c.method, c.path, c.status, resp.Code)
+		}
+		if strings.TrimSpace(resp.Body.String()) != c.content {
+			t.Errorf("\nExpected HTTP contents to be %s, got %s", c.content, resp.Body.String())
+		}
+	}
+}
+
+func TestVenuesHandler(t *testing.T) {
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		next    string
+		content string
+	}{
+		{http.MethodGet, "/cnpj/19131243/estabelecimentos", http.StatusOK, "0", ""},
+		{http.MethodGet, "/cnpj/19.131.243/0001-97/estabelecimentos?limit=1", http.StatusOK, "19131243000197", ""},
+		{http.MethodGet, "/cnpj/19131243/estabelecimentos?cursor=19131243000197", http.StatusOK, "0", "[]"},
+		{http.MethodGet, "/cnpj/19131243/estabelecimentos?cursor=42", http.StatusBadRequest, "", `{"message":"Cursor 42 inválido para o CNPJ base 19131243."}`},
+		{http.MethodGet, "/cnpj/19131243/estabelecimentos?cursor=foo", http.StatusBadRequest, "", `{"message":"Cursor foo inválido."}`},
+		{http.MethodGet, "/cnpj/19131243/estabelecimentos?limit=1001", http.StatusBadRequest, "", `{"message":"Limite 1001 inválido, use um número entre 1 e 1000."}`},
+		{http.MethodGet, "/cnpj/33683111/estabelecimentos", http.StatusNotFound, "", `{"message":"Estabelecimentos do CNPJ base 33683111 não encontrados."}`},
+		{http.MethodGet, "/cnpj/foobar/estabelecimentos", http.StatusBadRequest, "", `{"message":"CNPJ foobar inválido."}`},
+		{http.MethodPost, "/cnpj/19131243/estabelecimentos", http.StatusMethodNotAllowed, "", `{"message":"Essa URL aceita apenas o método GET."}`},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.cnpjHandler).ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("Expected %s %s to return %v, but got %v", c.method, c.path, c.status, resp.Code)
+		}
+		if h := resp.Header().Get("X-Next-Cursor"); h != c.next {
+			t.Errorf("Expected %s %s to have X-Next-Cursor %q, got %q", c.method, c.path, c.next, h)
+		}
+		if c.content == "" {
+			var cs []map[string]any
+			if err := json.Unmarshal(resp.Body.Bytes(), &cs); err != nil || len(cs) != 1 {
+				t.Errorf("Expected %s %s to return a list with one company, got %s", c.method, c.path, resp.Body.String())
+			}
+			continue
+		}
+		if strings.TrimSpace(resp.Body.String()) != c.content {
+			t.Errorf("\nExpected HTTP contents to be %s, got %s", c.content, resp.Body.String())
+		}
+	}
+}
+
+func TestAnalyticsHandler(t *testing.T) {
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		content string
+	}{
+		{http.MethodGet, "/analytics/uf", http.StatusOK, `[{"value":"SP","count":42},{"value":"RJ","count":21},{"value":"DF","count":7}]`},
+		{http.MethodGet, "/analytics/uf?limit=1", http.StatusOK, `[{"value":"SP","count":42}]`},
+		{http.MethodGet, "/analytics/uf?limit=0", http.StatusBadRequest, `{"message":"Limite 0 inválido, use um número entre 1 e 100."}`},
+		{http.MethodGet, "/analytics/uf?limit=foo", http.StatusBadRequest, `{"message":"Limite foo inválido, use um número entre 1 e 100."}`},
+		{http.MethodGet, "/analytics/email", http.StatusBadRequest, `{"message":"Campo email inválido, use um dos campos: uf, codigo_municipio, cnae_fiscal, codigo_natureza_juridica, situacao_cadastral, codigo_porte."}`},
+		{http.MethodPost, "/analytics/uf", http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.analyticsHandler).ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("Expected %s %s to return %v, but got %v", c.method, c.path, c.status, resp.Code)
+		}
+		if strings.TrimSpace(resp.Body.String()) != c.content {
+			t.Errorf("\nExpected HTTP contents to be %s, got %s", c.content, resp.Body.String())
+		}
+	}
+}
+
+func TestNFeHandler(t *testing.T) {
+	for _, c := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/nfe/35230119131243000197550010000000011123456782", http.StatusOK},
+		{http.MethodGet, "/nfe/35230119131243000197550010000000011123456781", http.StatusBadRequest},
+		{http.MethodGet, "/nfe/35230100000000000191550010000000011123456786", http.StatusNotFound},
+		{http.MethodPost, "/nfe/35230119131243000197550010000000011123456782", http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.nfeHandler)
+		handler.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("Expected %s %s to return %v, but got %v", c.method, c.path, c.status, resp.Code)
+		}
+	}
+}
+
 func TestHealthHandler(t *testing.T) {
 	cases := []struct {
 		method  string
@@ -161,7 +502,7 @@ func TestHealthHandler(t *testing.T) {
 		{
 			http.MethodGet,
 			http.StatusOK,
-			"",
+			`{"source":{"date":"2022-10-16T00:00:00Z","url":"https://dados.gov.br/","checksum":"42"}}`,
 		},
 		{
 			http.MethodPost,
@@ -194,6 +535,39 @@ func TestHealthHandler(t *testing.T) {
 	}
 }
 
+type unreadyDatabase struct {
+	mockDatabase
+	err error
+}
+
+func (db unreadyDatabase) TestConnection(_ context.Context) error {
+	return db.err
+}
+
+func TestHealthHandlerNotReady(t *testing.T) {
+	for _, c := range []struct {
+		db      unreadyDatabase
+		content string
+	}{
+		{unreadyDatabase{err: fmt.Errorf("%w: connection refused", db.ErrDatabaseUnavailable)}, `{"message":"Banco de dados indisponível."}`},
+		{unreadyDatabase{err: fmt.Errorf("%w: public.cnpj", db.ErrTableMissing)}, `{"message":"Tabelas do banco de dados ainda não foram criadas."}`},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: c.db}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.healthHandler).ServeHTTP(resp, req)
+		if resp.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected GET /healthz to return %v, but got %v", http.StatusServiceUnavailable, resp.Code)
+		}
+		if strings.TrimSpace(resp.Body.String()) != c.content {
+			t.Errorf("\nExpected HTTP contents to be %s, got %s", c.content, resp.Body.String())
+		}
+	}
+}
+
 func TestUpdatedHandler(t *testing.T) {
 	app := api{db: &mockDatabase{}}
 	for _, c := range []struct {
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// DefaultMaxDataAge is how old the imported data can be before responses
+// include a `Warning` header.
+const DefaultMaxDataAge = 7 * 24 * time.Hour
+
+// how long the import source is cached before being read again from the
+// database, so imports from the command line show up without a restart
+const importSourceTTL = time.Minute
+
+// importSourceCache keeps the import source used in the headers of every
+// lookup (see `dataAgeHeaders`), so it is not read from the database on each
+// request.
+type importSourceCache struct {
+	mutex     sync.Mutex
+	src       db.ImportSource
+	err       error
+	expiresAt time.Time
+}
+
+// get returns the cached import source, reading it from the database if it
+// expired. A nil cache always reads from the database.
+func (c *importSourceCache) get(ctx context.Context, d database) (db.ImportSource, error) {
+	if c == nil {
+		return d.GetImportSource(ctx)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Now().Before(c.expiresAt) {
+		return c.src, c.err
+	}
+	src, err := d.GetImportSource(ctx)
+	if ctx.Err() != nil { // do not cache errors of a cancelled request
+		return src, err
+	}
+	c.src, c.err, c.expiresAt = src, err, time.Now().Add(importSourceTTL)
+	return src, err
+}
+
+// reset expires the cached import source, e.g. after an import.
+func (c *importSourceCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.expiresAt = time.Time{}
+}
+
+// dataAgeDays is the number of full days since the release date of the
+// imported data.
+func dataAgeDays(src db.ImportSource, now time.Time) int {
+	return int(now.Sub(src.Date) / (24 * time.Hour))
+}
+
+func (app *api) maxDataAgeOrDefault() time.Duration {
+	if app.maxDataAge <= 0 {
+		return DefaultMaxDataAge
+	}
+	return app.maxDataAge
+}
+
+// dataAgeHeaders sets the date and the age of the imported data in the
+// response headers, and adds a `Warning` header if the data is older than the
+// maximum data age. It returns the date of the imported data (zero if it is
+// not known).
+func (app *api) dataAgeHeaders(w http.ResponseWriter, r *http.Request) time.Time {
+	src, err := app.source.get(r.Context(), app.db)
+	if err != nil {
+		return time.Time{}
+	}
+	d := dataAgeDays(src, time.Now())
+	w.Header().Set("X-Data-As-Of", src.Date.Format("2006-01-02"))
+	w.Header().Set("X-Data-Age-Days", strconv.Itoa(d))
+	if time.Since(src.Date) > app.maxDataAgeOrDefault() {
+		w.Header().Set("Warning", fmt.Sprintf(`199 minha-receita "Data is %d days old"`, d))
+	}
+	return src.Date
+}
+
+// acceptsStale checks whether the Cache-Control header of a request accepts a
+// response stale for the given time, with the max-stale directive (without a
+// value, any stale response is accepted).
+func acceptsStale(cacheControl string, staleFor time.Duration) bool {
+	for _, d := range strings.Split(cacheControl, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(d), "=")
+		if !strings.EqualFold(k, "max-stale") {
+			continue
+		}
+		if !ok {
+			return true
+		}
+		s, err := strconv.Atoi(strings.Trim(v, `"`))
+		return err == nil && staleFor <= time.Duration(s)*time.Second
+	}
+	return false
+}
+
+// companyModifiedAt is when the company data was last updated:
+// `_meta.updated_at` in the JSON, or asOf, the date of the imported data.
+func companyModifiedAt(j []byte, asOf time.Time) time.Time {
+	if t, ok := db.CompanyUpdatedAt(j); ok {
+		return t
+	}
+	return asOf
+}
+
+// companyAgeHeaders sets the Age header with the seconds since the company
+// data was updated (see `companyModifiedAt`). Data older than the maximum company age is stale and only
+// served to clients accepting it with Cache-Control: max-stale, otherwise it
+// responds with 503 and returns false. It does nothing if the maximum company
+// age is not set.
+func (app *api) companyAgeHeaders(w http.ResponseWriter, r *http.Request, j []byte, asOf time.Time, cnpj string) bool {
+	if app.maxCompanyAge <= 0 {
+		return true
+	}
+	t := companyModifiedAt(j, asOf)
+	if t.IsZero() {
+		return true
+	}
+	age := max(time.Since(t), 0)
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	if age <= app.maxCompanyAge {
+		return true
+	}
+	if acceptsStale(r.Header.Get("Cache-Control"), age-app.maxCompanyAge) {
+		w.Header().Add("Warning", `110 minha-receita "Response is Stale"`)
+		return true
+	}
+	messageResponse(w, http.StatusServiceUnavailable, fmt.Sprintf("Dados do CNPJ %s desatualizados, use o cabeçalho Cache-Control: max-stale para aceitá-los.", cnpj))
+	return false
+}
+
+// notModified sets the Last-Modified header with the date the company data
+// was updated (see `companyModifiedAt`) and, if the request has an
+// If-Modified-Since header not older than that, responds with 304 and returns
+// true.
+func notModified(w http.ResponseWriter, r *http.Request, j []byte, asOf time.Time) bool {
+	t := companyModifiedAt(j, asOf)
+	if t.IsZero() {
+		return false
+	}
+	t = t.UTC().Truncate(time.Second) // HTTP dates have no sub-second precision
+	w.Header().Set("Last-Modified", t.Format(http.TimeFormat))
+	v := r.Header.Get("If-Modified-Since")
+	if v == "" {
+		return false
+	}
+	since, err := http.ParseTime(v)
+	if err != nil || t.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkDataAge logs a warning if the imported data is older than the maximum
+// data age.
+func (app *api) checkDataAge(ctx context.Context) {
+	src, err := app.db.GetImportSource(ctx)
+	if err != nil {
+		return
+	}
+	if time.Since(src.Date) > app.maxDataAgeOrDefault() {
+		log.Output(1, fmt.Sprintf("Warning: data imported from %s is %d days old", src.Date.Format("2006-01-02"), dataAgeDays(src, time.Now())))
+	}
+}
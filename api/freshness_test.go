@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestDataAgeDays(t *testing.T) {
+	src := db.ImportSource{Date: time.Date(2022, 10, 16, 0, 0, 0, 0, time.UTC)}
+	now := time.Date(2022, 10, 23, 12, 0, 0, 0, time.UTC)
+	if got := dataAgeDays(src, now); got != 7 {
+		t.Errorf("expected data to be 7 days old, got %d", got)
+	}
+}
+
+func TestDataAgeHeaders(t *testing.T) {
+	days := dataAgeDays(db.ImportSource{Date: time.Date(2022, 10, 16, 0, 0, 0, 0, time.UTC)}, time.Now())
+	for _, c := range []struct {
+		maxDataAge time.Duration
+		warning    bool
+	}{
+		{0, true},
+		{time.Duration(days+1) * 24 * time.Hour, false},
+	} {
+		app := api{db: &mockDatabase{}, maxDataAge: c.maxDataAge}
+		req := httptest.NewRequest(http.MethodGet, "/19131243000197", nil)
+		resp := httptest.NewRecorder()
+		app.dataAgeHeaders(resp, req)
+		if h := resp.Header().Get("X-Data-As-Of"); h != "2022-10-16" {
+			t.Errorf("expected X-Data-As-Of to be 2022-10-16, got %s", h)
+		}
+		if h := resp.Header().Get("X-Data-Age-Days"); h != strconv.Itoa(days) {
+			t.Errorf("expected X-Data-Age-Days to be %d, got %s", days, h)
+		}
+		h := resp.Header().Get("Warning")
+		if c.warning && !strings.HasPrefix(h, `199 minha-receita "Data is `) {
+			t.Errorf("expected a Warning header with max data age %s, got %q", c.maxDataAge, h)
+		}
+		if !c.warning && h != "" {
+			t.Errorf("expected no Warning header with max data age %s, got %q", c.maxDataAge, h)
+		}
+	}
+}
+
+// countingDatabase counts how many times the import source is read.
+type countingDatabase struct {
+	mockDatabase
+	calls int
+}
+
+func (d *countingDatabase) GetImportSource(ctx context.Context) (db.ImportSource, error) {
+	d.calls++
+	return d.mockDatabase.GetImportSource(ctx)
+}
+
+func TestImportSourceCache(t *testing.T) {
+	d := &countingDatabase{}
+	var c importSourceCache
+	for i := 0; i < 3; i++ {
+		src, err := c.get(context.Background(), d)
+		if err != nil {
+			t.Errorf("expected no error getting the import source, got %s", err)
+		}
+		if src.Date.Format("2006-01-02") != "2022-10-16" {
+			t.Errorf("expected import source from 2022-10-16, got %s", src.Date)
+		}
+	}
+	if d.calls != 1 {
+		t.Errorf("expected the import source to be read once, got %d", d.calls)
+	}
+	c.reset()
+	if _, err := c.get(context.Background(), d); err != nil {
+		t.Errorf("expected no error getting the import source, got %s", err)
+	}
+	if d.calls != 2 {
+		t.Errorf("expected the import source to be read again after a reset, got %d reads", d.calls)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.reset()
+	c.get(ctx, d)
+	c.get(context.Background(), d)
+	if d.calls != 4 {
+		t.Errorf("expected the import source of a cancelled request not to be cached, got %d reads", d.calls)
+	}
+}
+
+func TestAcceptsStale(t *testing.T) {
+	for _, c := range []struct {
+		cacheControl string
+		staleFor     time.Duration
+		expected     bool
+	}{
+		{"", time.Second, false},
+		{"no-cache", time.Second, false},
+		{"max-stale", 42 * time.Hour, true},
+		{"max-stale=60", time.Minute, true},
+		{"no-cache, max-stale=60", time.Minute + time.Second, false},
+		{`Max-Stale="3600"`, time.Minute, true},
+		{"max-stale=forty-two", time.Second, false},
+	} {
+		if got := acceptsStale(c.cacheControl, c.staleFor); got != c.expected {
+			t.Errorf("expected acceptsStale(%q, %s) to be %t, got %t", c.cacheControl, c.staleFor, c.expected, got)
+		}
+	}
+}
+
+func TestCompanyAgeHeaders(t *testing.T) {
+	for _, c := range []struct {
+		desc          string
+		maxCompanyAge time.Duration
+		cacheControl  string
+		status        int
+		age           bool
+	}{
+		{"disabled", 0, "", http.StatusOK, false},
+		{"fresh", 100 * 365 * 24 * time.Hour, "", http.StatusOK, true},
+		{"stale", time.Hour, "", http.StatusServiceUnavailable, true},
+		{"stale accepted", time.Hour, "max-stale", http.StatusOK, true},
+		{"stale for too long", time.Hour, "max-stale=60", http.StatusServiceUnavailable, true},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			app := api{db: &mockDatabase{}, maxCompanyAge: c.maxCompanyAge}
+			req := httptest.NewRequest(http.MethodGet, "/19131243000197", nil)
+			if c.cacheControl != "" {
+				req.Header.Set("Cache-Control", c.cacheControl)
+			}
+			resp := httptest.NewRecorder()
+			http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("expected status %d, got %d", c.status, resp.Code)
+			}
+			h := resp.Header().Get("Age")
+			if c.age {
+				if a, err := strconv.Atoi(h); err != nil || a < int(time.Since(time.Date(2022, 10, 16, 0, 0, 0, 0, time.UTC)).Seconds())-60 {
+					t.Errorf("expected Age to be the seconds since the import, got %q", h)
+				}
+			} else if h != "" {
+				t.Errorf("expected no Age header, got %s", h)
+			}
+			if c.cacheControl == "max-stale" && !strings.Contains(strings.Join(resp.Header().Values("Warning"), ","), "Response is Stale") {
+				t.Errorf("expected a stale Warning header, got %v", resp.Header().Values("Warning"))
+			}
+		})
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	for _, c := range []struct {
+		ifModifiedSince string
+		status          int
+	}{
+		{"", http.StatusOK},
+		{"Sun, 16 Oct 2022 00:00:00 GMT", http.StatusNotModified},
+		{"Mon, 17 Oct 2022 12:00:00 GMT", http.StatusNotModified},
+		{"Sat, 15 Oct 2022 23:59:59 GMT", http.StatusOK},
+		{"Sunday, 16-Oct-22 00:00:00 GMT", http.StatusNotModified},
+		{"yesterday", http.StatusOK},
+	} {
+		app := api{db: &mockDatabase{}}
+		req := httptest.NewRequest(http.MethodGet, "/19131243000197", nil)
+		if c.ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", c.ifModifiedSince)
+		}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected status %d for If-Modified-Since %q, got %d", c.status, c.ifModifiedSince, resp.Code)
+		}
+		if h := resp.Header().Get("Last-Modified"); h != "Sun, 16 Oct 2022 00:00:00 GMT" {
+			t.Errorf("expected Last-Modified to be the import date, got %q", h)
+		}
+		if c.status == http.StatusNotModified && resp.Body.Len() != 0 {
+			t.Errorf("expected no body for a 304 response, got %s", resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// prefix of the metadata keys with the status of import jobs (with the 8-char
+// job ID, these keys fit the 16-char limit of the metadata table)
+const importJobKeyPrefix = "import-"
+
+const (
+	importJobRunning   = "running"
+	importJobCompleted = "completed"
+	importJobFailed    = "failed"
+	importJobCancelled = "cancelled"
+)
+
+// how often the progress of a running import job is saved to the metadata
+const importJobProgressInterval = 5 * time.Second
+
+// running import jobs without progress saved for longer than this are
+// considered failed (e.g. the instance of the API running it was restarted)
+const importJobStaleAfter = 6 * importJobProgressInterval
+
+// importRequest is the body of POST /admin/import.
+type importRequest struct {
+	SourceURL string `json:"source_url"`
+	DryRun    bool   `json:"dry_run"`
+}
+
+// importJob is the status of an import job, saved as JSON in the metadata.
+type importJob struct {
+	ID         string     `json:"id"`
+	SourceURL  string     `json:"source_url"`
+	DryRun     bool       `json:"dry_run"`
+	Status     string     `json:"status"`
+	BytesRead  int64      `json:"bytes_read"`
+	BytesTotal int64      `json:"bytes_total,omitempty"`
+	Records    int64      `json:"records"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// stale checks if a job is running, but its progress was not saved for longer
+// than `importJobStaleAfter`.
+func (j *importJob) stale(now time.Time) bool {
+	return j.Status == importJobRunning && now.Sub(j.UpdatedAt) > importJobStaleAfter
+}
+
+// countingReader counts the bytes read, so the progress of an import job can
+// be read while the job runs.
+type countingReader struct {
+	io.Reader
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// importJobs keeps the cancel functions of the import jobs running in this
+// instance of the API.
+type importJobs struct {
+	mutex   sync.Mutex
+	cancels map[string]context.CancelFunc
+	client  *http.Client
+}
+
+func newImportJobs() *importJobs {
+	return &importJobs{cancels: make(map[string]context.CancelFunc), client: http.DefaultClient}
+}
+
+func (j *importJobs) add(id string, cancel context.CancelFunc) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.cancels[id] = cancel
+}
+
+// remove stops tracking a job, returning its cancel function so the caller
+// can release its context.
+func (j *importJobs) remove(id string) context.CancelFunc {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	c, ok := j.cancels[id]
+	if !ok {
+		return func() {}
+	}
+	delete(j.cancels, id)
+	return c
+}
+
+// running checks if a job is running in this instance of the API.
+func (j *importJobs) running(id string) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	_, ok := j.cancels[id]
+	return ok
+}
+
+// cancel cancels a running job, returning false if it is not running in this
+// instance of the API.
+func (j *importJobs) cancel(id string) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	c, ok := j.cancels[id]
+	if ok {
+		c()
+	}
+	return ok
+}
+
+func newImportJobID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error creating import job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// saveImportJob saves the status of an import job to the metadata, setting its
+// `UpdatedAt`, which works as a heartbeat of running jobs.
+func (app *api) saveImportJob(j *importJob) error {
+	j.UpdatedAt = time.Now()
+	b, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("error serializing import job %s: %w", j.ID, err)
+	}
+	return app.db.MetaSave(importJobKeyPrefix+j.ID, string(b))
+}
+
+// readImport downloads the source of an import job and sends it to the
+// database (or only validates it in dry runs), returning the number of
+// records.
+func (app *api) readImport(ctx context.Context, j *importJob, src *countingReader, total chan<- int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.SourceURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request to %s: %w", j.SourceURL, err)
+	}
+	resp, err := app.imports.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error downloading %s: %w", j.SourceURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error downloading %s: got status %s", j.SourceURL, resp.Status)
+	}
+	total <- resp.ContentLength
+	src.Reader = resp.Body
+	if j.DryRun {
+		return db.ValidateUpdates(src)
+	}
+	return app.db.UpdateCompaniesFromReader(ctx, src)
+}
+
+// readImportJob reads the status of an import job from the metadata. Running
+// jobs that are stale (see `importJob.stale`) and not running in this instance
+// of the API are saved and returned as failed.
+func (app *api) readImportJob(id string) (importJob, error) {
+	var j importJob
+	v, err := app.db.MetaRead(importJobKeyPrefix + id)
+	if err != nil {
+		return j, fmt.Errorf("error reading import job %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(v), &j); err != nil {
+		return j, fmt.Errorf("error decoding import job %s: %w", id, err)
+	}
+	now := time.Now()
+	if !j.stale(now) || app.imports.running(id) {
+		return j, nil
+	}
+	j.Status, j.FinishedAt = importJobFailed, &now
+	j.Error = fmt.Sprintf("no progress saved since %s, the api instance running the job was probably stopped", j.UpdatedAt.Format(time.RFC3339))
+	if err := app.saveImportJob(&j); err != nil {
+		log.Output(1, fmt.Sprintf("Warning: could not save the status of import job %s: %s", j.ID, err))
+	}
+	return j, nil
+}
+
+// runImport runs an import job, saving its progress to the metadata every
+// `importJobProgressInterval`, and its final status when it finishes, when it
+// also saves the import status and releases the import lock (nil in dry runs).
+func (app *api) runImport(ctx context.Context, j *importJob, l *db.ImportLock) {
+	type result struct {
+		n   int64
+		err error
+	}
+	done := make(chan result, 1)
+	total := make(chan int64, 1)
+	var src countingReader
+	go func() {
+		n, err := app.readImport(ctx, j, &src, total)
+		done <- result{n, err}
+	}()
+	t := time.NewTicker(importJobProgressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case n := <-total:
+			if n > 0 {
+				j.BytesTotal = n
+			}
+		case <-t.C:
+			j.BytesRead = src.n.Load()
+			if err := app.saveImportJob(j); err != nil {
+				log.Output(1, fmt.Sprintf("Warning: could not save the progress of import job %s: %s", j.ID, err))
+			}
+		case r := <-done:
+			// stop tracking the job before saving the final status, so it
+			// cannot be cancelled once it is finished
+			defer app.imports.remove(j.ID)()
+			now := time.Now()
+			j.BytesRead, j.Records, j.FinishedAt = src.n.Load(), r.n, &now
+			switch {
+			case errors.Is(ctx.Err(), context.Canceled):
+				j.Status = importJobCancelled
+			case r.err != nil:
+				j.Status, j.Error = importJobFailed, r.err.Error()
+			default:
+				j.Status = importJobCompleted
+			}
+			// release the import lock before saving the final status, so
+			// another import can start once this one is seen as finished
+			if l != nil {
+				app.finishImport(l, j.Status == importJobCompleted)
+			}
+			if err := app.saveImportJob(j); err != nil {
+				log.Output(1, fmt.Sprintf("Warning: could not save the status of import job %s: %s", j.ID, err))
+			}
+			return
+		}
+	}
+}
+
+// adminImportHandler serves POST /admin/import, which starts an import job,
+// and GET and DELETE /admin/import/<job id>, which read the status of a job
+// or cancel it.
+func (app *api) adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/import"), "/")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método POST.")
+			return
+		}
+		app.startImport(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		app.importStatus(w, id)
+	case http.MethodDelete:
+		app.cancelImport(w, id)
+	default:
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas os métodos GET e DELETE.")
+	}
+}
+
+// finishImport saves the import status (the same used by the transform
+// command), releases the import lock and expires the cached import source.
+func (app *api) finishImport(l *db.ImportLock, ok bool) {
+	s := "done"
+	if !ok {
+		s = "failed"
+	}
+	if err := app.db.SetImportStatus(s); err != nil {
+		log.Output(1, fmt.Sprintf("Warning: could not save the import status: %s", err))
+	}
+	if err := l.Release(context.Background()); err != nil {
+		log.Output(1, fmt.Sprintf("Warning: %s", err))
+	}
+	app.source.reset()
+}
+
+// startImport starts an import job. Unless it is a dry run, it takes the
+// import lock, so it does not run at the same time as other imports (from the
+// API or from the command line).
+func (app *api) startImport(w http.ResponseWriter, r *http.Request) {
+	var req importRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		messageResponse(w, http.StatusBadRequest, "Corpo da requisição inválido, envie um JSON com source_url e dry_run.")
+		return
+	}
+	u, err := url.Parse(req.SourceURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("URL de origem %s inválida.", req.SourceURL))
+		return
+	}
+	id, err := newImportJobID()
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro criando a importação.")
+		return
+	}
+	var l *db.ImportLock
+	if !req.DryRun {
+		l, err = app.db.AcquireImportLock(r.Context())
+		if errors.Is(err, db.ErrImportInProgress) {
+			messageResponse(w, http.StatusConflict, "Já existe uma importação em andamento.")
+			return
+		}
+		if err != nil {
+			messageResponse(w, http.StatusInternalServerError, "Erro criando a importação.")
+			return
+		}
+		if err := app.db.SetImportStatus("running"); err != nil {
+			app.finishImport(l, false)
+			messageResponse(w, http.StatusInternalServerError, "Erro criando a importação.")
+			return
+		}
+	}
+	j := importJob{ID: id, SourceURL: req.SourceURL, DryRun: req.DryRun, Status: importJobRunning, StartedAt: time.Now()}
+	if err := app.saveImportJob(&j); err != nil {
+		if l != nil {
+			app.finishImport(l, false)
+		}
+		messageResponse(w, http.StatusInternalServerError, "Erro criando a importação.")
+		return
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro serializando a importação.")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	app.imports.add(id, cancel)
+	go app.runImport(ctx, &j, l)
+	w.Header().Set("Location", "/admin/import/"+id)
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(b)
+}
+
+func (app *api) importStatus(w http.ResponseWriter, id string) {
+	j, err := app.readImportJob(id)
+	if err != nil {
+		messageResponse(w, http.StatusNotFound, fmt.Sprintf("Importação %s não encontrada.", id))
+		return
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		messageResponse(w, http.StatusInternalServerError, "Erro serializando a importação.")
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func (app *api) cancelImport(w http.ResponseWriter, id string) {
+	if app.imports.cancel(id) {
+		messageResponse(w, http.StatusAccepted, fmt.Sprintf("Cancelamento da importação %s solicitado.", id))
+		return
+	}
+	j, err := app.readImportJob(id)
+	if err != nil {
+		messageResponse(w, http.StatusNotFound, fmt.Sprintf("Importação %s não encontrada.", id))
+		return
+	}
+	if j.Status != importJobRunning {
+		messageResponse(w, http.StatusConflict, fmt.Sprintf("Importação %s não está em andamento (status %s).", id, j.Status))
+		return
+	}
+	messageResponse(w, http.StatusConflict, fmt.Sprintf("Importação %s não está em andamento nesta instância da API.", id))
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/db/mock"
+)
+
+func adminImportRequest(t *testing.T, h http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer 42")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+// waitForImport polls the status of an import job until it is not running.
+func waitForImport(t *testing.T, h http.HandlerFunc, id string) importJob {
+	var j importJob
+	for i := 0; i < 100; i++ {
+		resp := adminImportRequest(t, h, http.MethodGet, "/admin/import/"+id, "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status 200 reading import job %s, got %d", id, resp.Code)
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &j); err != nil {
+			t.Fatalf("expected an import job, got %s", resp.Body.String())
+		}
+		if j.Status != importJobRunning {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected import job %s to finish", id)
+	return j
+}
+
+func TestAdminImportHandler(t *testing.T) {
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/updates.jsonl":
+			w.Write([]byte(`{"cnpj_basico": "19131243", "data": {"answer": 42}}` + "\n"))
+		case "/slow.jsonl":
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer src.Close()
+	s := mock.NewInMemoryStore(map[string]string{"19131243000197": `{"cnpj":"19131243000197"}`})
+	app := api{db: s, adminKey: "42", imports: newImportJobs()}
+	h := http.HandlerFunc(app.adminKeyWrapper(app.adminImportHandler))
+
+	start := func(body string) importJob {
+		resp := adminImportRequest(t, h, http.MethodPost, "/admin/import", body)
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202 starting an import, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var j importJob
+		if err := json.Unmarshal(resp.Body.Bytes(), &j); err != nil {
+			t.Fatalf("expected an import job, got %s", resp.Body.String())
+		}
+		if l := resp.Header().Get("Location"); l != "/admin/import/"+j.ID {
+			t.Errorf("expected Location to be the job URL, got %s", l)
+		}
+		if j.Status != importJobRunning {
+			t.Errorf("expected a running job, got %s", j.Status)
+		}
+		return j
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		j := waitForImport(t, h, start(`{"source_url": "`+src.URL+`/updates.jsonl", "dry_run": true}`).ID)
+		if j.Status != importJobCompleted || j.Records != 1 || j.FinishedAt == nil {
+			t.Errorf("expected a completed job with 1 record, got %+v", j)
+		}
+		if got, _ := s.GetCompany(context.Background(), "19131243000197"); strings.Contains(got, "answer") {
+			t.Errorf("expected no changes in a dry run, got %s", got)
+		}
+	})
+	t.Run("import", func(t *testing.T) {
+		j := waitForImport(t, h, start(`{"source_url": "`+src.URL+`/updates.jsonl"}`).ID)
+		if j.Status != importJobCompleted || j.Records != 1 || j.BytesRead == 0 {
+			t.Errorf("expected a completed job with 1 record, got %+v", j)
+		}
+		if got, _ := s.GetCompany(context.Background(), "19131243000197"); !strings.Contains(got, `"answer":42`) {
+			t.Errorf("expected the imported data, got %s", got)
+		}
+		resp := adminImportRequest(t, h, http.MethodDelete, "/admin/import/"+j.ID, "")
+		if resp.Code != http.StatusConflict {
+			t.Errorf("expected status 409 cancelling a finished job, got %d", resp.Code)
+		}
+	})
+	t.Run("failed", func(t *testing.T) {
+		j := waitForImport(t, h, start(`{"source_url": "`+src.URL+`/missing.jsonl"}`).ID)
+		if j.Status != importJobFailed || !strings.Contains(j.Error, "404") {
+			t.Errorf("expected a failed job, got %+v", j)
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		j := start(`{"source_url": "` + src.URL + `/slow.jsonl"}`)
+		resp := adminImportRequest(t, h, http.MethodDelete, "/admin/import/"+j.ID, "")
+		if resp.Code != http.StatusAccepted {
+			t.Errorf("expected status 202 cancelling a job, got %d", resp.Code)
+		}
+		if j = waitForImport(t, h, j.ID); j.Status != importJobCancelled {
+			t.Errorf("expected a cancelled job, got %+v", j)
+		}
+	})
+	t.Run("one import at a time", func(t *testing.T) {
+		j := start(`{"source_url": "` + src.URL + `/slow.jsonl"}`)
+		resp := adminImportRequest(t, h, http.MethodPost, "/admin/import", `{"source_url": "`+src.URL+`/updates.jsonl"}`)
+		if resp.Code != http.StatusConflict {
+			t.Errorf("expected status 409 starting an import while another one runs, got %d", resp.Code)
+		}
+		waitForImport(t, h, start(`{"source_url": "`+src.URL+`/updates.jsonl", "dry_run": true}`).ID)
+		adminImportRequest(t, h, http.MethodDelete, "/admin/import/"+j.ID, "")
+		waitForImport(t, h, j.ID)
+		if v, _ := s.MetaRead("import_status"); v != "failed" {
+			t.Errorf("expected import status to be failed after cancelling the import, got %s", v)
+		}
+	})
+	t.Run("stale", func(t *testing.T) {
+		b, err := json.Marshal(importJob{ID: "deadbeef", Status: importJobRunning, UpdatedAt: time.Now().Add(-2 * importJobStaleAfter)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.MetaSave(importJobKeyPrefix+"deadbeef", string(b))
+		resp := adminImportRequest(t, h, http.MethodDelete, "/admin/import/deadbeef", "")
+		if resp.Code != http.StatusConflict {
+			t.Errorf("expected status 409 cancelling a stale job, got %d", resp.Code)
+		}
+		j := waitForImport(t, h, "deadbeef")
+		if j.Status != importJobFailed || j.FinishedAt == nil || !strings.Contains(j.Error, "no progress saved") {
+			t.Errorf("expected a stale job to be failed, got %+v", j)
+		}
+	})
+	for _, c := range []struct {
+		method  string
+		path    string
+		body    string
+		status  int
+		content string
+	}{
+		{http.MethodPost, "/admin/import", "forty-two", http.StatusBadRequest, `{"message":"Corpo da requisição inválido, envie um JSON com source_url e dry_run."}`},
+		{http.MethodPost, "/admin/import", `{"source_url": "file:///etc/passwd"}`, http.StatusBadRequest, `{"message":"URL de origem file:///etc/passwd inválida."}`},
+		{http.MethodGet, "/admin/import", "", http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método POST."}`},
+		{http.MethodGet, "/admin/import/42", "", http.StatusNotFound, `{"message":"Importação 42 não encontrada."}`},
+		{http.MethodDelete, "/admin/import/42", "", http.StatusNotFound, `{"message":"Importação 42 não encontrada."}`},
+		{http.MethodPut, "/admin/import/42", "", http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas os métodos GET e DELETE."}`},
+	} {
+		resp := adminImportRequest(t, h, c.method, c.path, c.body)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if strings.TrimSpace(resp.Body.String()) != c.content {
+			t.Errorf("expected %s, got %s", c.content, resp.Body.String())
+		}
+	}
+}
+
+func TestAdminImportContentType(t *testing.T) {
+	app := api{db: mock.NewInMemoryStore(nil), adminKey: "42", updates: newUpdatesHub(), imports: newImportJobs()}
+	h := app.router(nil)
+	for _, c := range []struct {
+		contentType string
+		status      int
+	}{
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"", http.StatusUnsupportedMediaType},
+		{"application/json", http.StatusBadRequest}, // passes the middleware, but the body is not valid
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader("source_url=https://example.com"))
+		req.Header.Set("Authorization", "Bearer 42")
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected POST /admin/import with content type %q to return %d, got %d", c.contentType, c.status, resp.Code)
+		}
+	}
+}
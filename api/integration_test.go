@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db/mock"
+)
+
+const integrationCompany = `{"cnpj":"19131243000197","razao_social":"OPEN KNOWLEDGE BRASIL","qsa":[]}`
+
+func TestIntegration(t *testing.T) {
+	s := mock.NewInMemoryStore(map[string]string{"19131243000197": integrationCompany})
+	srv := httptest.NewServer(NewRouter(s))
+	defer srv.Close()
+	for _, c := range []struct {
+		desc     string
+		method   string
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"valid cnpj", http.MethodGet, "/19131243000197", "", http.StatusOK, integrationCompany},
+		{"formatted cnpj", http.MethodGet, "/19.131.243/0001-97", "", http.StatusOK, integrationCompany},
+		{"cnpj prefix", http.MethodGet, "/cnpj/19131243000197", "", http.StatusOK, integrationCompany},
+		{"invalid cnpj", http.MethodGet, "/foobar", "", http.StatusBadRequest, `{"message":"CNPJ foobar inválido."}`},
+		{"unknown cnpj", http.MethodGet, "/00000000000191", "", http.StatusNotFound, `{"message":"CNPJ 00.000.000/0001-91 não encontrado."}`},
+		{"excluded field", http.MethodGet, "/19131243000197?exclude=qsa", "", http.StatusOK, `{"cnpj":"19131243000197","razao_social":"OPEN KNOWLEDGE BRASIL"}`},
+		{"body too large", http.MethodPost, "/", strings.Repeat("19131243000197,", DefaultMaxBodySize/14), http.StatusRequestEntityTooLarge, ""},
+		{"health check", http.MethodGet, "/healthz", "", http.StatusOK, ""},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			req, err := http.NewRequest(c.method, srv.URL+c.path, bytes.NewBufferString(c.body))
+			if err != nil {
+				t.Fatalf("Expected no error creating the request, got %s", err)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Expected no error in the request, got %s", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != c.status {
+				t.Errorf("Expected status %d, got %d", c.status, resp.StatusCode)
+			}
+			if c.expected == "" {
+				return
+			}
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Expected no error reading the response, got %s", err)
+			}
+			if string(b) != c.expected {
+				t.Errorf("Expected %s, got %s", c.expected, string(b))
+			}
+		})
+	}
+}
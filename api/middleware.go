@@ -0,0 +1,370 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/cnpj"
+)
+
+// DefaultMaxBodySize is the default limit for request bodies, enough for a
+// JSON with around 1,000 CNPJs.
+const DefaultMaxBodySize = 64 << 10
+
+// Logger is the interface used by the middlewares to write logs, it is
+// satisfied by the standard library's `*log.Logger`.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// statusRecorder wraps a `http.ResponseWriter` keeping the status code and the
+// number of bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(s int) {
+	r.status = s
+	r.ResponseWriter.WriteHeader(s)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush allows streaming responses (e.g. server-sent events) through the
+// middleware.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows `http.ResponseController` to reach the original writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// redactedPath replaces a CNPJ in the path by a placeholder and returns it
+// together with the base CNPJ (first 8 digits), so access logs do not include
+// full business identifiers.
+func redactedPath(p string) (string, string) {
+	n, err := cnpj.ParseCNPJ(strings.TrimPrefix(p, "/"))
+	if err != nil {
+		return p, ""
+	}
+	return "/{cnpj}", n[:8]
+}
+
+// LoggingMiddleware logs method, path, status code, bytes written, latency,
+// request ID (from the X-Request-ID header) and whether the response came from
+// the cache (from the X-Cache response header, empty if the handler does not
+// set it) of each request. CNPJs in the path are logged only as their base
+// (first 8 digits).
+func LoggingMiddleware(l Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := time.Now()
+			rec := statusRecorder{ResponseWriter: w}
+			h.ServeHTTP(&rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			p, c := redactedPath(r.URL.Path)
+			l.Printf(
+				"method=%s path=%s status=%d bytes=%d latency_ms=%.3f request_id=%q cnpj=%q cache=%q",
+				r.Method,
+				p,
+				rec.status,
+				rec.bytes,
+				float64(time.Since(t).Microseconds())/1000,
+				r.Header.Get("X-Request-ID"),
+				c,
+				rec.Header().Get("X-Cache"),
+			)
+		})
+	}
+}
+
+// clientIP returns the IP address of the client, without the port.
+func clientIP(r *http.Request) string {
+	h, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return h
+}
+
+// MaxBodySizeMiddleware responds with 413 Request Entity Too Large to requests
+// with a body larger than maxBytes. The body is read up to this limit, so the
+// Content-Length header (which might be wrong) is not trusted.
+func MaxBodySizeMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				h.ServeHTTP(w, r)
+				return
+			}
+			tooLarge := func() {
+				log.Output(1, fmt.Sprintf("Warning: request body larger than %d bytes from %s (Content-Length: %q)", maxBytes, clientIP(r), r.Header.Get("Content-Length")))
+				messageResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("O corpo da requisição deve ter no máximo %d bytes.", maxBytes))
+			}
+			if r.ContentLength > maxBytes {
+				tooLarge()
+				return
+			}
+			b, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+			r.Body.Close()
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				messageResponse(w, http.StatusRequestTimeout, "Tempo esgotado lendo o corpo da requisição.")
+				return
+			}
+			if err != nil {
+				messageResponse(w, http.StatusBadRequest, "Erro lendo o corpo da requisição.")
+				return
+			}
+			if int64(len(b)) > maxBytes {
+				tooLarge()
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(b))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ParseCIDRList parses a comma-separated list of networks in the CIDR notation
+// (e.g. 10.0.0.0/8,192.168.0.0/16), as used in environment variables. Single
+// IP addresses are accepted as networks with only this address.
+func ParseCIDRList(s string) ([]net.IPNet, error) {
+	var ns []net.IPNet
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address %s", v)
+			}
+			b := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				b = 8 * net.IPv4len
+			}
+			ns = append(ns, net.IPNet{IP: ip, Mask: net.CIDRMask(b, b)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %s: %w", v, err)
+		}
+		ns = append(ns, *n)
+	}
+	return ns, nil
+}
+
+func inNetworks(ip net.IP, ns []net.IPNet) bool {
+	for _, n := range ns {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClientIP returns the IP of the client, walking the X-Forwarded-For
+// header from right to left while the addresses are trusted proxies. It
+// returns nil if the IP cannot be parsed.
+func forwardedClientIP(r *http.Request, trusted []net.IPNet) net.IP {
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil || !inNetworks(ip, trusted) {
+		return ip
+	}
+	var hs []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hs = append(hs, strings.Split(h, ",")...)
+	}
+	for i := len(hs) - 1; i >= 0; i-- {
+		f := net.ParseIP(strings.TrimSpace(hs[i]))
+		if f == nil {
+			return ip
+		}
+		ip = f
+		if !inNetworks(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// IPFilterMiddleware responds with 403 Forbidden to clients in the deny list
+// or, if the allow list is not empty, to clients not in the allow list. The
+// deny list takes precedence. The client IP comes from the X-Forwarded-For
+// header only if the request comes from one of the trusted proxies (the
+// networks of the reverse proxies in front of the API).
+func IPFilterMiddleware(allowList, denyList, trustedProxies []net.IPNet) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedClientIP(r, trustedProxies)
+			if inNetworks(ip, denyList) || (len(allowList) > 0 && !inNetworks(ip, allowList)) {
+				messageResponse(w, http.StatusForbidden, "Acesso não permitido.")
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// problemDetail is an error response as described in the RFC 7807.
+type problemDetail struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// problemResponse writes an RFC 7807 problem detail (with the default type,
+// about:blank, so the title is the HTTP status text).
+func problemResponse(w http.ResponseWriter, s int, d string) {
+	b, err := json.Marshal(problemDetail{"about:blank", http.StatusText(s), s, d})
+	if err != nil {
+		w.WriteHeader(s)
+		return
+	}
+	w.Header().Set("Content-type", "application/problem+json")
+	w.WriteHeader(s)
+	w.Write(b)
+}
+
+// ContentTypeMiddleware responds with 415 Unsupported Media Type to POST, PUT
+// and PATCH requests with a Content-Type other than expected (parameters such
+// as the charset are ignored), or without a Content-Type. Other methods are
+// not checked, since they are not expected to have a body.
+func ContentTypeMiddleware(expected string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+				v := r.Header.Get("Content-Type")
+				t, _, err := mime.ParseMediaType(v)
+				if err != nil || !strings.EqualFold(t, expected) {
+					problemResponse(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Essa URL aceita apenas requisições com Content-Type %s, recebido %q.", expected, v))
+					return
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// normalizedPath collapses repeated slashes and removes the trailing slash of
+// a path. A single segment followed by a slash (e.g. /cnpj/) is kept, since
+// this is how `http.ServeMux` routes subtrees (and it redirects /cnpj to
+// /cnpj/).
+func normalizedPath(p string) string {
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	if p == "/" || !strings.HasSuffix(p, "/") || strings.Count(p, "/") == 2 {
+		return p
+	}
+	return strings.TrimRight(p, "/")
+}
+
+// NormalizePathMiddleware redirects (with 301 Moved Permanently, or 308
+// Permanent Redirect for methods other than GET and HEAD, so the method and
+// the body are kept) requests to paths with repeated slashes (e.g. //cnpj/…)
+// or with a trailing slash (e.g. /cnpj/19131243000197/) to the normalized
+// path, keeping the query string. The path in the Location header is
+// percent-encoded.
+func NormalizePathMiddleware() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := normalizedPath(r.URL.Path)
+			if p == r.URL.Path {
+				h.ServeHTTP(w, r)
+				return
+			}
+			u := url.URL{Path: p, RawQuery: r.URL.RawQuery}
+			s := http.StatusMovedPermanently
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				s = http.StatusPermanentRedirect // clients follow a 301 with a GET, dropping the body
+			}
+			http.Redirect(w, r, u.String(), s)
+		})
+	}
+}
+
+// RecoveryMiddleware recovers from panics in the handlers, logging them with
+// the stack trace at the ERROR level, together with the path and the request
+// ID (from the X-Request-ID header), and responds with 500 Internal Server
+// Error. The response is an RFC 7807 problem detail without the stack trace,
+// so internal details do not leak to clients. `http.ErrAbortHandler` is not
+// recovered, since it is used to abort a response on purpose.
+func RecoveryMiddleware(l Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				p, _ := redactedPath(r.URL.Path)
+				l.Printf(
+					"level=ERROR msg=%q method=%s path=%s request_id=%q panic=%q stack=%q",
+					"Recovered from panic",
+					r.Method,
+					p,
+					r.Header.Get("X-Request-ID"),
+					fmt.Sprint(err),
+					debug.Stack(),
+				)
+				problemResponse(w, http.StatusInternalServerError, "Erro interno do servidor.")
+			}()
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SecureHeadersMiddleware sets HTTP headers that protect browsers rendering
+// the responses: no MIME type sniffing, no framing, a strict referrer policy
+// and a content security policy blocking any resource (the web frontend
+// relaxes it, see `staticContentSecurityPolicy`). Strict-Transport-Security is
+// only set for requests using TLS, directly or through a proxy setting
+// X-Forwarded-Proto.
+func SecureHeadersMiddleware() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("X-Frame-Options", "DENY")
+			w.Header().Set("Referrer-Policy", "strict-origin")
+			w.Header().Set("Content-Security-Policy", "default-src 'none'")
+			if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+				w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
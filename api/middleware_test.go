@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		expected []string
+		missing  string
+	}{
+		{"/19131243000197", []string{"method=GET", "path=/{cnpj}", "status=200", "bytes=", "latency_ms=", `request_id="42"`, `cnpj="19131243"`}, "19131243000197"},
+		{"/19.131.243/0001-97", []string{"path=/{cnpj}", `cnpj="19131243"`}, "0001"},
+		{"/00000000000191", []string{"status=404", `cnpj="00000000"`}, "00000000000191"},
+		{"/healthz", []string{"path=/healthz", `cnpj=""`, `cache=""`}, ""},
+	} {
+		t.Run(c.path, func(t *testing.T) {
+			var b bytes.Buffer
+			app := api{db: &mockDatabase{}}
+			h := LoggingMiddleware(log.New(&b, "", 0))(http.HandlerFunc(app.companyHandler))
+			if c.path == "/healthz" {
+				h = LoggingMiddleware(log.New(&b, "", 0))(http.HandlerFunc(app.healthHandler))
+			}
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			req.Header.Set("X-Request-ID", "42")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			got := b.String()
+			for _, e := range c.expected {
+				if !strings.Contains(got, e) {
+					t.Errorf("Expected log to contain %s, got %s", e, got)
+				}
+			}
+			if c.missing != "" && strings.Contains(got, c.missing) {
+				t.Errorf("Expected log not to contain %s, got %s", c.missing, got)
+			}
+		})
+	}
+	t.Run("cache", func(t *testing.T) {
+		var b bytes.Buffer
+		h := LoggingMiddleware(log.New(&b, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Cache", "HIT")
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/19131243000197", nil))
+		if got := b.String(); !strings.Contains(got, `cache="HIT"`) {
+			t.Errorf("Expected log to contain the cache result, got %s", got)
+		}
+	})
+}
+
+func TestMaxBodySizeMiddleware(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Expected no error reading the body, got %s", err)
+		}
+		w.Write(b)
+	})
+	for _, c := range []struct {
+		desc          string
+		body          string
+		contentLength int64
+		status        int
+	}{
+		{"no body", "", 0, http.StatusOK},
+		{"small body", "42", 2, http.StatusOK},
+		{"body at the limit", "4242", 4, http.StatusOK},
+		{"large body", "424242", 6, http.StatusRequestEntityTooLarge},
+		{"large body with spoofed content-length", "424242", -1, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			req.ContentLength = c.contentLength
+			resp := httptest.NewRecorder()
+			MaxBodySizeMiddleware(4)(echo).ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("Expected status %d, got %d", c.status, resp.Code)
+			}
+			if c.status == http.StatusOK && resp.Body.String() != c.body {
+				t.Errorf("Expected body to be %q, got %q", c.body, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestParseCIDRList(t *testing.T) {
+	ns, err := ParseCIDRList("10.0.0.0/8, 192.168.0.1,,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("Expected no error parsing the list, got %s", err)
+	}
+	if len(ns) != 3 {
+		t.Fatalf("Expected 3 networks, got %d", len(ns))
+	}
+	if ns[1].String() != "192.168.0.1/32" {
+		t.Errorf("Expected a single IP to be a /32 network, got %s", ns[1].String())
+	}
+	if _, err := ParseCIDRList("10.0.0.0/42"); err == nil {
+		t.Error("Expected an error parsing an invalid network")
+	}
+	if _, err := ParseCIDRList("forty-two"); err == nil {
+		t.Error("Expected an error parsing an invalid ip")
+	}
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	allow, _ := ParseCIDRList("10.0.0.0/8")
+	deny, _ := ParseCIDRList("10.0.0.42")
+	trusted, _ := ParseCIDRList("172.16.0.0/12")
+	for _, c := range []struct {
+		desc      string
+		remote    string
+		forwarded string
+		allow     []net.IPNet
+		expected  int
+	}{
+		{"allowed", "10.0.0.1:4242", "", allow, http.StatusOK},
+		{"denied", "10.0.0.42:4242", "", allow, http.StatusForbidden},
+		{"not allowed", "8.8.8.8:4242", "", allow, http.StatusForbidden},
+		{"no allow list", "8.8.8.8:4242", "", nil, http.StatusOK},
+		{"trusted proxy", "172.16.0.1:4242", "10.0.0.1", allow, http.StatusOK},
+		{"trusted proxy with denied client", "172.16.0.1:4242", "10.0.0.1, 10.0.0.42", allow, http.StatusForbidden},
+		{"untrusted proxy", "8.8.8.8:4242", "10.0.0.1", allow, http.StatusForbidden},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = c.remote
+			if c.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", c.forwarded)
+			}
+			resp := httptest.NewRecorder()
+			IPFilterMiddleware(c.allow, deny, trusted)(ok).ServeHTTP(resp, req)
+			if resp.Code != c.expected {
+				t.Errorf("Expected %d, got %d", c.expected, resp.Code)
+			}
+		})
+	}
+}
+
+func TestContentTypeMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, c := range []struct {
+		desc        string
+		method      string
+		contentType string
+		status      int
+	}{
+		{"json", http.MethodPost, "application/json", http.StatusOK},
+		{"json with charset", http.MethodPost, "application/json; charset=utf-8", http.StatusOK},
+		{"json in upper case", http.MethodPut, "Application/JSON", http.StatusOK},
+		{"form", http.MethodPost, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"form with patch", http.MethodPatch, "multipart/form-data; boundary=42", http.StatusUnsupportedMediaType},
+		{"no content type", http.MethodPost, "", http.StatusUnsupportedMediaType},
+		{"malformed content type", http.MethodPost, "application/json;;", http.StatusUnsupportedMediaType},
+		{"get is not checked", http.MethodGet, "text/plain", http.StatusOK},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			req, err := http.NewRequest(c.method, "/", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			resp := httptest.NewRecorder()
+			ContentTypeMiddleware("application/json")(ok).ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("Expected status %d, got %d", c.status, resp.Code)
+			}
+			if c.status == http.StatusOK {
+				return
+			}
+			if ct := resp.Header().Get("Content-type"); ct != "application/problem+json" {
+				t.Errorf("Expected problem detail content type, got %s", ct)
+			}
+			var p problemDetail
+			if err := json.Unmarshal(resp.Body.Bytes(), &p); err != nil {
+				t.Errorf("Expected a problem detail, got %s", resp.Body.String())
+			}
+			if p.Status != c.status || p.Title != "Unsupported Media Type" {
+				t.Errorf("Expected problem detail with status 415, got %+v", p)
+			}
+		})
+	}
+}
+
+func TestNormalizePathMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, c := range []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{http.MethodGet, "/", http.StatusOK, ""},
+		{http.MethodGet, "/cnpj/19131243000197", http.StatusOK, ""},
+		{http.MethodGet, "/cnpj/", http.StatusOK, ""},
+		{http.MethodGet, "/19.131.243/0001-97", http.StatusOK, ""},
+		{http.MethodGet, "/cnpj/19131243000197/", http.StatusMovedPermanently, "/cnpj/19131243000197"},
+		{http.MethodGet, "/cnpj/19131243000197///", http.StatusMovedPermanently, "/cnpj/19131243000197"},
+		{http.MethodGet, "//cnpj/19131243000197", http.StatusMovedPermanently, "/cnpj/19131243000197"},
+		{http.MethodGet, "/cnpj//19131243000197?exclude=qsa", http.StatusMovedPermanently, "/cnpj/19131243000197?exclude=qsa"},
+		{http.MethodGet, "/updated/", http.StatusOK, ""},
+		{http.MethodGet, "//", http.StatusMovedPermanently, "/"},
+		{http.MethodGet, "/cnpj/19 131 243/", http.StatusMovedPermanently, "/cnpj/19%20131%20243"},
+		{http.MethodHead, "/cnpj/19131243000197/", http.StatusMovedPermanently, "/cnpj/19131243000197"},
+		{http.MethodPost, "/admin/import/", http.StatusPermanentRedirect, "/admin/import"},
+		{http.MethodDelete, "//admin/import/42", http.StatusPermanentRedirect, "/admin/import/42"},
+	} {
+		t.Run(c.method+" "+c.path, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, "/", nil)
+			req.URL.Path, req.URL.RawQuery, _ = strings.Cut(c.path, "?")
+			resp := httptest.NewRecorder()
+			NormalizePathMiddleware()(ok).ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("Expected status %d, got %d", c.status, resp.Code)
+			}
+			if got := resp.Header().Get("Location"); got != c.location {
+				t.Errorf("Expected location %q, got %q", c.location, got)
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var b bytes.Buffer
+	l := log.New(&b, "", 0)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		m["answer"] = "forty-two" // panics: assignment to entry in nil map
+	})
+	req := httptest.NewRequest(http.MethodGet, "/19131243000197", nil)
+	req.Header.Set("X-Request-ID", "42")
+	resp := httptest.NewRecorder()
+	RecoveryMiddleware(l)(h).ServeHTTP(resp, req)
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", resp.Code)
+	}
+	var p problemDetail
+	if err := json.Unmarshal(resp.Body.Bytes(), &p); err != nil {
+		t.Errorf("Expected a problem detail, got %s", resp.Body.String())
+	}
+	if p.Status != http.StatusInternalServerError || strings.Contains(resp.Body.String(), "goroutine") || strings.Contains(resp.Body.String(), "nil map") {
+		t.Errorf("Expected a problem detail without internal details, got %s", resp.Body.String())
+	}
+	for _, s := range []string{"level=ERROR", "path=/{cnpj}", `request_id="42"`, "nil map", "goroutine"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Expected %s in the log, got %s", s, b.String())
+		}
+	}
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("Expected ErrAbortHandler not to be recovered, got %v", err)
+		}
+	}()
+	abort := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+	RecoveryMiddleware(l)(abort).ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestSecureHeadersMiddleware(t *testing.T) {
+	h := SecureHeadersMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	expected := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "strict-origin",
+		"Content-Security-Policy": "default-src 'none'",
+	}
+	hsts := "max-age=31536000; includeSubDomains"
+	for _, c := range []struct {
+		desc  string
+		srv   *httptest.Server
+		proto string
+		hsts  bool
+	}{
+		{"http", httptest.NewServer(h), "", false},
+		{"https", httptest.NewTLSServer(h), "", true},
+		{"https proxy", httptest.NewServer(h), "https", true},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			defer c.srv.Close()
+			req, err := http.NewRequest(http.MethodGet, c.srv.URL, nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			if c.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", c.proto)
+			}
+			resp, err := c.srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Expected no error requesting the test server, got %s", err)
+			}
+			defer resp.Body.Close()
+			for k, v := range expected {
+				if got := resp.Header.Get(k); got != v {
+					t.Errorf("Expected %s to be %s, got %q", k, v, got)
+				}
+			}
+			got := resp.Header.Get("Strict-Transport-Security")
+			if c.hsts && got != hsts {
+				t.Errorf("Expected Strict-Transport-Security to be %s, got %q", hsts, got)
+			}
+			if !c.hsts && got != "" {
+				t.Errorf("Expected no Strict-Transport-Security without TLS, got %s", got)
+			}
+		})
+	}
+}
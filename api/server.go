@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Default timeouts of the HTTP server, see `ServerConfig`.
+const (
+	DefaultReadTimeout       = 5 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultReadHeaderTimeout = 2 * time.Second
+)
+
+// ServerConfig has the timeouts of the HTTP server. The zero values of
+// `http.Server` mean no timeouts at all, which makes the server vulnerable to
+// slow clients holding connections open (e.g. slowloris attacks).
+type ServerConfig struct {
+	ReadTimeout       time.Duration // reading the whole request, including the body
+	WriteTimeout      time.Duration // from the end of the request headers to the end of the response
+	IdleTimeout       time.Duration // waiting for the next request in a keep-alive connection
+	ReadHeaderTimeout time.Duration // reading the request headers
+}
+
+// DefaultServerConfig returns the default timeouts of the HTTP server.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadTimeout:       DefaultReadTimeout,
+		WriteTimeout:      DefaultWriteTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+	}
+}
+
+// ServerConfigFromEnv returns the default timeouts of the HTTP server
+// overridden by the environment variables HTTP_READ_TIMEOUT,
+// HTTP_WRITE_TIMEOUT, HTTP_IDLE_TIMEOUT and HTTP_READ_HEADER_TIMEOUT (e.g.
+// HTTP_READ_TIMEOUT=10s).
+func ServerConfigFromEnv() (ServerConfig, error) {
+	c := DefaultServerConfig()
+	for _, e := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", &c.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", &c.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", &c.IdleTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", &c.ReadHeaderTimeout},
+	} {
+		v := os.Getenv(e.name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid %s %q: expected a non-negative duration such as 5s", e.name, v)
+		}
+		*e.dst = d
+	}
+	return c, nil
+}
+
+// Server is the HTTP server of the API.
+type Server struct {
+	*http.Server
+}
+
+// New creates the HTTP server of the API with the timeouts from the config,
+// logging requests and recovering from panics. As in `NewRouter`, the settings
+// from environment variables used by `Serve` (host validation, admin
+// endpoints, etc.) are not used. Set its Addr (e.g. :8000) before calling
+// ListenAndServe.
+func New(cfg ServerConfig, db database) *Server {
+	return newServer("", withDefaultMiddlewares(NewRouter(db)), cfg)
+}
+
+// withDefaultMiddlewares wraps the handler with the middlewares used by every
+// HTTP server of the API.
+func withDefaultMiddlewares(h http.Handler) http.Handler {
+	return LoggingMiddleware(log.Default())(RecoveryMiddleware(log.Default())(h))
+}
+
+// newServer creates the HTTP server listening at addr with the timeouts from
+// the config.
+func newServer(addr string, h http.Handler, cfg ServerConfig) *Server {
+	return &Server{&http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+	}}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerConfigFromEnv(t *testing.T) {
+	t.Setenv("HTTP_READ_TIMEOUT", "10s")
+	t.Setenv("HTTP_IDLE_TIMEOUT", "1m")
+	c, err := ServerConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Expected no error reading the server config, got %s", err)
+	}
+	expected := ServerConfig{
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      DefaultWriteTimeout,
+		IdleTimeout:       time.Minute,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+	}
+	if c != expected {
+		t.Errorf("Expected %+v, got %+v", expected, c)
+	}
+	t.Setenv("HTTP_WRITE_TIMEOUT", "42")
+	if _, err := ServerConfigFromEnv(); err == nil {
+		t.Error("Expected an error with a timeout without unit, got nil")
+	}
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error listening, got %s", err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	cfg := DefaultServerConfig()
+	cfg.ReadTimeout = 100 * time.Millisecond
+	s := newServer(l.Addr().String(), MaxBodySizeMiddleware(DefaultMaxBodySize)(ok), cfg)
+	go s.Serve(l)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected no error connecting to the server, got %s", err)
+	}
+	defer conn.Close()
+	// sends the headers, but only part of the body
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 42\r\n\r\n{")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Expected a response, got %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestTimeout, resp.StatusCode)
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.WriteTimeout = 42 * time.Second
+	s := New(cfg, &mockDatabase{})
+	if s.WriteTimeout != cfg.WriteTimeout || s.ReadTimeout != cfg.ReadTimeout || s.IdleTimeout != cfg.IdleTimeout || s.ReadHeaderTimeout != cfg.ReadHeaderTimeout {
+		t.Errorf("Expected the timeouts from %+v, got %+v", cfg, s.Server)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/19131243000197", nil)
+	resp := httptest.NewRecorder()
+	s.Handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+}
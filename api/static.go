@@ -0,0 +1,35 @@
+package api
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// staticContentSecurityPolicy allows the inline script and style of the web
+// frontend, and its requests to the API.
+const staticContentSecurityPolicy = "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'"
+
+//go:embed static
+var static embed.FS
+
+// StaticHandler serves the web frontend (a form to look up CNPJs) from a
+// directory with an index.html file, or from the files embedded in the binary
+// if dir is empty.
+func StaticHandler(dir string) (http.Handler, error) {
+	var fsys fs.FS
+	if dir == "" {
+		var err error
+		if fsys, err = fs.Sub(static, "static"); err != nil {
+			return nil, fmt.Errorf("error opening the embedded frontend: %w", err)
+		}
+	} else {
+		fsys = os.DirFS(dir)
+	}
+	if _, err := fs.Stat(fsys, "index.html"); err != nil {
+		return nil, fmt.Errorf("error looking for the frontend index.html: %w", err)
+	}
+	return http.FileServer(http.FS(fsys)), nil
+}
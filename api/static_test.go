@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>forty-two</p>"), 0644); err != nil {
+		t.Fatalf("Expected no error creating index.html, got %s", err)
+	}
+	for _, c := range []struct {
+		desc    string
+		dir     string
+		status  int
+		content string
+	}{
+		{"embedded", "", http.StatusOK, `<form id="form">`},
+		{"directory", dir, http.StatusOK, "<p>forty-two</p>"},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			h, err := StaticHandler(c.dir)
+			if err != nil {
+				t.Fatalf("Expected no error creating the static handler, got %s", err)
+			}
+			app := api{db: &mockDatabase{}, static: h}
+			resp := httptest.NewRecorder()
+			http.HandlerFunc(app.companyHandler).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+			if resp.Code != c.status {
+				t.Errorf("Expected GET / to return %d, got %d", c.status, resp.Code)
+			}
+			if !strings.Contains(resp.Body.String(), c.content) {
+				t.Errorf("Expected the frontend to include %s, got %s", c.content, resp.Body.String())
+			}
+			if h := resp.Header().Get("Content-Security-Policy"); h != staticContentSecurityPolicy {
+				t.Errorf("Expected the frontend content security policy to allow its inline script, got %s", h)
+			}
+		})
+	}
+	if _, err := StaticHandler(t.TempDir()); err == nil {
+		t.Error("Expected an error with a directory without index.html, got nil")
+	}
+	app := api{db: &mockDatabase{}}
+	resp := httptest.NewRecorder()
+	http.HandlerFunc(app.companyHandler).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	if resp.Code != http.StatusFound {
+		t.Errorf("Expected GET / without frontend to redirect, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// element names for arrays in the XML: the array of partners (qsa) becomes
+// <partners><partner>…</partner></partners>, other arrays keep their name and
+// have <item> elements
+var xmlArrays = map[string][2]string{
+	"qsa": {"partners", "partner"},
+}
+
+// writeXMLValue reads the next JSON value from the decoder and writes it to
+// the encoder as an element named after the JSON key, keeping the order of
+// the keys in objects.
+func writeXMLValue(dec *json.Decoder, enc *xml.Encoder, key string) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	name, item := key, "item"
+	if n, ok := xmlArrays[key]; ok {
+		name, item = n[0], n[1]
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := t.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := writeXMLValue(dec, enc, k.(string)); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for dec.More() {
+				if err := writeXMLValue(dec, enc, item); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := dec.Token(); err != nil { // closing delimiter
+			return err
+		}
+	case nil: // null is an empty element
+	case json.Number:
+		if err := enc.EncodeToken(xml.CharData(v.String())); err != nil {
+			return err
+		}
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprintf("%v", v))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// JSONToXML converts the JSON of a company to XML, with a <company> root
+// element and one element per field. The array of partners (qsa) becomes
+// <partners><partner>…</partner></partners>.
+func JSONToXML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("company JSON should be an object")
+	}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	enc := xml.NewEncoder(&b)
+	root := xml.StartElement{Name: xml.Name{Local: "company"}}
+	if err := enc.EncodeToken(root); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		k, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error reading company JSON: %w", err)
+		}
+		n := k.(string)
+		if err := writeXMLValue(dec, enc, n); err != nil {
+			return nil, fmt.Errorf("error converting %s to XML: %w", n, err)
+		}
+	}
+	if _, err := dec.Token(); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading company JSON: %w", err)
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// csvFields reads the fields of a company JSON, keeping the order of the keys.
+// Strings and numbers are used as they are, null becomes an empty string, and
+// arrays and objects (e.g. qsa, the list of partners) are kept as JSON.
+func csvFields(data []byte) ([]string, map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, errors.New("company JSON should be an object")
+	}
+	var keys []string
+	vals := make(map[string]string)
+	for dec.More() {
+		k, err := dec.Token()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading company JSON: %w", err)
+		}
+		n := k.(string)
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, fmt.Errorf("error reading %s from company JSON: %w", n, err)
+		}
+		keys = append(keys, n)
+		vals[n] = csvValue(v)
+	}
+	if _, err := dec.Token(); err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("error reading company JSON: %w", err)
+	}
+	return keys, vals, nil
+}
+
+func csvValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	if string(v) == "null" {
+		return ""
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, v); err != nil {
+		return string(v)
+	}
+	return b.String()
+}
+
+// JSONToCSV converts the JSON of a company to a CSV with a header, with the
+// names of the fields, and a single row.
+func JSONToCSV(data []byte) ([]byte, error) {
+	keys, vals, err := csvFields(data)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]string, len(keys))
+	for i, k := range keys {
+		row[i] = vals[k]
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.WriteAll([][]string{keys, row})
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("error writing CSV: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// wantsXML checks whether the Accept header of a request prefers XML over
+// JSON (the first of these media types in the header wins).
+func wantsXML(accept string) bool {
+	for _, m := range strings.Split(accept, ",") {
+		switch strings.TrimSpace(strings.Split(m, ";")[0]) {
+		case "application/xml", "text/xml":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
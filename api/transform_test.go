@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONToXML(t *testing.T) {
+	j := `{"cnpj":"19131243000197","capital_social":1061004800.5,"porte":null,"opcao_pelo_mei":false,"qsa":[{"nome_socio":"FULANA & CIA"},{"nome_socio":"BELTRANO"}],"cnaes_secundarios":[{"codigo":6201501}]}`
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<company><cnpj>19131243000197</cnpj><capital_social>1061004800.5</capital_social><porte></porte><opcao_pelo_mei>false</opcao_pelo_mei><partners><partner><nome_socio>FULANA &amp; CIA</nome_socio></partner><partner><nome_socio>BELTRANO</nome_socio></partner></partners><cnaes_secundarios><item><codigo>6201501</codigo></item></cnaes_secundarios></company>`
+	got, err := JSONToXML([]byte(j))
+	if err != nil {
+		t.Fatalf("expected no error converting JSON to XML, got %s", err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected XML to be\n%s\ngot\n%s", expected, got)
+	}
+	for _, j := range []string{`[42]`, `{"answer": 4`} {
+		if _, err := JSONToXML([]byte(j)); err == nil {
+			t.Errorf("expected an error converting %s to XML, got nil", j)
+		}
+	}
+}
+
+func TestWantsXML(t *testing.T) {
+	for _, c := range []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/xml", true},
+		{"text/xml;q=0.9, */*;q=0.8", true},
+		{"application/json, application/xml", false},
+	} {
+		if got := wantsXML(c.accept); got != c.expected {
+			t.Errorf("expected wantsXML(%q) to be %t, got %t", c.accept, c.expected, got)
+		}
+	}
+}
+
+func TestCompanyHandlerXML(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/19131243000197", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	req.Header.Set("Accept", "application/xml")
+	app := api{db: &mockDatabase{}}
+	resp := httptest.NewRecorder()
+	http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected GET with XML to return %v, but got %v", http.StatusOK, resp.Code)
+	}
+	if h := resp.Header().Get("Content-type"); h != "application/xml" {
+		t.Errorf("Expected content type to be application/xml, got %s", h)
+	}
+	if !strings.Contains(resp.Body.String(), "<company><cnpj>19131243000197</cnpj>") {
+		t.Errorf("Expected XML with the company, got %s", resp.Body.String())
+	}
+}
+
+func TestJSONToCSV(t *testing.T) {
+	j := `{"cnpj":"19131243000197","capital_social":1061004800.5,"porte":null,"opcao_pelo_mei":false,"razao_social":"FULANA, BELTRANO & CIA","qsa":[{"nome_socio": "FULANA"}]}`
+	expected := `cnpj,capital_social,porte,opcao_pelo_mei,razao_social,qsa
+19131243000197,1061004800.5,,false,"FULANA, BELTRANO & CIA","[{""nome_socio"":""FULANA""}]"
+`
+	got, err := JSONToCSV([]byte(j))
+	if err != nil {
+		t.Fatalf("expected no error converting JSON to CSV, got %s", err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected CSV to be\n%s\ngot\n%s", expected, got)
+	}
+	for _, j := range []string{`[42]`, `{"answer": 4`} {
+		if _, err := JSONToCSV([]byte(j)); err == nil {
+			t.Errorf("expected an error converting %s to CSV, got nil", j)
+		}
+	}
+}
+
+func TestCompanyHandlerCSV(t *testing.T) {
+	for _, u := range []string{"/cnpj/19131243000197.csv", "/cnpj/19.131.243/0001-97.csv", "/cnpj/19131243000197?format=csv"} {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.cnpjHandler).ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("Expected GET %s to return %v, but got %v", u, http.StatusOK, resp.Code)
+		}
+		if h := resp.Header().Get("Content-type"); h != "text/csv; charset=utf-8" {
+			t.Errorf("Expected content type of %s to be text/csv, got %s", u, h)
+		}
+		if h := resp.Header().Get("Content-Disposition"); h != `attachment; filename="cnpj.csv"` {
+			t.Errorf("Expected %s to be downloaded as cnpj.csv, got %s", u, h)
+		}
+		if l := strings.Count(resp.Body.String(), "\n"); l < 2 {
+			t.Errorf("Expected CSV of %s to have a header and a row, got %s", u, resp.Body.String())
+		}
+	}
+}
+
+func TestBatchCSVHandler(t *testing.T) {
+	for _, c := range []struct {
+		query  string
+		status int
+		rows   int
+	}{
+		{"cnpjs=19131243000197,33.683.111/0002-80,19131243000197", http.StatusOK, 2},
+		{"cnpjs=33683111000280", http.StatusNotFound, 0},
+		{"cnpjs=42", http.StatusBadRequest, 0},
+		{"", http.StatusBadRequest, 0},
+		{"cnpjs=" + strings.Repeat("19131243000197,", 100) + "19131243000197", http.StatusBadRequest, 0},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/cnpj/batch.csv?"+c.query, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.cnpjHandler).ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("Expected GET /cnpj/batch.csv?%s to return %v, but got %v", c.query, c.status, resp.Code)
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		r, err := csv.NewReader(resp.Body).ReadAll()
+		if err != nil {
+			t.Errorf("Expected a valid CSV, got %s", err)
+		}
+		if len(r) != c.rows+1 {
+			t.Errorf("Expected a header and %d rows, got %d lines", c.rows, len(r))
+		}
+		if len(r) > 0 && r[0][0] == "" {
+			t.Errorf("Expected a header with the field names, got %v", r[0])
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/cnpj"
+)
+
+// PostgreSQL channel notified with the CNPJ of each updated company
+const updatesChannel = "cnpj_updates"
+
+// updatesHub shares a single database subscription to company updates among
+// all the clients connected to the updates endpoint.
+type updatesHub struct {
+	once  sync.Once
+	mutex sync.Mutex
+	subs  map[string]map[chan struct{}]struct{}
+}
+
+func newUpdatesHub() *updatesHub {
+	return &updatesHub{subs: make(map[string]map[chan struct{}]struct{})}
+}
+
+// start subscribes to updates in the database the first time it is called.
+func (h *updatesHub) start(db database) {
+	h.once.Do(func() {
+		go func() {
+			if err := db.Listen(context.Background(), updatesChannel, h.publish); err != nil {
+				log.Output(1, fmt.Sprintf("Warning: stopped listening to company updates: %s", err))
+			}
+		}()
+	})
+}
+
+func (h *updatesHub) subscribe(n string) (chan struct{}, func()) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	ch := make(chan struct{}, 1)
+	if h.subs[n] == nil {
+		h.subs[n] = make(map[chan struct{}]struct{})
+	}
+	h.subs[n][ch] = struct{}{}
+	return ch, func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		delete(h.subs[n], ch)
+		if len(h.subs[n]) == 0 {
+			delete(h.subs, n)
+		}
+	}
+}
+
+// publish signals the subscribers of a CNPJ without blocking: a subscriber
+// that has not handled the previous update yet reads the company only once.
+func (h *updatesHub) publish(n string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for ch := range h.subs[n] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// updatesHandler streams the company JSON as server-sent events every time
+// the company is updated.
+func (app *api) updatesHandler(w http.ResponseWriter, r *http.Request, v string) {
+	if r.Method != http.MethodGet {
+		messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		return
+	}
+	n, err := cnpj.ParseCNPJ(v)
+	if err != nil {
+		messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", v))
+		return
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		messageResponse(w, http.StatusInternalServerError, "Esse servidor não suporta streaming.")
+		return
+	}
+	// the stream is not limited by the write timeout of the server
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	app.updates.start(app.db)
+	ch, unsubscribe := app.updates.subscribe(n)
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			s, err := app.db.GetCompany(r.Context(), n)
+			if err != nil {
+				continue
+			}
+			var b bytes.Buffer
+			if err := json.Compact(&b, []byte(s)); err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", b.String())
+			f.Flush()
+		}
+	}
+}
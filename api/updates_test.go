@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncRecorder is a response writer safe to read while the handler writes.
+type syncRecorder struct {
+	mutex  sync.Mutex
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *syncRecorder) Header() http.Header { return r.header }
+func (r *syncRecorder) Flush()              {}
+
+func (r *syncRecorder) WriteHeader(s int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.status = s
+}
+
+func (r *syncRecorder) Write(b []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.body.Write(b)
+}
+
+func (r *syncRecorder) String() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.body.String()
+}
+
+func TestUpdatesHub(t *testing.T) {
+	h := newUpdatesHub()
+	ch, unsubscribe := h.subscribe("19131243000197")
+	h.publish("33683111000280")
+	h.publish("19131243000197")
+	h.publish("19131243000197") // does not block
+	select {
+	case <-ch:
+	default:
+		t.Error("expected an update for the subscribed cnpj")
+	}
+	select {
+	case <-ch:
+		t.Error("expected only one pending update")
+	default:
+	}
+	unsubscribe()
+	if len(h.subs) != 0 {
+		t.Errorf("expected no subscribers, got %d", len(h.subs))
+	}
+}
+
+func TestUpdatesHandler(t *testing.T) {
+	app := api{db: &mockDatabase{}, updates: newUpdatesHub()}
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/cnpj/19.131.243/0001-97/updates", nil).WithContext(ctx)
+	resp := &syncRecorder{header: make(http.Header)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.cnpjHandler(resp, req)
+	}()
+	for i := 0; i < 100; i++ { // wait for the handler to subscribe
+		app.updates.mutex.Lock()
+		n := len(app.updates.subs)
+		app.updates.mutex.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	app.updates.publish("19131243000197")
+	for i := 0; i < 100 && resp.String() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if h := resp.Header().Get("Content-Type"); h != "text/event-stream" {
+		t.Errorf("expected content type text/event-stream, got %s", h)
+	}
+	if s := resp.String(); !strings.HasPrefix(s, `data: {"cnpj":"19131243000197"`) || !strings.HasSuffix(s, "}\n\n") {
+		t.Errorf("expected an event with the company, got %s", s)
+	}
+}
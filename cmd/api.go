@@ -1,8 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/cuducos/minha-receita/api"
 	"github.com/cuducos/minha-receita/db"
@@ -10,8 +17,10 @@ import (
 )
 
 const (
-	defaultPort = "8000"
-	apiHelper   = `
+	defaultPort        = "8000"
+	connectionAttempts = 10
+	connectionDelay    = 3 * time.Second
+	apiHelper          = `
 Starts the web API.
 
 Using GODEBUG environment variable changes the HTTP server verbosity (for
@@ -24,28 +33,128 @@ reports to New Relic. Otherwise, the New Relic wrappers are just ignored.
 
 The HTTP server is prepared to do a host header validation agains the value of
 ALLOWED_HOST environment variable. If this variable is not set, this validation
-is skipped.`
+is skipped.
+
+The /admin/stats endpoint (row count, table size, metadata and connection pool
+stats) is only available if the ADMIN_API_KEY environment variable is set, and
+requests to it must include the header Authorization: Bearer <ADMIN_API_KEY>.
+The row count is an estimate, unless the ?exact=true query parameter is used
+(which might take minutes).
+
+If the database is not ready when the web API starts, it retries to connect
+%d times, waiting %s between attempts. Then it opens the minimum number of
+connections of the pool, set with pool_min_conns in the DATABASE_URL (e.g.
+postgres://…?pool_min_conns=8), to avoid slow responses on startup.
+
+The /admin/cache endpoint (cache hits, misses, evictions and size), the
+/admin/import-report endpoint (summary of the last import) and the
+/admin/status-distribution endpoint (number of companies by
+situacao_cadastral) follow the same rules. The cache is disabled by default, and CACHE_MAX_ITEMS sets how
+many companies are kept in memory (e.g. CACHE_MAX_ITEMS=100000), and company
+responses tell whether they came from it in the X-Cache header (HIT or MISS). If
+CACHE_WARM_FILE is set to a file with one CNPJ per line (see the warm-cache
+command), these companies are loaded to the cache on startup.
+
+POST /admin/import, with a JSON body (Content-Type: application/json) such as
+{"source_url": "https://…", "dry_run": false}, starts an import in the background from a JSONL file in the
+format of company updates ({"cnpj_basico": "…", "data": {…}} per line). It
+responds with the URL to follow the import (GET) or to cancel it (DELETE) in
+the Location header. The status of imports is saved in the metadata table, and
+imports without progress saved for 30s (e.g. when the API is restarted) are
+reported as failed. Only one import runs at a time (including the ones from
+the command line), so it responds with 409 while another one is running, but
+dry runs are not restricted.
+
+Responses include a Warning header if the imported data is older than 7 days.
+This can be changed with the MAX_DATA_AGE_DAYS environment variable.
+
+If COMPANY_MAX_AGE is set (e.g. COMPANY_MAX_AGE=720h), company responses
+include an Age header, and companies older than that are only served to
+requests accepting stale data (Cache-Control: max-stale).
+
+The database queries time out after 5 seconds by default. This can be changed
+with the GET_TIMEOUT_SECONDS environment variable (e.g. GET_TIMEOUT_SECONDS=10),
+or with SET_QUERY_TIMEOUT (e.g. SET_QUERY_TIMEOUT=10s), which takes precedence.
+
+MAX_CONCURRENT_QUERIES limits how many queries looking for companies run at the
+same time (no limit by default). Once it is reached, the API responds with 503
+instead of queueing more queries.
+
+ALLOWED_IPS and DENIED_IPS restrict the access to the API to comma-separated
+lists of networks (e.g. ALLOWED_IPS=10.0.0.0/8). If the API runs behind reverse
+proxies, set TRUSTED_PROXIES to their networks so the client IP is read from
+the X-Forwarded-For header.
+
+The HTTP server times out reading requests after 5s (2s for the headers),
+writing responses after 30s, and closes idle connections after 120s. These can
+be changed with HTTP_READ_TIMEOUT, HTTP_READ_HEADER_TIMEOUT, HTTP_WRITE_TIMEOUT
+and HTTP_IDLE_TIMEOUT (e.g. HTTP_WRITE_TIMEOUT=1m).
+
+With --pgbouncer, the API works with PgBouncer in transaction pooling mode,
+but the /cnpj/<cnpj>/updates endpoint does not receive updates.
+
+A web page with a form to look up CNPJs is served at /, unless --no-ui is used
+(then / redirects to the documentation).`
 )
 
 var (
 	port     string
 	newRelic string
+	noUI     bool
+	uiDir    string
 )
 
 var apiCmd = &cobra.Command{
 	Use:   "api",
 	Short: "Spins up the web API",
-	Long:  apiHelper,
+	Long:  fmt.Sprintf(apiHelper, connectionAttempts, connectionDelay),
 	RunE: func(_ *cobra.Command, _ []string) error {
 		u, err := loadDatabaseURI()
 		if err != nil {
 			return err
 		}
-		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		cfg := db.PostgreSQLConfig{Schema: postgresSchema, PgBouncerCompatible: pgBouncer}
+		pg, err := db.ConnectWithRetryWithConfig(ctx, u, cfg, connectionAttempts, connectionDelay)
 		if err != nil {
 			return err
 		}
 		defer pg.Close()
+		if err := pg.WarmPool(ctx); err != nil {
+			return err
+		}
+		if pg.Timeouts, err = db.ConfigFromEnv(); err != nil {
+			return err
+		}
+		if v := os.Getenv("SET_QUERY_TIMEOUT"); v != "" {
+			t, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("could not parse SET_QUERY_TIMEOUT %s: %w", v, err)
+			}
+			pg.Timeouts.Get = t
+		}
+		if v := os.Getenv("MAX_CONCURRENT_QUERIES"); v != "" {
+			if pg.MaxConcurrentQueries, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf("could not parse MAX_CONCURRENT_QUERIES %s: %w", v, err)
+			}
+		}
+		if v := os.Getenv("CACHE_MAX_ITEMS"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("could not parse CACHE_MAX_ITEMS %s: %w", v, err)
+			}
+			if n > 0 {
+				pg.Cache = db.NewMemoryCache(n)
+			}
+		}
+		if f := os.Getenv("CACHE_WARM_FILE"); f != "" && pg.Cache != nil {
+			go func() {
+				if err := pg.WarmCacheFromFile(ctx, f); err != nil {
+					log.Output(1, fmt.Sprintf("Warning: could not warm up the cache from %s: %s", f, err))
+				}
+			}()
+		}
 		if port == "" {
 			port = os.Getenv("PORT")
 		}
@@ -55,7 +164,13 @@ var apiCmd = &cobra.Command{
 		if newRelic == "" {
 			newRelic = os.Getenv("NEW_RELIC_LICENSE_KEY")
 		}
-		api.Serve(&pg, port, newRelic)
+		var ui http.Handler
+		if !noUI {
+			if ui, err = api.StaticHandler(uiDir); err != nil {
+				return err
+			}
+		}
+		api.Serve(ctx, &pg, port, newRelic, ui)
 		return nil
 	},
 }
@@ -75,5 +190,8 @@ func apiCLI() *cobra.Command {
 		"",
 		"New Relic license key (deafult NEW_RELIC_LICENSE_KEY environment variable)",
 	)
+	addPgBouncer(apiCmd)
+	apiCmd.Flags().BoolVar(&noUI, "no-ui", noUI, "do not serve the web frontend at /, redirecting to the documentation instead")
+	apiCmd.Flags().StringVar(&uiDir, "ui-dir", "", "directory with an index.html to serve as the web frontend (default is the one embedded in the binary)")
 	return apiCmd
 }
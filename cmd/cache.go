@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/cuducos/minha-receita/cnpj"
+	"github.com/spf13/cobra"
+)
+
+const warmCacheHelper = `
+Lists the most recently requested CNPJs in an access log (e.g. from a reverse
+proxy in front of the web API), one per line, most recent first.
+
+The cache of the web API lives in its own memory, so the output of this command
+is meant to be saved to a file and set as CACHE_WARM_FILE when starting the web
+API, which then reads these CNPJs from the database to warm up the cache.
+
+The logs of the web API itself cannot be used, as they include only the base of
+the CNPJs.`
+
+// matches CNPJs in a URL path, formatted or not
+var cnpjInPath = regexp.MustCompile(`/(\d{14}|\d{2}\.\d{3}\.\d{3}/\d{4}-\d{2})\b`)
+
+var (
+	warmCacheTopN      int
+	warmCacheAccessLog string
+	warmCacheOutput    string
+)
+
+// recentCNPJs returns up to n distinct CNPJs found in the lines of an access
+// log, from the most recent (the last line) to the least recent. The log is
+// read line by line, keeping only the last n CNPJs in memory, since access
+// logs might be huge.
+func recentCNPJs(r io.Reader, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	recent := list.New() // most recent first
+	seen := make(map[string]*list.Element)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		ms := cnpjInPath.FindAllStringSubmatch(s.Text(), -1)
+		for i := len(ms) - 1; i >= 0; i-- { // the first CNPJ of a line is the most recent one
+			c, err := cnpj.ParseCNPJ(ms[i][1])
+			if err != nil {
+				continue
+			}
+			if e, ok := seen[c]; ok {
+				recent.MoveToFront(e)
+				continue
+			}
+			seen[c] = recent.PushFront(c)
+			if recent.Len() > n {
+				delete(seen, recent.Remove(recent.Back()).(string))
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	ns := make([]string, 0, recent.Len())
+	for e := recent.Front(); e != nil; e = e.Next() {
+		ns = append(ns, e.Value.(string))
+	}
+	return ns, nil
+}
+
+var warmCacheCmd = &cobra.Command{
+	Use:   "warm-cache",
+	Short: "Lists the most recently requested CNPJs to warm up the web API cache",
+	Long:  warmCacheHelper,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		f, err := os.Open(warmCacheAccessLog)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", warmCacheAccessLog, err)
+		}
+		defer f.Close()
+		ns, err := recentCNPJs(f, warmCacheTopN)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", warmCacheAccessLog, err)
+		}
+		w := os.Stdout
+		if warmCacheOutput != "" {
+			w, err = os.Create(warmCacheOutput)
+			if err != nil {
+				return fmt.Errorf("error creating %s: %w", warmCacheOutput, err)
+			}
+			defer w.Close()
+		}
+		for _, n := range ns {
+			if _, err := fmt.Fprintln(w, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func warmCacheCLI() *cobra.Command {
+	warmCacheCmd.Flags().IntVarP(&warmCacheTopN, "top-n", "n", 1000, "number of CNPJs to list")
+	warmCacheCmd.Flags().StringVarP(&warmCacheAccessLog, "access-log", "l", "", "access log file to read the requested CNPJs from")
+	warmCacheCmd.Flags().StringVarP(&warmCacheOutput, "output", "o", "", "file to save the CNPJs to (default: standard output)")
+	warmCacheCmd.MarkFlagRequired("access-log")
+	return warmCacheCmd
+}
@@ -2,11 +2,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 
+	"github.com/cuducos/minha-receita/cnpj"
 	"github.com/cuducos/minha-receita/db"
 )
 
@@ -22,9 +24,12 @@ See --help for more details.
 )
 
 var (
-	dir            string
-	databaseURI    string
-	postgresSchema string
+	dir              string
+	databaseURI      string
+	postgresSchema   string
+	confirmDrop      string
+	jsonbCompression string
+	pgBouncer        bool
 )
 
 func assertDirExists() error {
@@ -66,18 +71,24 @@ var createCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		pg, err := db.NewPostgreSQLWithConfig(u, db.PostgreSQLConfig{Schema: postgresSchema, JSONBCompression: jsonbCompression})
 		if err != nil {
 			return err
 		}
 		defer pg.Close()
-		return pg.CreateTable()
+		_, err = pg.CreateTable()
+		return err
 	},
 }
 
 var dropCmd = &cobra.Command{
 	Use:   "drop",
 	Short: "Drops the tables in PostgreSQL",
+	Long: `
+Drops the tables in PostgreSQL.
+
+As a safety measure, the name of the table (cnpj) must be passed to --confirm,
+and the tables are not dropped while an import is running.`,
 	RunE: func(_ *cobra.Command, _ []string) error {
 		u, err := loadDatabaseURI()
 		if err != nil {
@@ -88,7 +99,185 @@ var dropCmd = &cobra.Command{
 			return err
 		}
 		defer pg.Close()
-		return pg.DropTable()
+		return pg.DropTable(confirmDrop)
+	},
+}
+
+var compressCmd = &cobra.Command{
+	Use:   "compress",
+	Short: "Compresses the JSON of existing records in PostgreSQL",
+	Long: `
+Compresses with zstd the JSON of records saved without the --compress-json
+flag of the transform command. It is meant to run once, after the index is
+created. Compressed records are not available to the JSON search.`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		_, err = pg.CompressExistingRows(context.Background())
+		return err
+	},
+}
+
+var replayDeadLetterCmd = &cobra.Command{
+	Use:   "replay-dead-letter <file> [<file>...]",
+	Short: "Saves to PostgreSQL the companies in dead-letter files",
+	Long: `
+Saves to PostgreSQL the companies in the dead-letter files created by the
+transform command with the --dead-letter-path flag.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		return profiled(func() error {
+			for _, a := range args {
+				if err := pg.ReplayDeadLetter(context.Background(), a); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	},
+}
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <cnpj>",
+	Short: "Shows the PostgreSQL query plan for a CNPJ lookup",
+	Long: `
+Runs EXPLAIN ANALYZE on the query used by the web API to look up a CNPJ, and
+shows the query plan as a tree. Useful to debug slow lookups.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		n, err := cnpj.ParseCNPJ(args[0])
+		if err != nil {
+			return err
+		}
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		p, err := pg.ExplainQuery(context.Background(), n)
+		if err != nil {
+			return err
+		}
+		s, err := db.FormatQueryPlan(p)
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+		return nil
+	},
+}
+
+var deleteDryRun bool
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <cnpj> [<cnpj>...]",
+	Short: "Deletes companies from PostgreSQL",
+	Long: `
+Deletes companies from PostgreSQL by CNPJ (e.g. cancelled registrations). If
+any of the CNPJs is invalid, nothing is deleted.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		pg.DeleteOptions.DryRun = deleteDryRun
+		n, err := pg.BulkDelete(context.Background(), args)
+		if err != nil {
+			return err
+		}
+		if deleteDryRun {
+			fmt.Printf("%d companies would be deleted\n", n)
+			return nil
+		}
+		fmt.Printf("%d companies deleted\n", n)
+		return nil
+	},
+}
+
+var shrinkCluster bool
+
+var shrinkCmd = &cobra.Command{
+	Use:   "shrink",
+	Short: "Reclaims the disk space of deleted companies in PostgreSQL",
+	Long: `
+Rewrites the companies table in PostgreSQL to return the disk space of deleted
+companies (e.g. after the delete command) to the operating system.
+
+Warning: the table is locked, even for reading, while it is rewritten, so the
+API cannot read from it until the command finishes. With --cluster, the table
+is rewritten sorted by the primary key (this requires the indexes created by
+the transform command), which also locks the table, but is usually faster.`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		if shrinkCluster {
+			return pg.ShrinkConcurrent(context.Background())
+		}
+		return pg.Shrink(context.Background())
+	},
+}
+
+var reindexConcurrent = true
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuilds the indexes of the companies table in PostgreSQL",
+	Long: `
+Rebuilds all the indexes of the companies table in PostgreSQL, e.g. after data
+corruption or a failed import, and updates the query planner statistics
+afterwards.
+
+By default, indexes are rebuilt with REINDEX CONCURRENTLY, which does not lock
+the table (in PostgreSQL older than 12 it falls back to a plain REINDEX). With
+--concurrent=false, a plain REINDEX is used, which is usually faster, but
+blocks writes to the table while it runs.`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		if reindexConcurrent {
+			return pg.Reindex(context.Background())
+		}
+		return pg.ReindexLocking(context.Background())
 	},
 }
 
@@ -103,11 +292,27 @@ func addDatabase(c *cobra.Command) *cobra.Command {
 	return c
 }
 
+func addJSONBCompression(c *cobra.Command) *cobra.Command {
+	c.Flags().StringVar(&jsonbCompression, "jsonb-compression", "", "compression of the JSONB columns when creating the tables: pglz, lz4 or default (requires PostgreSQL 14)")
+	return c
+}
+
+func addPgBouncer(c *cobra.Command) *cobra.Command {
+	c.Flags().BoolVar(&pgBouncer, "pgbouncer", pgBouncer, "compatibility with PgBouncer in transaction mode (no prepared statements and no import lock)")
+	return c
+}
+
 // CLI returns the root command from Cobra CLI tool.
 func CLI() *cobra.Command {
-	for _, c := range []*cobra.Command{createCmd, dropCmd} {
+	for _, c := range []*cobra.Command{createCmd, dropCmd, compressCmd, replayDeadLetterCmd, explainCmd, deleteCmd, shrinkCmd, reindexCmd} {
 		addDatabase(c)
 	}
+	addProfiling(replayDeadLetterCmd)
+	deleteCmd.Flags().BoolVar(&deleteDryRun, "dry-run", deleteDryRun, "only count the companies that would be deleted")
+	shrinkCmd.Flags().BoolVar(&shrinkCluster, "cluster", shrinkCluster, "rewrite the table with CLUSTER instead of VACUUM FULL")
+	reindexCmd.Flags().BoolVar(&reindexConcurrent, "concurrent", reindexConcurrent, "rebuild the indexes without locking the table (requires PostgreSQL 12)")
+	addJSONBCompression(createCmd)
+	dropCmd.Flags().StringVarP(&confirmDrop, "confirm", "c", "", "name of the table to be dropped, as a confirmation")
 	for _, c := range []*cobra.Command{
 		apiCLI(),
 		downloadCLI(),
@@ -117,8 +322,17 @@ func CLI() *cobra.Command {
 		checkCLI(),
 		createCmd,
 		dropCmd,
+		compressCmd,
+		replayDeadLetterCmd,
+		explainCmd,
+		deleteCmd,
+		shrinkCmd,
+		reindexCmd,
 		transformCLI(),
 		sampleCLI(),
+		sampleCompaniesCLI(),
+		warmCacheCLI(),
+		metaCLI(),
 	} {
 		rootCmd.AddCommand(c)
 	}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/spf13/cobra"
+)
+
+const metaHelper = `
+Exports or imports the contents of the metadata table (import dates, checksums,
+etc.) as a JSON object, e.g. to clone a production database for staging.`
+
+var (
+	metaOutput string
+	metaInput  string
+)
+
+var metaCmd = &cobra.Command{
+	Use:   "meta",
+	Short: "Exports or imports the metadata table",
+	Long:  metaHelper,
+}
+
+var metaExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Saves the metadata table to a JSON file",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		m, err := pg.ExportMeta(context.Background())
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error serializing metadata: %w", err)
+		}
+		if err := os.WriteFile(metaOutput, b, 0644); err != nil {
+			return fmt.Errorf("error writing metadata to %s: %w", metaOutput, err)
+		}
+		fmt.Printf("%d metadata keys exported to %s\n", len(m), metaOutput)
+		return nil
+	},
+}
+
+var metaImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Saves the contents of a JSON file to the metadata table",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		b, err := os.ReadFile(metaInput)
+		if err != nil {
+			return fmt.Errorf("error reading metadata from %s: %w", metaInput, err)
+		}
+		var m map[string]string
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("error parsing metadata from %s: %w", metaInput, err)
+		}
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		if err := pg.ImportMeta(context.Background(), m); err != nil {
+			return err
+		}
+		fmt.Printf("%d metadata keys imported from %s\n", len(m), metaInput)
+		return nil
+	},
+}
+
+func metaCLI() *cobra.Command {
+	metaExportCmd = addDatabase(metaExportCmd)
+	metaExportCmd.Flags().StringVarP(&metaOutput, "output", "o", "meta.json", "path of the JSON file to be created")
+	metaImportCmd = addDatabase(metaImportCmd)
+	metaImportCmd.Flags().StringVarP(&metaInput, "input", "i", "meta.json", "path of the JSON file to be imported")
+	metaCmd.AddCommand(metaExportCmd, metaImportCmd)
+	return metaCmd
+}
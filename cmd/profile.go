@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cpuProfile string
+	memProfile string
+)
+
+func addProfiling(c *cobra.Command) *cobra.Command {
+	c.Flags().StringVar(&cpuProfile, "cpu-profile", "", "write a CPU profile of the import to this file (see go tool pprof)")
+	c.Flags().StringVar(&memProfile, "mem-profile", "", "write a heap profile to this file after the import (see go tool pprof)")
+	return c
+}
+
+// profiled runs a function writing the CPU and memory profiles set with the
+// flags from `addProfiling`, if any.
+func profiled(fn func() error) error {
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return fmt.Errorf("could not create cpu profile %s: %w", cpuProfile, err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return fmt.Errorf("could not start cpu profile: %w", err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if memProfile == "" {
+		return nil
+	}
+	f, err := os.Create(memProfile)
+	if err != nil {
+		return fmt.Errorf("could not create memory profile %s: %w", memProfile, err)
+	}
+	defer f.Close()
+	runtime.GC() // get up-to-date statistics
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("could not write memory profile: %w", err)
+	}
+	return nil
+}
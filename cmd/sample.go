@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"path/filepath"
 
+	"github.com/cuducos/minha-receita/db"
 	"github.com/cuducos/minha-receita/sample"
 	"github.com/spf13/cobra"
 )
@@ -29,6 +33,59 @@ var sampleCmd = &cobra.Command{
 	},
 }
 
+var (
+	sampleCount  int
+	sampleFormat string
+)
+
+var sampleCompaniesCmd = &cobra.Command{
+	Use:   "sample-companies",
+	Short: "Prints random companies from PostgreSQL",
+	Long: `
+Prints random companies from PostgreSQL, one per line, useful for testing and
+benchmarking without knowing specific CNPJs. The output is either the JSON of
+each company (--format json) or only their CNPJ numbers (--format cnpj).`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if sampleFormat != "json" && sampleFormat != "cnpj" {
+			return fmt.Errorf("invalid format %s, expected json or cnpj", sampleFormat)
+		}
+		u, err := loadDatabaseURI()
+		if err != nil {
+			return err
+		}
+		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+		s, err := pg.SampleCompanies(context.Background(), sampleCount)
+		if err != nil {
+			return err
+		}
+		for _, j := range s {
+			if sampleFormat == "json" {
+				fmt.Println(j)
+				continue
+			}
+			var c struct {
+				CNPJ string `json:"cnpj"`
+			}
+			if err := json.Unmarshal([]byte(j), &c); err != nil {
+				return fmt.Errorf("error reading cnpj from %s: %w", j, err)
+			}
+			fmt.Println(c.CNPJ)
+		}
+		return nil
+	},
+}
+
+func sampleCompaniesCLI() *cobra.Command {
+	sampleCompaniesCmd = addDatabase(sampleCompaniesCmd)
+	sampleCompaniesCmd.Flags().IntVarP(&sampleCount, "count", "n", 10, "number of companies")
+	sampleCompaniesCmd.Flags().StringVarP(&sampleFormat, "format", "f", "json", "output format: json or cnpj")
+	return sampleCompaniesCmd
+}
+
 func sampleCLI() *cobra.Command {
 	sampleCmd = addDataDir(sampleCmd)
 	sampleCmd.Flags().IntVarP(&maxLines, "max-lines", "m", sample.MaxLines, "maximum lines per file")
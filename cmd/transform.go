@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
 	"github.com/cuducos/minha-receita/db"
 	"github.com/cuducos/minha-receita/transform"
 	"github.com/spf13/cobra"
@@ -17,13 +22,18 @@ var (
 	cleanUp              bool
 	noPrivacy            bool
 	highMemory           bool
+	verifyBatches        bool
+	compressJSON         bool
+	deadLetterPath       string
+	keepHistory          bool
+	resume               bool
 )
 
 var transformCmd = &cobra.Command{
 	Use:   "transform",
 	Short: "Transforms the CSV files into database records",
 	Long:  transformHelper,
-	RunE: func(_ *cobra.Command, _ []string) error {
+	RunE: func(c *cobra.Command, _ []string) error {
 		if err := assertDirExists(); err != nil {
 			return err
 		}
@@ -31,27 +41,56 @@ var transformCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		pg, err := db.NewPostgreSQL(u, postgresSchema)
+		pg, err := db.NewPostgreSQLWithConfig(u, db.PostgreSQLConfig{Schema: postgresSchema, JSONBCompression: jsonbCompression, PgBouncerCompatible: pgBouncer})
 		if err != nil {
 			return err
 		}
 		defer pg.Close()
+		if pg.Timeouts, err = db.ConfigFromEnv(); err != nil {
+			return err
+		}
+		pg.CreateOptions.VerifyBatch = verifyBatches
+		pg.CompressJSON = compressJSON
+		pg.CreateOptions.DeadLetterPath = deadLetterPath
+		pg.KeepHistory = keepHistory
+		if !c.Flags().Changed("batch-size") {
+			if v := os.Getenv("BATCH_SIZE"); v != "" {
+				if batchSize, err = strconv.Atoi(v); err != nil {
+					return fmt.Errorf("could not parse BATCH_SIZE %s: %w", v, err)
+				}
+			} else if batchSize, err = pg.AutoTuneBatchSize(context.Background()); err != nil {
+				return err
+			}
+		}
 
+		if cleanUp && resume {
+			return fmt.Errorf("cannot use --clean-up and --resume together")
+		}
 		if cleanUp {
-			if err := pg.DropTable(); err != nil {
+			if err := pg.DropTable(pg.CompanyTableName); err != nil {
 				return err
 			}
-			if err := pg.CreateTable(); err != nil {
+			if _, err := pg.CreateTable(); err != nil {
 				return err
 			}
 		}
-		return transform.Transform(dir, &pg, maxParallelDBQueries, batchSize, !noPrivacy, highMemory)
+		l, err := pg.AcquireImportLock(context.Background())
+		if err != nil {
+			return err
+		}
+		defer l.Release(context.Background())
+		return profiled(func() error {
+			return transform.Transform(dir, &pg, maxParallelDBQueries, batchSize, !noPrivacy, highMemory, resume)
+		})
 	},
 }
 
 func transformCLI() *cobra.Command {
 	transformCmd = addDataDir(transformCmd)
 	transformCmd = addDatabase(transformCmd)
+	transformCmd = addProfiling(transformCmd)
+	transformCmd = addJSONBCompression(transformCmd)
+	transformCmd = addPgBouncer(transformCmd)
 	transformCmd.Flags().IntVarP(
 		&maxParallelDBQueries,
 		"max-parallel-db-queries",
@@ -59,9 +98,14 @@ func transformCLI() *cobra.Command {
 		transform.MaxParallelDBQueries,
 		"maximum parallel database queries",
 	)
-	transformCmd.Flags().IntVarP(&batchSize, "batch-size", "b", transform.BatchSize, "size of the batch to save to the database")
+	transformCmd.Flags().IntVarP(&batchSize, "batch-size", "b", transform.BatchSize, "size of the batch to save to the database (if not set, uses BATCH_SIZE or an estimate based on the PostgreSQL work_mem)")
 	transformCmd.Flags().BoolVarP(&cleanUp, "clean-up", "c", cleanUp, "drop & recreate the database table before starting")
 	transformCmd.Flags().BoolVarP(&noPrivacy, "no-privacy", "p", noPrivacy, "include email addresses, CPF and other PII in the JSON data")
 	transformCmd.Flags().BoolVarP(&highMemory, "high-memory", "x", highMemory, "high memory availability mode, faster but requires a lot of free RAM")
+	transformCmd.Flags().BoolVarP(&verifyBatches, "verify-batches", "v", verifyBatches, "read each batch back from the database to verify it was saved (slower)")
+	transformCmd.Flags().BoolVarP(&compressJSON, "compress-json", "z", compressJSON, "compress the JSON data with zstd (saves disk space, but JSON search and incremental updates do not work)")
+	transformCmd.Flags().StringVar(&deadLetterPath, "dead-letter-path", "", "save batches that fail to gzipped JSONL files starting with this path, instead of stopping")
+	transformCmd.Flags().BoolVar(&keepHistory, "keep-history", keepHistory, "also save the companies to the history table (uses twice the disk space)")
+	transformCmd.Flags().BoolVar(&resume, "resume", resume, "skip the venues files already saved by a previous import that was interrupted")
 	return transformCmd
 }
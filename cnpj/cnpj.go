@@ -0,0 +1,153 @@
+// Package cnpj provides the canonical functions to normalize, validate and
+// format CNPJ numbers across Minha Receita.
+package cnpj
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCNPJ is returned when a string is not a valid CNPJ number.
+var ErrInvalidCNPJ = errors.New("invalid cnpj")
+
+var (
+	firstCheckDigitWeights  = []int{5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+	secondCheckDigitWeights = []int{6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+)
+
+func checkDigit(ds []int, weights []int) int {
+	var s int
+	for i, w := range weights {
+		s += ds[i] * w
+	}
+	r := s % 11
+	if r < 2 {
+		return 0
+	}
+	return 11 - r
+}
+
+func digits(s string) ([]int, bool) {
+	ds := make([]int, len(s))
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+		ds[i] = int(c - '0')
+	}
+	return ds, true
+}
+
+func allEqual(s string) bool {
+	return strings.Count(s, s[:1]) == len(s)
+}
+
+// ParseCNPJ accepts a CNPJ number either formatted (e.g. 12.345.678/0001-90)
+// or unformatted, and returns it normalized as a 14-digit string, or an error
+// if it is not a valid CNPJ.
+func ParseCNPJ(s string) (string, error) {
+	n := strings.NewReplacer(".", "", "/", "", "-", "").Replace(strings.TrimSpace(s))
+	if len(n) != 14 {
+		return "", fmt.Errorf("%w: %s should have 14 digits", ErrInvalidCNPJ, s)
+	}
+	ds, ok := digits(n)
+	if !ok {
+		return "", fmt.Errorf("%w: %s should have only digits", ErrInvalidCNPJ, s)
+	}
+	if allEqual(n) {
+		return "", fmt.Errorf("%w: %s has all digits equal", ErrInvalidCNPJ, s)
+	}
+	if checkDigit(ds, firstCheckDigitWeights) != ds[12] || checkDigit(ds, secondCheckDigitWeights) != ds[13] {
+		return "", fmt.Errorf("%w: %s has invalid check digits", ErrInvalidCNPJ, s)
+	}
+	return n, nil
+}
+
+// FormatCNPJ takes a normalized 14-digit CNPJ number and returns it in the
+// canonical format used for display, e.g. 12.345.678/0001-90.
+func FormatCNPJ(s string) (string, error) {
+	if _, ok := digits(s); !ok || len(s) != 14 {
+		return "", fmt.Errorf("%w: %s should be a normalized 14-digit cnpj", ErrInvalidCNPJ, s)
+	}
+	return fmt.Sprintf("%s.%s.%s/%s-%s", s[:2], s[2:5], s[5:8], s[8:12], s[12:]), nil
+}
+
+// ErrInvalidNFeAccessKey is returned when a string is not a valid NF-e access
+// key.
+var ErrInvalidNFeAccessKey = errors.New("invalid nf-e access key")
+
+// nfeAccessKeyCheckDigit calculates the check digit of the 43 first digits of
+// a NF-e access key (modulo 11, weights from 2 to 9 from right to left).
+func nfeAccessKeyCheckDigit(ds []int) int {
+	var s int
+	w := 2
+	for i := len(ds) - 1; i >= 0; i-- {
+		s += ds[i] * w
+		w++
+		if w > 9 {
+			w = 2
+		}
+	}
+	d := 11 - s%11
+	if d >= 10 {
+		return 0
+	}
+	return d
+}
+
+// ParseNFeAccessKey extracts the issuer CNPJ from a 44-digit NF-e (Nota Fiscal
+// Eletrônica) access key, as in the Sefaz specification: 2 digits for the
+// state, 4 for year and month, and then the 14 digits of the CNPJ. Spaces
+// (common in printed invoices) are ignored.
+func ParseNFeAccessKey(key string) (string, error) {
+	k := strings.ReplaceAll(strings.TrimSpace(key), " ", "")
+	if len(k) != 44 {
+		return "", fmt.Errorf("%w: %s should have 44 digits", ErrInvalidNFeAccessKey, key)
+	}
+	ds, ok := digits(k)
+	if !ok {
+		return "", fmt.Errorf("%w: %s should have only digits", ErrInvalidNFeAccessKey, key)
+	}
+	if nfeAccessKeyCheckDigit(ds[:43]) != ds[43] {
+		return "", fmt.Errorf("%w: %s has an invalid check digit", ErrInvalidNFeAccessKey, key)
+	}
+	n, err := ParseCNPJ(k[6:20])
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidNFeAccessKey, err)
+	}
+	return n, nil
+}
+
+// BaseCNPJ returns the 8 first digits of a CNPJ (formatted or not), which
+// identify the company and are shared by its headquarters and branches.
+func BaseCNPJ(s string) (string, error) {
+	n, err := ParseCNPJ(s)
+	if err != nil {
+		return "", err
+	}
+	return n[:8], nil
+}
+
+// BranchCode returns the 4 digits after the base of a CNPJ (formatted or not),
+// which identify the venue: 0001 for the headquarters, other numbers for the
+// branches.
+func BranchCode(s string) (string, error) {
+	n, err := ParseCNPJ(s)
+	if err != nil {
+		return "", err
+	}
+	return n[8:12], nil
+}
+
+// IsHeadquarters returns true for a valid CNPJ of a headquarters (matriz).
+func IsHeadquarters(s string) bool {
+	b, err := BranchCode(s)
+	return err == nil && b == "0001"
+}
+
+// IsBranch returns true for a valid CNPJ of a branch (filial).
+func IsBranch(s string) bool {
+	b, err := BranchCode(s)
+	return err == nil && b != "0001"
+}
@@ -0,0 +1,149 @@
+package cnpj
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCNPJ(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected string
+		err      bool
+	}{
+		{"19131243000197", "19131243000197", false},
+		{"19.131.243/0001-97", "19131243000197", false},
+		{" 00.000.000/0001-91 ", "00000000000191", false},
+		{"19131243000198", "", true},
+		{"1913124300019", "", true},
+		{"19.131.243/0001-9x", "", true},
+		{"11111111111111", "", true},
+		{"", "", true},
+	} {
+		got, err := ParseCNPJ(c.value)
+		if c.err {
+			if !errors.Is(err, ErrInvalidCNPJ) {
+				t.Errorf("expected ErrInvalidCNPJ for %q, got %v", c.value, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error parsing %q, got %s", c.value, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected %q to be parsed as %s, got %s", c.value, c.expected, got)
+		}
+	}
+}
+
+func TestFormatCNPJ(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected string
+		err      bool
+	}{
+		{"19131243000197", "19.131.243/0001-97", false},
+		{"00000000000191", "00.000.000/0001-91", false},
+		{"19.131.243/0001-97", "", true},
+		{"191312430001", "", true},
+	} {
+		got, err := FormatCNPJ(c.value)
+		if c.err {
+			if !errors.Is(err, ErrInvalidCNPJ) {
+				t.Errorf("expected ErrInvalidCNPJ for %q, got %v", c.value, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error formatting %q, got %s", c.value, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected %q to be formatted as %s, got %s", c.value, c.expected, got)
+		}
+	}
+}
+
+func TestParseNFeAccessKey(t *testing.T) {
+	for _, c := range []struct {
+		key      string
+		expected string
+		err      bool
+	}{
+		{"35230119131243000197550010000000011123456782", "19131243000197", false},
+		{"3523 0119 1312 4300 0197 5500 1000 0000 0111 2345 6782", "19131243000197", false},
+		{"35230119131243000197550010000000011123456781", "", true},
+		{"35230100000000000000550010000000011123456783", "", true},
+		{"3523011913124300019755001000000001112345678", "", true},
+		{"3523011913124300019755001000000001112345678x", "", true},
+	} {
+		got, err := ParseNFeAccessKey(c.key)
+		if c.err {
+			if !errors.Is(err, ErrInvalidNFeAccessKey) {
+				t.Errorf("expected ErrInvalidNFeAccessKey for %q, got %v", c.key, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error for %q, got %s", c.key, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected cnpj in %q to be %s, got %s", c.key, c.expected, got)
+		}
+	}
+}
+
+func TestBranchHelpers(t *testing.T) {
+	for _, c := range []struct {
+		value  string
+		base   string
+		branch string
+		hq     bool
+		err    bool
+	}{
+		{"19131243000197", "19131243", "0001", true, false},
+		{"33.683.111/0002-80", "33683111", "0002", false, false},
+		{"19131243000198", "", "", false, true},
+	} {
+		b, err := BaseCNPJ(c.value)
+		if c.err != (err != nil) {
+			t.Errorf("expected error for %q to be %t, got %v", c.value, c.err, err)
+		}
+		if b != c.base {
+			t.Errorf("expected base of %q to be %q, got %q", c.value, c.base, b)
+		}
+		br, err := BranchCode(c.value)
+		if c.err != (err != nil) {
+			t.Errorf("expected error for %q to be %t, got %v", c.value, c.err, err)
+		}
+		if br != c.branch {
+			t.Errorf("expected branch code of %q to be %q, got %q", c.value, c.branch, br)
+		}
+		if got := IsHeadquarters(c.value); got != c.hq {
+			t.Errorf("expected IsHeadquarters(%q) to be %t, got %t", c.value, c.hq, got)
+		}
+		if got := IsBranch(c.value); got != (!c.hq && !c.err) {
+			t.Errorf("expected IsBranch(%q) to be %t, got %t", c.value, !c.hq && !c.err, got)
+		}
+	}
+}
+
+func FuzzParseCNPJ(f *testing.F) {
+	for _, s := range []string{"19131243000197", "19.131.243/0001-97", " 00.000.000/0001-91 ", "19131243", "", "11111111111111", "19.131.243/0001-9x", "１９１３１２４３０００１９７", "99999999999999999999999"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := ParseCNPJ(s)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidCNPJ) {
+				t.Errorf("expected ErrInvalidCNPJ for %q, got %s", s, err)
+			}
+			return
+		}
+		if again, err := ParseCNPJ(n); err != nil || again != n {
+			t.Errorf("expected %q (parsed from %q) to be normalized, got %q and %v", n, s, again, err)
+		}
+		if _, err := FormatCNPJ(n); err != nil {
+			t.Errorf("expected %q (parsed from %q) to be formatted, got %s", n, s, err)
+		}
+	})
+}
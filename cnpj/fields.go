@@ -0,0 +1,116 @@
+package cnpj
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrFieldNotFound is returned when a field is missing (or null) in the JSON of
+// a company.
+var ErrFieldNotFound = errors.New("field not found")
+
+// situacaoCadastralAtiva is the situacao_cadastral of active companies.
+const situacaoCadastralAtiva = 2
+
+// field reads the value of a top-level field in the JSON of a company. The
+// JSON is read token by token, stopping at the field, and other values are
+// skipped without being decoded.
+func field(companyJSON, name string) (json.RawMessage, error) {
+	d := json.NewDecoder(strings.NewReader(companyJSON))
+	t, err := d.Token()
+	if err != nil {
+		return nil, fmt.Errorf("error reading company json: %w", err)
+	}
+	if t != json.Delim('{') {
+		return nil, fmt.Errorf("company json should be an object, got %v", t)
+	}
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error reading company json: %w", err)
+		}
+		if k, ok := t.(string); ok && k == name {
+			var v json.RawMessage
+			if err := d.Decode(&v); err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", name, err)
+			}
+			if string(v) == "null" {
+				break
+			}
+			return v, nil
+		}
+		if err := skip(d); err != nil {
+			return nil, fmt.Errorf("error reading company json: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrFieldNotFound, name)
+}
+
+// skip reads the next value of the decoder, including nested objects and
+// arrays, without decoding it.
+func skip(d *json.Decoder) error {
+	var depth int
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// stringField reads a top-level string field in the JSON of a company.
+func stringField(companyJSON, name string) (string, error) {
+	v, err := field(companyJSON, name)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return "", fmt.Errorf("%s should be a string, got %s", name, v)
+	}
+	return s, nil
+}
+
+// IsActive checks whether the situacao_cadastral in the JSON of a company is
+// 02 (ATIVA), reading only this field from the JSON. The status is accepted
+// both as a number (as saved by the transform command) or as a string.
+func IsActive(companyJSON string) (bool, error) {
+	v, err := field(companyJSON, "situacao_cadastral")
+	if err != nil {
+		return false, err
+	}
+	s := strings.Trim(string(v), `"`)
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return false, fmt.Errorf("situacao_cadastral should be a number, got %s", v)
+	}
+	return n == situacaoCadastralAtiva, nil
+}
+
+// GetRazaoSocial returns the razao_social in the JSON of a company, reading
+// only this field from the JSON.
+func GetRazaoSocial(companyJSON string) (string, error) {
+	return stringField(companyJSON, "razao_social")
+}
+
+// GetMunicipality returns the name of the municipality (municipio) in the
+// JSON of a company, reading only this field from the JSON.
+func GetMunicipality(companyJSON string) (string, error) {
+	return stringField(companyJSON, "municipio")
+}
@@ -0,0 +1,60 @@
+package cnpj
+
+import (
+	"errors"
+	"testing"
+)
+
+const testCompanyJSON = `{"cnpj":"19131243000197","qsa":[{"nome_socio":"FERNANDA CAMPAGNUCCI PEREIRA","situacao_cadastral":8}],"razao_social":"OPEN KNOWLEDGE BRASIL","_meta":{"municipio":"RIO DE JANEIRO"},"situacao_cadastral":2,"municipio":"SAO PAULO","email":null}`
+
+func TestIsActive(t *testing.T) {
+	for _, c := range []struct {
+		json     string
+		expected bool
+		err      bool
+	}{
+		{testCompanyJSON, true, false},
+		{`{"situacao_cadastral":8}`, false, false},
+		{`{"situacao_cadastral":"02"}`, true, false},
+		{`{"situacao_cadastral":"ATIVA"}`, false, true},
+		{`{"situacao_cadastral":null}`, false, true},
+		{`{"cnpj":"19131243000197"}`, false, true},
+		{`[{"situacao_cadastral":2}]`, false, true},
+		{`{"qsa":[{"situacao_cadastral":2}`, false, true},
+		{"", false, true},
+	} {
+		got, err := IsActive(c.json)
+		if c.err && err == nil {
+			t.Errorf("expected an error for %s, got nil", c.json)
+		}
+		if !c.err && err != nil {
+			t.Errorf("expected no error for %s, got %s", c.json, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected IsActive to be %t for %s, got %t", c.expected, c.json, got)
+		}
+	}
+}
+
+func TestStringFields(t *testing.T) {
+	if got, err := GetRazaoSocial(testCompanyJSON); err != nil || got != "OPEN KNOWLEDGE BRASIL" {
+		t.Errorf("expected OPEN KNOWLEDGE BRASIL, got %q and %v", got, err)
+	}
+	if got, err := GetMunicipality(testCompanyJSON); err != nil || got != "SAO PAULO" {
+		t.Errorf("expected SAO PAULO, got %q and %v", got, err)
+	}
+	if _, err := GetMunicipality(`{"municipio":null}`); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("expected ErrFieldNotFound for a null municipio, got %v", err)
+	}
+	if _, err := GetRazaoSocial(`{"razao_social":42}`); err == nil {
+		t.Error("expected an error for a razao_social that is not a string, got nil")
+	}
+}
+
+func BenchmarkIsActive(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := IsActive(testCompanyJSON); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
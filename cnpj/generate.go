@@ -0,0 +1,57 @@
+package cnpj
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// maxBranches is the number of branch codes available for a base CNPJ (from
+// 0001 to 9999).
+const maxBranches = 9999
+
+// withCheckDigits appends the two check digits to the 12 first digits of a
+// CNPJ.
+func withCheckDigits(s string) (string, error) {
+	ds, ok := digits(s)
+	if !ok || len(ds) != 12 {
+		return "", fmt.Errorf("%w: %s should have 12 digits to calculate the check digits", ErrInvalidCNPJ, s)
+	}
+	ds = append(ds, checkDigit(ds, firstCheckDigitWeights))
+	ds = append(ds, checkDigit(ds, secondCheckDigitWeights))
+	return s + strconv.Itoa(ds[12]) + strconv.Itoa(ds[13]), nil
+}
+
+// GenerateSequential creates count valid CNPJs (normalized, with 14 digits)
+// for a base CNPJ (the 8 first digits), with sequential branch codes starting
+// from the headquarters (0001). It is meant for test fixtures.
+func GenerateSequential(base string, count int) ([]string, error) {
+	if count < 0 || count > maxBranches {
+		return nil, fmt.Errorf("cannot generate %d cnpjs for a base, it should be between 0 and %d", count, maxBranches)
+	}
+	if _, ok := digits(base); !ok || len(base) != 8 {
+		return nil, fmt.Errorf("%w: base %s should have 8 digits", ErrInvalidCNPJ, base)
+	}
+	r := make([]string, count)
+	for i := range r {
+		n, err := withCheckDigits(fmt.Sprintf("%s%04d", base, i+1))
+		if err != nil {
+			return nil, err
+		}
+		r[i] = n
+	}
+	return r, nil
+}
+
+// GenerateFromBases creates the CNPJ of the headquarters (branch code 0001)
+// of each base CNPJ (the 8 first digits). It is meant for test fixtures.
+func GenerateFromBases(bases []string) ([]string, error) {
+	r := make([]string, len(bases))
+	for i, b := range bases {
+		ns, err := GenerateSequential(b, 1)
+		if err != nil {
+			return nil, err
+		}
+		r[i] = ns[0]
+	}
+	return r, nil
+}
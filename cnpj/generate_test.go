@@ -0,0 +1,60 @@
+package cnpj
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGenerateSequential(t *testing.T) {
+	ns, err := GenerateSequential("19131243", 100)
+	if err != nil {
+		t.Fatalf("expected no error generating cnpjs, got %s", err)
+	}
+	if len(ns) != 100 {
+		t.Fatalf("expected 100 cnpjs, got %d", len(ns))
+	}
+	for i, n := range ns {
+		if _, err := ParseCNPJ(n); err != nil {
+			t.Errorf("expected generated cnpj %s to be valid, got %s", n, err)
+		}
+		if b := fmt.Sprintf("19131243%04d", i+1); n[:12] != b {
+			t.Errorf("expected cnpj %d to start with %s, got %s", i, b, n)
+		}
+	}
+	if ns[0] != "19131243000197" {
+		t.Errorf("expected the headquarters first, got %s", ns[0])
+	}
+	if ns, err := GenerateSequential("19131243", 9999); err != nil || ns[9998][8:12] != "9999" {
+		t.Errorf("expected the last branch to be 9999, got %v", err)
+	}
+	for _, c := range []struct {
+		base  string
+		count int
+	}{
+		{"19131243", 10000},
+		{"19131243", -1},
+		{"1913124", 1},
+		{"1913124x", 1},
+	} {
+		if _, err := GenerateSequential(c.base, c.count); err == nil {
+			t.Errorf("expected an error generating %d cnpjs for %q, got nil", c.count, c.base)
+		}
+	}
+}
+
+func TestGenerateFromBases(t *testing.T) {
+	ns, err := GenerateFromBases([]string{"19131243", "00000000", "33683111"})
+	if err != nil {
+		t.Fatalf("expected no error generating cnpjs, got %s", err)
+	}
+	expected := []string{"19131243000197", "00000000000191", "33683111000107"}
+	for i := range expected {
+		if ns[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], ns[i])
+		}
+	}
+	if _, err := GenerateFromBases([]string{"19131243", "42"}); !errors.Is(err, ErrInvalidCNPJ) {
+		t.Errorf("expected ErrInvalidCNPJ for an invalid base, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package cnpj
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCheckDigitValidation documents precisely which numbers ParseCNPJ accepts
+// as valid CNPJs: check digits are calculated with modulo 11 (remainders 0 and
+// 1 both map to the check digit 0), and numbers with all digits equal are
+// rejected even when their check digits are correct (e.g. 00000000000000).
+func TestCheckDigitValidation(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		// real companies
+		{"serpro branch", "33683111000280", true},
+		{"open knowledge brasil", "19131243000197", true},
+		{"banco do brasil", "00000000000191", true},
+		{"petrobras", "33000167000101", true},
+		{"bradesco", "60746948000112", true},
+		{"caixa", "00360305000104", true},
+		{"vale", "33592510000154", true},
+		{"jbs", "02916265000160", true},
+		{"itaú unibanco", "60701190000104", true},
+		{"usp", "63025530000104", true},
+		{"formatted", "33.683.111/0002-80", true},
+		{"formatted with leading zeros", "00.360.305/0001-04", true},
+
+		// leading zeros
+		{"leading zeros", "00623904000173", true},
+		{"leading zeros with wrong first check digit", "00623904000183", false},
+		{"leading zeros with wrong second check digit", "00623904000174", false},
+		{"only the check digits and branch", "00000000000191", true},
+
+		// remainder 0 or 1 maps to check digit 0
+		{"first remainder 0", "10000008000101", true},
+		{"first remainder 1", "10000017000100", true},
+		{"second remainder 0", "10000010000180", true},
+		{"second remainder 1", "10000001000190", true},
+		{"both remainders 0", "10000054000100", true},
+		{"both remainders 1", "10000063000100", true},
+		{"first remainder 0 and second remainder 1", "10000181000100", true},
+		{"first remainder 1 and second remainder 0", "10000017000100", true},
+		{"first remainder 0 as check digit 1", "10000008000111", false},
+		{"second remainder 0 as check digit 1", "10000010000181", false},
+		{"first remainder 1 as check digit 10", "1000001700010", false},
+		{"remainder 10 maps to check digit 1", "10000045000110", true},
+		{"remainder 2 maps to check digit 9", "10000001000190", true},
+
+		// invalid check digits
+		{"wrong first check digit", "33683111000290", false},
+		{"wrong second check digit", "33683111000281", false},
+		{"wrong both check digits", "33683111000299", false},
+		{"swapped check digits", "33683111000208", false},
+		{"swapped digits in the base", "36383111000280", false},
+		{"wrong branch", "33683111000180", false},
+		{"formatted with wrong check digit", "33.683.111/0002-81", false},
+
+		// all digits equal
+		{"all zeros", "00000000000000", false},
+		{"all ones", "11111111111111", false},
+		{"all twos", "22222222222222", false},
+		{"all threes", "33333333333333", false},
+		{"all fours", "44444444444444", false},
+		{"all fives", "55555555555555", false},
+		{"all sixes", "66666666666666", false},
+		{"all sevens", "77777777777777", false},
+		{"all eights", "88888888888888", false},
+		{"all nines (maximum cnpj)", "99999999999999", false},
+		{"all zeros formatted", "00.000.000/0000-00", false},
+
+		// malformed
+		{"empty", "", false},
+		{"too short", "3368311100028", false},
+		{"too long", "336831110002800", false},
+		{"letters", "3368311100028a", false},
+		{"negative", "-3683111000280", false},
+		{"unicode digits", "３3683111000280", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseCNPJ(c.value)
+			if c.valid && err != nil {
+				t.Errorf("expected %q to be valid, got %s", c.value, err)
+			}
+			if !c.valid && !errors.Is(err, ErrInvalidCNPJ) {
+				t.Errorf("expected ErrInvalidCNPJ for %q, got %v", c.value, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidTopN is returned when the number of values requested for an
+// analytical query is not positive.
+var ErrInvalidTopN = errors.New("top n should be greater than zero")
+
+// AnalyticsFields are the fields of the company JSON that can be used in
+// `CountByField`. They have few distinct values and most of them are covered
+// by the indexes created in `CreateJSONBIndexes`.
+var AnalyticsFields = []string{
+	"uf",
+	"codigo_municipio",
+	"cnae_fiscal",
+	"codigo_natureza_juridica",
+	"situacao_cadastral",
+	"codigo_porte",
+}
+
+// FieldCount is the number of companies with a given value in a field.
+type FieldCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// CountByField returns the topN most common values of a field of the company
+// JSON (one of `AnalyticsFields`) and the number of companies with each of
+// them, sorted by count in descending order. Companies without the field are
+// counted with an empty value. It returns `ErrUnknownField` for fields not in
+// `AnalyticsFields`.
+func (p *PostgreSQL) CountByField(ctx context.Context, field string, topN int) ([]FieldCount, error) {
+	var ok bool
+	for _, f := range AnalyticsFields {
+		if f == field {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownField, field)
+	}
+	if topN < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidTopN, topN)
+	}
+	rows, err := p.pool.Query(ctx, p.sql["count_by_field"], field, topN)
+	if err != nil {
+		return nil, fmt.Errorf("error counting companies by %s: %w", field, err)
+	}
+	r, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (FieldCount, error) {
+		var c FieldCount
+		var v *string
+		if err := row.Scan(&v, &c.Count); err != nil {
+			return c, err
+		}
+		if v != nil {
+			c.Value = *v
+		}
+		return c, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading the count of companies by %s: %w", field, err)
+	}
+	return r, nil
+}
+
+// CountCompaniesWithStatus returns the number of companies with a status
+// (situacao_cadastral, e.g. 2 for active), which is useful to compare an
+// import with the official statistics of the Federal Revenue.
+func (p *PostgreSQL) CountCompaniesWithStatus(ctx context.Context, status string) (int64, error) {
+	var n int64
+	if err := p.pool.QueryRow(ctx, p.sql["count_with_status"], status).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting companies with status %s: %w", status, err)
+	}
+	return n, nil
+}
+
+// StatusDistribution returns the number of companies with each status
+// (situacao_cadastral), in a single query. Companies without a status are
+// counted with an empty key.
+func (p *PostgreSQL) StatusDistribution(ctx context.Context) (map[string]int64, error) {
+	rows, err := p.pool.Query(ctx, p.sql["status_distribution"])
+	if err != nil {
+		return nil, fmt.Errorf("error counting companies by status: %w", err)
+	}
+	defer rows.Close()
+	m := make(map[string]int64)
+	for rows.Next() {
+		var s string
+		var n int64
+		if err := rows.Scan(&s, &n); err != nil {
+			return nil, fmt.Errorf("error reading the count of companies by status: %w", err)
+		}
+		m[s] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the count of companies by status: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrDatabaseBusy is returned when `MaxConcurrentQueries` queries are already
+// running, instead of waiting for one of them to finish.
+var ErrDatabaseBusy = errors.New("database is busy")
+
+// querySlots is a semaphore limiting the concurrent queries looking for
+// companies. The channel is created on the first use, since the size comes
+// from `MaxConcurrentQueries`, which is set after creating `PostgreSQL`.
+type querySlots struct {
+	once  sync.Once
+	slots chan struct{}
+}
+
+// acquire returns false if all the slots are taken.
+func (q *querySlots) acquire(n int) bool {
+	if q == nil || n <= 0 {
+		return true
+	}
+	q.once.Do(func() { q.slots = make(chan struct{}, n) })
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *querySlots) release(n int) {
+	if q == nil || n <= 0 {
+		return
+	}
+	<-q.slots
+}
+
+func (q *querySlots) current() int {
+	if q == nil {
+		return 0
+	}
+	return len(q.slots)
+}
+
+// CurrentConcurrentQueries returns how many queries looking for companies are
+// running (only counted when `MaxConcurrentQueries` is set).
+func (p *PostgreSQL) CurrentConcurrentQueries() int {
+	return p.queries.current()
+}
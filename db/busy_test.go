@@ -0,0 +1,27 @@
+package db
+
+import "testing"
+
+func TestQuerySlots(t *testing.T) {
+	q := &querySlots{}
+	if !q.acquire(2) || !q.acquire(2) {
+		t.Fatal("expected to acquire 2 slots")
+	}
+	if q.acquire(2) {
+		t.Error("expected not to acquire a third slot")
+	}
+	if got := q.current(); got != 2 {
+		t.Errorf("expected 2 current queries, got %d", got)
+	}
+	q.release(2)
+	if !q.acquire(2) {
+		t.Error("expected to acquire a slot after releasing one")
+	}
+	if !q.acquire(0) {
+		t.Error("expected no limit with 0")
+	}
+	var n *querySlots
+	if !n.acquire(1) || n.current() != 0 {
+		t.Error("expected nil slots to have no limit")
+	}
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cuducos/minha-receita/cnpj"
+)
+
+// how many companies are read at the same time by `WarmCache`
+const warmCacheConcurrency = 8
+
+// ErrNoCache is returned when warming up a `PostgreSQL` without a `Cache`.
+var ErrNoCache = errors.New("no cache configured")
+
+// CacheStatistics describes how effective a cache is.
+type CacheStatistics struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`
+	CurrentSize int64 `json:"current_size"`
+}
+
+// Cache stores the JSON of companies by CNPJ, in front of the database.
+type Cache interface {
+	Get(string) (string, bool)
+	Set(string, string)
+	CacheStats() CacheStatistics
+	ResetCacheStats()
+}
+
+// NopCache is a cache that never stores anything.
+type NopCache struct{}
+
+func (NopCache) Get(string) (string, bool)   { return "", false }
+func (NopCache) Set(string, string)          {}
+func (NopCache) CacheStats() CacheStatistics { return CacheStatistics{} }
+func (NopCache) ResetCacheStats()            {}
+
+type memoryCacheItem struct {
+	key   string
+	value string
+}
+
+// MemoryCache is an in-memory cache that keeps up to a maximum number of
+// companies, evicting the least recently used ones. It is safe for concurrent
+// use.
+type MemoryCache struct {
+	maxItems int
+	mutex    sync.Mutex
+	items    map[string]*list.Element
+	order    *list.List // front is the most recently used
+	stats    CacheStatistics
+}
+
+// NewMemoryCache creates a `MemoryCache` keeping up to maxItems companies.
+func NewMemoryCache(maxItems int) *MemoryCache {
+	return &MemoryCache{
+		maxItems: maxItems,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns a company from the cache.
+func (c *MemoryCache) Get(k string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.items[k]
+	if !ok {
+		c.stats.Misses++
+		return "", false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(e)
+	return e.Value.(*memoryCacheItem).value, true
+}
+
+// Set saves a company to the cache, evicting the least recently used one if
+// the cache is full.
+func (c *MemoryCache) Set(k, v string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.items[k]; ok {
+		e.Value.(*memoryCacheItem).value = v
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[k] = c.order.PushFront(&memoryCacheItem{k, v})
+	for c.order.Len() > c.maxItems {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*memoryCacheItem).key)
+		c.stats.Evictions++
+	}
+}
+
+// CacheStats returns the hits, misses and evictions since the cache was
+// created (or since the last `ResetCacheStats`), and the current number of
+// companies in the cache.
+func (c *MemoryCache) CacheStats() CacheStatistics {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	s := c.stats
+	s.CurrentSize = int64(c.order.Len())
+	return s
+}
+
+// ResetCacheStats sets hits, misses and evictions back to zero.
+func (c *MemoryCache) ResetCacheStats() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stats = CacheStatistics{}
+}
+
+type cacheResultKey struct{}
+
+// CacheResult records whether the companies read by `GetCompany` and
+// `GetCompanyRaw`, with a context from `WithCacheResult`, came from the
+// `Cache`, e.g. to tell cache hits in the access logs.
+type CacheResult struct {
+	hits, misses atomic.Int64
+}
+
+// WithCacheResult returns a context in which the cache hits and misses of
+// reading companies are recorded in the returned `CacheResult`.
+func WithCacheResult(ctx context.Context) (context.Context, *CacheResult) {
+	var c CacheResult
+	return context.WithValue(ctx, cacheResultKey{}, &c), &c
+}
+
+// String returns HIT if all companies came from the cache, MISS if any of them
+// did not, or an empty string if the cache was not used (e.g. no `Cache`).
+func (c *CacheResult) String() string {
+	switch {
+	case c.misses.Load() > 0:
+		return "MISS"
+	case c.hits.Load() > 0:
+		return "HIT"
+	}
+	return ""
+}
+
+func recordCacheResult(ctx context.Context, hit bool) {
+	c, ok := ctx.Value(cacheResultKey{}).(*CacheResult)
+	if !ok {
+		return
+	}
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// WarmCache reads companies from the database so they are saved to the
+// `Cache`, avoiding all requests hitting the database after a cold start.
+// Companies that cannot be read (e.g. not found) are ignored.
+func (p *PostgreSQL) WarmCache(ctx context.Context, cnpjs []string) error {
+	if p.Cache == nil {
+		return ErrNoCache
+	}
+	var wg sync.WaitGroup
+	var errs int64
+	sem := make(chan struct{}, warmCacheConcurrency)
+	for _, n := range cnpjs {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(n string) {
+			defer func() { <-sem; wg.Done() }()
+			if _, err := p.GetCompany(ctx, n); err != nil {
+				atomic.AddInt64(&errs, 1)
+			}
+		}(n)
+	}
+	wg.Wait()
+	if errs > 0 {
+		p.log().WarnContext(ctx, "Could not warm up the cache with some companies", "table", p.CompanyTableFullName(), "errors", errs, "companies", len(cnpjs))
+	}
+	return ctx.Err()
+}
+
+// WarmCacheFromFile works as `WarmCache` reading the CNPJs from a file with
+// one CNPJ (formatted or not) per line. Invalid CNPJs are skipped.
+func (p *PostgreSQL) WarmCacheFromFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+	var ns []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
+		}
+		n, err := cnpj.ParseCNPJ(l)
+		if err != nil {
+			p.log().WarnContext(ctx, "Skipping invalid cnpj", "file", path, "error", err)
+			continue
+		}
+		ns = append(ns, n)
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return p.WarmCache(ctx, ns)
+}
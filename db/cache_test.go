@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(2)
+	if _, ok := c.Get("1"); ok {
+		t.Error("expected a miss in an empty cache")
+	}
+	c.Set("1", "one")
+	c.Set("2", "two")
+	if v, ok := c.Get("1"); !ok || v != "one" {
+		t.Errorf("expected a hit with one, got %s and %t", v, ok)
+	}
+	c.Set("3", "three") // evicts 2, the least recently used
+	if _, ok := c.Get("2"); ok {
+		t.Error("expected 2 to be evicted")
+	}
+	expected := CacheStatistics{Hits: 1, Misses: 2, Evictions: 1, CurrentSize: 2}
+	if got := c.CacheStats(); got != expected {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	c.ResetCacheStats()
+	expected = CacheStatistics{CurrentSize: 2}
+	if got := c.CacheStats(); got != expected {
+		t.Errorf("expected %+v after reset, got %+v", expected, got)
+	}
+}
+
+func TestNopCache(t *testing.T) {
+	var c NopCache
+	c.Set("1", "one")
+	if _, ok := c.Get("1"); ok {
+		t.Error("expected NopCache to never hit")
+	}
+	if got := c.CacheStats(); got != (CacheStatistics{}) {
+		t.Errorf("expected zeroed stats, got %+v", got)
+	}
+}
+
+func TestCacheResult(t *testing.T) {
+	c := NewMemoryCache(1)
+	c.Set("33683111000280", "{}")
+	p := PostgreSQL{Cache: c}
+	ctx, r := WithCacheResult(context.Background())
+	if got := r.String(); got != "" {
+		t.Errorf("expected no cache result before reading companies, got %s", got)
+	}
+	if _, err := p.GetCompany(ctx, "33683111000280"); err != nil {
+		t.Errorf("expected no error getting a cached company, got %s", err)
+	}
+	if _, err := p.GetCompanyRaw(ctx, "33683111000280"); err != nil {
+		t.Errorf("expected no error getting a cached company, got %s", err)
+	}
+	if got := r.String(); got != "HIT" {
+		t.Errorf("expected HIT, got %s", got)
+	}
+	recordCacheResult(ctx, false)
+	if got := r.String(); got != "MISS" {
+		t.Errorf("expected MISS after a miss, got %s", got)
+	}
+	recordCacheResult(context.Background(), true) // no CacheResult in the context
+}
+
+func TestWarmCacheWithoutCache(t *testing.T) {
+	var p PostgreSQL
+	if err := p.WarmCache(context.Background(), []string{"33683111000280"}); !errors.Is(err, ErrNoCache) {
+		t.Errorf("expected ErrNoCache, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const checkpointKey = "checkpoint"
+
+// CreateCompaniesWithCheckpoint is like `CreateCompanies`, but it also saves
+// the checkpoint of the import (the source files fully saved to the database)
+// to the metadata table, within the same transaction as the batch. If the
+// batch fails, the checkpoint is not updated, and vice-versa (failed batches
+// go to the dead-letter file in the same way as in `CreateCompanies`).
+func (p *PostgreSQL) CreateCompaniesWithCheckpoint(batch [][]any, files []string) error {
+	n := p.batches.Add(1)
+	defer p.acquireImportSlot()()
+	b, err := json.Marshal(files)
+	if err != nil {
+		return fmt.Errorf("error serializing checkpoint: %w", err)
+	}
+	ctx, cancel := withTimeout(context.Background(), p.Timeouts.ImportBatch)
+	defer cancel()
+	if err := p.createCompaniesWithCheckpoint(ctx, batch, string(b)); err != nil {
+		return p.deadLetter(batch, fmt.Errorf("error saving batch %d: %w", n, err))
+	}
+	p.report.success(batch)
+	return nil
+}
+
+func (p *PostgreSQL) createCompaniesWithCheckpoint(ctx context.Context, batch [][]any, checkpoint string) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := p.copyCompanies(ctx, tx, batch); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, p.sql["meta_save"], checkpointKey, checkpoint); err != nil {
+		return fmt.Errorf("error saving checkpoint: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing batch and checkpoint: %w", err)
+	}
+	if p.CreateOptions.VerifyBatch {
+		return p.verifyBatch(ctx, batch)
+	}
+	return nil
+}
+
+// Checkpoint returns the source files fully saved to the database by an
+// import that has not finished (see `CreateCompaniesWithCheckpoint`), or an
+// empty slice if there is no checkpoint.
+func (p *PostgreSQL) Checkpoint(ctx context.Context) ([]string, error) {
+	rows, err := p.pool.Query(ctx, p.sql["meta_read"], checkpointKey)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for the checkpoint: %w", err)
+	}
+	v, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the checkpoint: %w", err)
+	}
+	var fs []string
+	if err := json.Unmarshal([]byte(v), &fs); err != nil {
+		return nil, fmt.Errorf("error parsing the checkpoint: %w", err)
+	}
+	return fs, nil
+}
+
+// ClearCheckpoint removes the checkpoint from the metadata table, e.g. once an
+// import finishes successfully.
+func (p *PostgreSQL) ClearCheckpoint(ctx context.Context) error {
+	if _, err := p.pool.Exec(ctx, p.sql["meta_delete"], checkpointKey); err != nil {
+		return fmt.Errorf("error clearing the checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// how often, in rows, `CloneSchema` reports its progress
+const cloneProgressInterval = 100_000
+
+// CloneOptions configures `CloneSchema`. Progress is called with the number of
+// companies copied so far every 100k rows; if nil, the progress is logged.
+type CloneOptions struct {
+	Progress func(int64)
+}
+
+// progressSource wraps a `cursorSource` calling a function every
+// `cloneProgressInterval` rows.
+type progressSource struct {
+	*cursorSource
+	progress func(int64)
+}
+
+func (s *progressSource) Next() bool {
+	ok := s.cursorSource.Next()
+	if ok && s.count%cloneProgressInterval == 0 {
+		s.progress(s.count)
+	}
+	return ok
+}
+
+// CloneSchema copies the companies, metadata, history and partners tables
+// (structure, indexes and data) from one schema to a new one, e.g. to import to a new
+// schema while the web API reads from the current one. The source schema is
+// protected by the import lock while cloning (except in `PgBouncerCompatible`
+// mode). If cloning fails, the destination schema might be left with partial
+// data.
+func (p *PostgreSQL) CloneSchema(ctx context.Context, srcSchema, dstSchema string) error {
+	for _, s := range []string{srcSchema, dstSchema} {
+		if err := validateSchemaName(s); err != nil {
+			return err
+		}
+	}
+	if srcSchema == dstSchema {
+		return fmt.Errorf("cannot clone schema %s to itself", srcSchema)
+	}
+	if !p.pgBouncer {
+		c, err := p.pool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("error acquiring a database connection: %w", err)
+		}
+		k := fmt.Sprintf("hashtext('%s.%s')", srcSchema, p.CompanyTableName)
+		var ok bool
+		if err := c.QueryRow(ctx, fmt.Sprintf("SELECT pg_try_advisory_lock(%s)", k)).Scan(&ok); err != nil {
+			c.Release()
+			return fmt.Errorf("error acquiring the import lock of schema %s: %w", srcSchema, err)
+		}
+		if !ok {
+			c.Release()
+			return fmt.Errorf("%w in schema %s", ErrImportInProgress, srcSchema)
+		}
+		l := ImportLock{c, fmt.Sprintf("SELECT pg_advisory_unlock(%s)", k)}
+		defer l.Release(ctx)
+	}
+
+	src := func(t string) string { return pgx.Identifier{srcSchema, t}.Sanitize() }
+	dst := func(t string) string { return pgx.Identifier{dstSchema, t}.Sanitize() }
+	for _, q := range []string{
+		fmt.Sprintf("CREATE SCHEMA %s", pgx.Identifier{dstSchema}.Sanitize()),
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", dst(p.CompanyTableName), src(p.CompanyTableName)),
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", dst(p.MetaTableName), src(p.MetaTableName)),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", dst(p.MetaTableName), src(p.MetaTableName)),
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", dst(p.HistoryTableName), src(p.HistoryTableName)),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", dst(p.HistoryTableName), src(p.HistoryTableName)),
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", dst(p.PartnersTableName), src(p.PartnersTableName)),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", dst(p.PartnersTableName), src(p.PartnersTableName)),
+	} {
+		if _, err := p.pool.Exec(ctx, q); err != nil {
+			return fmt.Errorf("error cloning schema %s to %s with: %s\n%w", srcSchema, dstSchema, q, err)
+		}
+	}
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	q := fmt.Sprintf("DECLARE clone_companies NO SCROLL CURSOR FOR SELECT %s, %s FROM %s", idFieldName, jsonFieldName, src(p.CompanyTableName))
+	if _, err := tx.Exec(ctx, q); err != nil {
+		return fmt.Errorf("error declaring cursor with: %s\n%w", q, err)
+	}
+	fn := p.CloneOptions.Progress
+	if fn == nil {
+		fn = func(n int64) { p.log().InfoContext(ctx, "Companies cloned", "schema", dstSchema, "companies", n) }
+	}
+	s := progressSource{&cursorSource{name: "clone_companies", ctx: ctx, tx: tx}, fn}
+	n, err := p.pool.CopyFrom(
+		ctx,
+		pgx.Identifier{dstSchema, p.CompanyTableName},
+		[]string{idFieldName, jsonFieldName},
+		&s,
+	)
+	if err != nil {
+		return fmt.Errorf("error cloning companies to %s: %w", dstSchema, err)
+	}
+	p.log().InfoContext(ctx, "Schema cloned", "source", srcSchema, "schema", dstSchema, "companies", n)
+	return nil
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// how many rows are read and written at once by `CompressExistingRows`
+const compressBatchSize = 8192
+
+// ErrCompressedJSON is returned by the methods merging data into the JSON of
+// existing companies (e.g. `UpsertCompanies`, `UpdateCompaniesFromReader` and
+// `AddPartners`), which do not work with compressed JSON (see `CompressJSON`):
+// they are refused while `CompressJSON` is set, and compressed rows found in
+// the database are left untouched.
+var ErrCompressedJSON = errors.New("incremental updates do not work with compressed json")
+
+// errCompressedRows is the error for n companies left untouched because their
+// JSON is compressed.
+func errCompressedRows(n int64) error {
+	return fmt.Errorf("%w: %d companies with compressed json were not changed", ErrCompressedJSON, n)
+}
+
+// zstdMagic is the beginning of every zstd frame, used to tell compressed from
+// plain rows.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compressJSON compresses a JSON with zstd. The column type is JSONB, which
+// only takes valid JSON, so the compressed bytes (starting with `zstdMagic`)
+// cannot be stored as they are: they are stored as a base64 encoded JSON
+// string instead.
+func compressJSON(s string) (string, error) {
+	b, err := json.Marshal(zstdEncoder.EncodeAll([]byte(s), nil))
+	if err != nil {
+		return "", fmt.Errorf("error serializing compressed json: %w", err)
+	}
+	return string(b), nil
+}
+
+// decompressJSON returns the original JSON if s was created by
+// `compressJSON`, or s itself otherwise.
+func decompressJSON(s string) (string, error) {
+	if len(s) == 0 || s[0] != '"' {
+		return s, nil
+	}
+	var v string
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || !bytes.HasPrefix(b, zstdMagic) {
+		return s, nil
+	}
+	d, err := zstdDecoder.DecodeAll(b, nil)
+	if err != nil {
+		return "", fmt.Errorf("error decompressing json: %w", err)
+	}
+	return string(d), nil
+}
+
+// compressBatch returns a copy of the batch with the JSON values compressed.
+func compressBatch(batch [][]any) ([][]any, error) {
+	c := make([][]any, len(batch))
+	for i, r := range batch {
+		c[i] = make([]any, len(r))
+		copy(c[i], r)
+		s, ok := r[1].(string)
+		if !ok {
+			continue
+		}
+		v, err := compressJSON(s)
+		if err != nil {
+			return nil, err
+		}
+		c[i][1] = v
+	}
+	return c, nil
+}
+
+// CompressExistingRows compresses the JSON of rows written before
+// `CompressJSON` was enabled. It is meant to run once, after the index is
+// created, and returns the number of rows compressed.
+func (p *PostgreSQL) CompressExistingRows(ctx context.Context) (int64, error) {
+	var last, total int64
+	for {
+		rows, err := p.pool.Query(ctx, p.sql["uncompressed_rows"], last, compressBatchSize)
+		if err != nil {
+			return total, fmt.Errorf("error looking for uncompressed rows: %w", err)
+		}
+		var ids []int64
+		var js []string
+		for rows.Next() {
+			var n int64
+			var j string
+			if err := rows.Scan(&n, &j); err != nil {
+				rows.Close()
+				return total, fmt.Errorf("error reading uncompressed row: %w", err)
+			}
+			c, err := compressJSON(j)
+			if err != nil {
+				rows.Close()
+				return total, fmt.Errorf("error compressing cnpj %d: %w", n, err)
+			}
+			ids = append(ids, n)
+			js = append(js, c)
+		}
+		if err := rows.Err(); err != nil {
+			return total, fmt.Errorf("error reading uncompressed rows: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+		r, err := p.pool.Exec(ctx, p.sql["update_json"], ids, js)
+		if err != nil {
+			return total, fmt.Errorf("error saving compressed rows: %w", err)
+		}
+		total += r.RowsAffected()
+		last = ids[len(ids)-1]
+		p.log().InfoContext(ctx, "Compressed rows", "table", p.CompanyTableFullName(), "rows", total)
+	}
+	return total, nil
+}
+
+// Compression methods for the JSONB columns, see
+// `PostgreSQLConfig.JSONBCompression`.
+const (
+	JSONBCompressionDefault = "default"
+	JSONBCompressionPGLZ    = "pglz"
+	JSONBCompressionLZ4     = "lz4"
+)
+
+// PostgreSQL 14 added the COMPRESSION clause and LZ4 compression.
+const minJSONBCompressionVersionNum = 140000
+
+func validateJSONBCompression(c string) error {
+	switch c {
+	case "", JSONBCompressionDefault, JSONBCompressionPGLZ, JSONBCompressionLZ4:
+		return nil
+	}
+	return fmt.Errorf("invalid jsonb compression %s, use %s, %s or %s", c, JSONBCompressionPGLZ, JSONBCompressionLZ4, JSONBCompressionDefault)
+}
+
+// checkJSONBCompression falls back to pglz when LZ4 is not supported by the
+// PostgreSQL server.
+func (p *PostgreSQL) checkJSONBCompression(ctx context.Context) {
+	if p.JSONBCompression == JSONBCompressionLZ4 && p.serverVersionNum < minJSONBCompressionVersionNum {
+		p.log().WarnContext(ctx, "LZ4 compression requires PostgreSQL 14 or newer, using pglz", "version_num", p.serverVersionNum)
+		p.JSONBCompression = JSONBCompressionPGLZ
+	}
+}
+
+// JSONBCompressionClause is the COMPRESSION clause used for the JSONB columns
+// in `CreateTable`, or an empty string if the server uses its default (pglz,
+// unless default_toast_compression is set) or does not support the clause.
+func (p *PostgreSQL) JSONBCompressionClause() string {
+	if p.serverVersionNum < minJSONBCompressionVersionNum {
+		return ""
+	}
+	switch p.JSONBCompression {
+	case JSONBCompressionPGLZ, JSONBCompressionLZ4:
+		return "COMPRESSION " + p.JSONBCompression
+	}
+	return ""
+}
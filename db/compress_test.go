@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompressJSON(t *testing.T) {
+	j := `{"cnpj": "33683111000280", "qsa": [{"nome_socio": "FORTY-TWO"}], "answer": 42}`
+	c, err := compressJSON(j)
+	if err != nil {
+		t.Fatalf("expected no error compressing json, got %s", err)
+	}
+	if !json.Valid([]byte(c)) {
+		t.Errorf("expected compressed json to be valid json, got %s", c)
+	}
+	var v string
+	if err := json.Unmarshal([]byte(c), &v); err != nil {
+		t.Fatalf("expected compressed json to be a string, got %s", err)
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		t.Fatalf("expected compressed json to be base64 encoded, got %s", err)
+	}
+	if !strings.HasPrefix(string(b), string(zstdMagic)) {
+		t.Errorf("expected compressed json to start with the zstd magic number, got %x", b[:4])
+	}
+	got, err := decompressJSON(c)
+	if err != nil {
+		t.Fatalf("expected no error decompressing json, got %s", err)
+	}
+	if got != j {
+		t.Errorf("expected %s, got %s", j, got)
+	}
+}
+
+func TestIncrementalUpdatesWithCompressJSON(t *testing.T) {
+	p := PostgreSQL{CompressJSON: true}
+	ctx := context.Background()
+	if _, _, err := p.UpsertCompanies(ctx, [][]string{{"33683111000280", "{}"}}); !errors.Is(err, ErrCompressedJSON) {
+		t.Errorf("expected ErrCompressedJSON upserting companies, got %v", err)
+	}
+	if _, err := p.UpdateCompaniesFromReader(ctx, strings.NewReader(`{"cnpj_basico": "33683111", "data": {"answer": 42}}`)); !errors.Is(err, ErrCompressedJSON) {
+		t.Errorf("expected ErrCompressedJSON updating companies, got %v", err)
+	}
+	if _, err := p.AddPartners(ctx, [][]string{{"33683111", "[]"}}); !errors.Is(err, ErrCompressedJSON) {
+		t.Errorf("expected ErrCompressedJSON adding partners, got %v", err)
+	}
+	if err := p.ReplacePartners(ctx, "33683111", "[]"); !errors.Is(err, ErrCompressedJSON) {
+		t.Errorf("expected ErrCompressedJSON replacing partners, got %v", err)
+	}
+}
+
+func TestDecompressJSONPlain(t *testing.T) {
+	for _, j := range []string{`{"answer": 42}`, `"forty-two"`, `"KLUv/Q=="`, ""} {
+		got, err := decompressJSON(j)
+		if j == `"KLUv/Q=="` {
+			if err == nil {
+				t.Errorf("expected an error decompressing a truncated frame, got %s", got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error with plain json %s, got %s", j, err)
+		}
+		if got != j {
+			t.Errorf("expected plain json %s to be returned as is, got %s", j, got)
+		}
+	}
+}
+
+func TestCompressBatch(t *testing.T) {
+	b := [][]any{{33683111000280, `{"answer": 42}`}}
+	c, err := compressBatch(b)
+	if err != nil {
+		t.Fatalf("expected no error compressing batch, got %s", err)
+	}
+	if b[0][1] != `{"answer": 42}` {
+		t.Errorf("expected original batch to be unchanged, got %v", b[0][1])
+	}
+	if c[0][0] != 33683111000280 || c[0][1] == b[0][1] {
+		t.Errorf("expected same id and compressed json, got %v", c[0])
+	}
+}
+
+func TestJSONBCompressionClause(t *testing.T) {
+	for _, c := range []struct {
+		compression string
+		versionNum  int
+		expected    string
+	}{
+		{"", 160000, ""},
+		{JSONBCompressionDefault, 160000, ""},
+		{JSONBCompressionPGLZ, 160000, "COMPRESSION pglz"},
+		{JSONBCompressionLZ4, 140000, "COMPRESSION lz4"},
+		{JSONBCompressionLZ4, 130000, ""},
+		{JSONBCompressionPGLZ, 120000, ""},
+	} {
+		p := PostgreSQL{JSONBCompression: c.compression, serverVersionNum: c.versionNum}
+		if got := p.JSONBCompressionClause(); got != c.expected {
+			t.Errorf("expected %q for %s on %d, got %q", c.expected, c.compression, c.versionNum, got)
+		}
+	}
+}
+
+func TestCheckJSONBCompression(t *testing.T) {
+	p := PostgreSQL{JSONBCompression: JSONBCompressionLZ4, serverVersionNum: 130000}
+	p.checkJSONBCompression(context.Background())
+	if p.JSONBCompression != JSONBCompressionPGLZ {
+		t.Errorf("expected lz4 to fall back to pglz on postgres 13, got %s", p.JSONBCompression)
+	}
+	p = PostgreSQL{JSONBCompression: JSONBCompressionLZ4, serverVersionNum: 140000}
+	p.checkJSONBCompression(context.Background())
+	if p.JSONBCompression != JSONBCompressionLZ4 {
+		t.Errorf("expected lz4 on postgres 14, got %s", p.JSONBCompression)
+	}
+}
+
+func TestValidateJSONBCompression(t *testing.T) {
+	for _, c := range []string{"", "default", "pglz", "lz4"} {
+		if err := validateJSONBCompression(c); err != nil {
+			t.Errorf("expected no error for %q, got %s", c, err)
+		}
+	}
+	if err := validateJSONBCompression("zstd"); err == nil {
+		t.Error("expected an error for zstd, got nil")
+	}
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// how many rows are fetched at once from the server-side cursor
+const copyFetchSize = 8192
+
+// CopyOptions configures `CopyCompaniesTo`. With DryRun, rows are read and
+// counted, but not written to the destination.
+type CopyOptions struct {
+	DryRun bool
+}
+
+// cursorSource implements pgx.CopyFromSource reading companies from a
+// server-side cursor, fetching `copyFetchSize` rows at a time.
+type cursorSource struct {
+	name    string // name of the cursor
+	ctx     context.Context
+	tx      pgx.Tx
+	rows    pgx.Rows
+	fetched int
+	row     []any
+	count   int64
+	err     error
+}
+
+func (s *cursorSource) fetch() bool {
+	var err error
+	s.rows, err = s.tx.Query(s.ctx, fmt.Sprintf("FETCH %d FROM %s", copyFetchSize, s.name))
+	if err != nil {
+		s.err = fmt.Errorf("error fetching companies from cursor: %w", err)
+		return false
+	}
+	s.fetched = 0
+	return true
+}
+
+func (s *cursorSource) Next() bool {
+	if s.rows == nil && !s.fetch() {
+		return false
+	}
+	for !s.rows.Next() {
+		s.rows.Close()
+		if err := s.rows.Err(); err != nil {
+			s.err = fmt.Errorf("error reading companies from cursor: %w", err)
+			return false
+		}
+		if s.fetched < copyFetchSize {
+			return false
+		}
+		if !s.fetch() {
+			return false
+		}
+	}
+	var id int64
+	var j string
+	if err := s.rows.Scan(&id, &j); err != nil {
+		s.rows.Close()
+		s.err = fmt.Errorf("error reading company from cursor: %w", err)
+		return false
+	}
+	s.row = []any{id, j}
+	s.fetched++
+	s.count++
+	return true
+}
+
+func (s *cursorSource) Values() ([]any, error) { return s.row, nil }
+func (s *cursorSource) Err() error             { return s.err }
+
+// CopyCompaniesTo copies all companies to another database (or schema),
+// reading them with a server-side cursor and writing them with `COPY`, which
+// allows migrations without a dump and restore cycle. The destination table
+// must exist (see `CreateTable`). It returns the number of rows copied, or
+// the number of rows that would be copied if `CopyOptions.DryRun` is set.
+func (p *PostgreSQL) CopyCompaniesTo(ctx context.Context, dst *PostgreSQL) (int64, error) {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, p.sql["copy_cursor"]); err != nil {
+		return 0, fmt.Errorf("error declaring cursor with: %s\n%w", p.sql["copy_cursor"], err)
+	}
+	s := cursorSource{name: "copy_companies", ctx: ctx, tx: tx}
+	if p.CopyOptions.DryRun {
+		for s.Next() {
+		}
+		if s.Err() != nil {
+			return s.count, s.Err()
+		}
+		p.log().InfoContext(ctx, "Dry run, companies would be copied", "table", dst.CompanyTableFullName(), "companies", s.count)
+		return s.count, nil
+	}
+	n, err := dst.pool.CopyFrom(
+		ctx,
+		pgx.Identifier{dst.schema, dst.CompanyTableName},
+		[]string{idFieldName, jsonFieldName},
+		&s,
+	)
+	if err != nil {
+		return n, fmt.Errorf("error copying companies to %s: %w", dst.CompanyTableFullName(), err)
+	}
+	return n, nil
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+)
+
+// how many rows of a CSV are saved at once, unless `PostgreSQL.BatchSize` is set
+const defaultCSVBatchSize = 8192
+
+// CSVOptions configures how `CreateCompaniesWithOptions` reads CSV data. The
+// zero value reads UTF-8 CSV using comma as delimiter and double quotes as
+// quote character.
+type CSVOptions struct {
+	Delimiter rune
+	Quote     rune
+	Encoding  string // any name known by the WHATWG Encoding Standard, e.g. ISO-8859-1
+}
+
+// swapQuote exchanges the custom quote character and double quotes, since the
+// standard library CSV parser only understands double quotes.
+func (o CSVOptions) swapQuote(r rune) rune {
+	switch r {
+	case o.Quote:
+		return '"'
+	case '"':
+		return o.Quote
+	}
+	return r
+}
+
+func (o CSVOptions) reader(r io.Reader) (*csv.Reader, error) {
+	if o.Encoding != "" {
+		e, err := htmlindex.Get(o.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("unknown encoding %s: %w", o.Encoding, err)
+		}
+		r = e.NewDecoder().Reader(r)
+	}
+	if o.Quote != 0 && o.Quote != '"' {
+		r = transform.NewReader(r, runes.Map(o.swapQuote))
+	}
+	c := csv.NewReader(r)
+	if o.Delimiter != 0 {
+		c.Comma = o.Delimiter
+	}
+	c.ReuseRecord = true
+	return c, nil
+}
+
+// csvSource implements pgx.CopyFromSource reading ID and JSON pairs from a CSV
+// reader, one row at a time.
+type csvSource struct {
+	reader *csv.Reader
+	opts   CSVOptions
+	id     int // index of the ID column
+	json   int // index of the JSON column
+	row    []any
+	count  int64
+	err    error
+}
+
+func (s *csvSource) Next() bool {
+	r, err := s.reader.Read()
+	if err == io.EOF {
+		return false
+	}
+	if err != nil {
+		s.err = fmt.Errorf("error reading csv line %d: %w", s.count+1, err)
+		return false
+	}
+	if s.opts.Quote != 0 && s.opts.Quote != '"' {
+		for i := range r {
+			r[i] = strings.Map(s.opts.swapQuote, r[i])
+		}
+	}
+	n, err := strconv.ParseInt(r[s.id], 10, 0)
+	if err != nil {
+		s.err = fmt.Errorf("error converting id %s in csv line %d to integer: %w", r[s.id], s.count+1, err)
+		return false
+	}
+	s.row = []any{n, r[s.json]}
+	s.count++
+	return true
+}
+
+func (s *csvSource) Values() ([]any, error) { return s.row, nil }
+func (s *csvSource) Err() error             { return s.err }
+
+// newCSVSource creates a source for CSV data with the ID in the first column
+// and the JSON in the second one.
+func newCSVSource(r io.Reader, o CSVOptions) (*csvSource, error) {
+	c, err := o.reader(r)
+	if err != nil {
+		return nil, err
+	}
+	c.FieldsPerRecord = 2
+	return &csvSource{reader: c, opts: o, id: 0, json: 1}, nil
+}
+
+// newCSVSourceWithHeader creates a source for CSV data that starts with a
+// header row, used to find the ID and JSON columns by their names.
+func newCSVSourceWithHeader(r io.Reader, o CSVOptions) (*csvSource, error) {
+	c, err := o.reader(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := c.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading csv header: %w", err)
+	}
+	s := csvSource{reader: c, opts: o, id: -1, json: -1}
+	for i, v := range h {
+		switch strings.TrimSpace(v) {
+		case idFieldName:
+			s.id = i
+		case jsonFieldName:
+			s.json = i
+		}
+	}
+	if s.id == -1 || s.json == -1 {
+		return nil, fmt.Errorf("csv header %q should have %s and %s columns", h, idFieldName, jsonFieldName)
+	}
+	return &s, nil
+}
+
+// CreateCompaniesWithOptions streams a CSV with two columns, the ID and the
+// JSON field values, to the database. Data in encodings other than UTF-8 is
+// transcoded before being sent to the database. It returns the number of rows
+// written.
+func (p *PostgreSQL) CreateCompaniesWithOptions(ctx context.Context, r io.Reader, o CSVOptions) (int64, error) {
+	s, err := newCSVSource(r, o)
+	if err != nil {
+		return 0, fmt.Errorf("error creating csv reader: %w", err)
+	}
+	return p.copyFrom(ctx, s)
+}
+
+// CreateCompaniesFromReader streams a UTF-8, comma separated, CSV to the
+// database, row by row, without loading the whole file into memory. The CSV
+// must start with a header row including the id and json columns. It returns
+// the number of rows written.
+func (p *PostgreSQL) CreateCompaniesFromReader(ctx context.Context, r io.Reader) (int64, error) {
+	s, err := newCSVSourceWithHeader(r, CSVOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("error creating csv reader: %w", err)
+	}
+	return p.copyFrom(ctx, s)
+}
+
+// CreateCompaniesFromCSVFile works as `CreateCompaniesFromReader` reading from
+// a file. Both Unix (\n) and Windows (\r\n) line endings are accepted.
+func (p *PostgreSQL) CreateCompaniesFromCSVFile(ctx context.Context, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+	n, err := p.CreateCompaniesFromReader(ctx, f)
+	if err != nil {
+		return n, fmt.Errorf("error importing %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// copyFrom saves the rows of a CSV source in batches (of `BatchSize` rows, or
+// `defaultCSVBatchSize` if it is not set) through the same path as
+// `CreateCompanies`, so its options (compression, history, import report,
+// dead-letter file, timeouts, etc.) apply to CSV data too. It returns the
+// number of rows handled (saved or sent to the dead-letter file).
+func (p *PostgreSQL) copyFrom(ctx context.Context, s *csvSource) (int64, error) {
+	size := p.BatchSize
+	if size <= 0 {
+		size = defaultCSVBatchSize
+	}
+	var n int64
+	b := make([][]any, 0, size)
+	save := func() error {
+		if err := p.createBatch(ctx, b); err != nil {
+			return err
+		}
+		n += int64(len(b))
+		b = make([][]any, 0, size)
+		return nil
+	}
+	for s.Next() {
+		b = append(b, s.row)
+		if len(b) == size {
+			if err := save(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return n, err
+	}
+	if len(b) > 0 {
+		if err := save(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCSVSource(t *testing.T) {
+	for _, c := range []struct {
+		desc    string
+		data    []byte
+		opts    CSVOptions
+		id      int64
+		json    string
+		invalid bool
+	}{
+		{"default options", []byte("33683111000280,\"{\"\"answer\"\": 42}\"\n"), CSVOptions{}, 33683111000280, `{"answer": 42}`, false},
+		{"custom delimiter", []byte("33683111000280;{}\n"), CSVOptions{Delimiter: ';'}, 33683111000280, "{}", false},
+		{"custom quote", []byte("33683111000280,'{\"name\": \"a;b\"}'\n"), CSVOptions{Quote: '\''}, 33683111000280, `{"name": "a;b"}`, false},
+		{"latin-1 encoding", []byte("33683111000280,\"{\"\"name\"\": \"\"S\xe3o Paulo\"\"}\"\n"), CSVOptions{Encoding: "ISO-8859-1"}, 33683111000280, `{"name": "São Paulo"}`, false},
+		{"windows line endings", []byte("33683111000280,\"{\"\"answer\"\": 42}\"\r\n"), CSVOptions{}, 33683111000280, `{"answer": 42}`, false},
+		{"invalid id", []byte("forty-two,{}\n"), CSVOptions{}, 0, "", true},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			s, err := newCSVSource(bytes.NewReader(c.data), c.opts)
+			if err != nil {
+				t.Fatalf("expected no error creating csv source, got %s", err)
+			}
+			ok := s.Next()
+			if c.invalid {
+				if ok || s.Err() == nil {
+					t.Errorf("expected an error reading %q, got nil", c.data)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected a row, got error %s", s.Err())
+			}
+			v, err := s.Values()
+			if err != nil {
+				t.Errorf("expected no error reading values, got %s", err)
+			}
+			if v[0] != c.id {
+				t.Errorf("expected id to be %d, got %v", c.id, v[0])
+			}
+			if v[1] != c.json {
+				t.Errorf("expected json to be %s, got %v", c.json, v[1])
+			}
+			if s.Next() {
+				t.Errorf("expected no more rows, got %v", s.row)
+			}
+		})
+	}
+}
+
+func TestCSVSourceUnknownEncoding(t *testing.T) {
+	if _, err := newCSVSource(bytes.NewReader([]byte{}), CSVOptions{Encoding: "forty-two"}); err == nil {
+		t.Error("expected an error with an unknown encoding, got nil")
+	}
+}
+
+func TestCSVSourceWithHeader(t *testing.T) {
+	s, err := newCSVSourceWithHeader(bytes.NewReader([]byte("json,id\r\n{},33683111000280\r\n")), CSVOptions{})
+	if err != nil {
+		t.Fatalf("expected no error creating csv source, got %s", err)
+	}
+	if !s.Next() {
+		t.Fatalf("expected a row, got error %s", s.Err())
+	}
+	v, _ := s.Values()
+	if v[0] != int64(33683111000280) || v[1] != "{}" {
+		t.Errorf("expected 33683111000280 and {}, got %v", v)
+	}
+	if _, err := newCSVSourceWithHeader(bytes.NewReader([]byte("cnpj,data\n")), CSVOptions{}); err == nil {
+		t.Error("expected an error with a header missing id and json, got nil")
+	}
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// how many companies from a dead-letter file are saved at once
+const deadLetterBatchSize = 8192
+
+// deadLetterRow is a line of a dead-letter file.
+type deadLetterRow struct {
+	ID   string `json:"id"`
+	JSON string `json:"json"`
+}
+
+// writeDeadLetter saves a batch to a new gzipped JSONL file, named after the
+// path and the current time, and returns the name of this file.
+func writeDeadLetter(path string, batch [][]any) (string, error) {
+	n := fmt.Sprintf("%s.%s.jsonl.gz", path, time.Now().Format("20060102T150405.000000000"))
+	f, err := os.OpenFile(n, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("error creating %s: %w", n, err)
+	}
+	defer f.Close()
+	z := gzip.NewWriter(f)
+	enc := json.NewEncoder(z)
+	for _, r := range batch {
+		j, ok := r[1].(string)
+		if !ok {
+			return "", fmt.Errorf("unexpected json type %T", r[1])
+		}
+		if err := enc.Encode(deadLetterRow{fmt.Sprint(r[0]), j}); err != nil {
+			return "", fmt.Errorf("error writing to %s: %w", n, err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return "", fmt.Errorf("error closing %s: %w", n, err)
+	}
+	return n, nil
+}
+
+// readDeadLetter reads a dead-letter file calling fn for each batch of up to
+// `deadLetterBatchSize` companies.
+func readDeadLetter(r io.Reader, fn func([][]any) error) error {
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error reading gzip: %w", err)
+	}
+	defer z.Close()
+	s := bufio.NewScanner(z)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var b [][]any
+	for l := 1; s.Scan(); l++ {
+		var row deadLetterRow
+		if err := json.Unmarshal(s.Bytes(), &row); err != nil {
+			return fmt.Errorf("error decoding line %d: %w", l, err)
+		}
+		n, err := strconv.ParseInt(row.ID, 10, 0)
+		if err != nil {
+			return fmt.Errorf("error converting id %s in line %d to integer: %w", row.ID, l, err)
+		}
+		b = append(b, []any{n, row.JSON})
+		if len(b) == deadLetterBatchSize {
+			if err := fn(b); err != nil {
+				return err
+			}
+			b = nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("error reading lines: %w", err)
+	}
+	if len(b) > 0 {
+		return fn(b)
+	}
+	return nil
+}
+
+// ReplayDeadLetter re-attempts to save the companies in a dead-letter file
+// created by `CreateCompanies`. Failures are returned as errors and are not
+// saved to a new dead-letter file.
+func (p *PostgreSQL) ReplayDeadLetter(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+	var t int
+	err = readDeadLetter(f, func(b [][]any) error {
+		if err := p.createCompanies(ctx, b); err != nil {
+			return err
+		}
+		t += len(b)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error replaying %s: %w", path, err)
+	}
+	p.log().InfoContext(ctx, "Companies from dead-letter file saved", "table", p.CompanyTableFullName(), "file", path, "companies", t)
+	return nil
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeadLetter(t *testing.T) {
+	b := [][]any{{33683111000280, `{"answer": 42}`}, {"19131243000197", "{}"}}
+	n, err := writeDeadLetter(filepath.Join(t.TempDir(), "failed"), b)
+	if err != nil {
+		t.Fatalf("expected no error writing dead-letter file, got %s", err)
+	}
+	if !strings.HasSuffix(n, ".jsonl.gz") {
+		t.Errorf("expected dead-letter file to be a gzipped JSONL, got %s", n)
+	}
+	f, err := os.Open(n)
+	if err != nil {
+		t.Fatalf("expected no error opening %s, got %s", n, err)
+	}
+	defer f.Close()
+	var got [][]any
+	err = readDeadLetter(f, func(b [][]any) error {
+		got = append(got, b...)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("expected no error reading dead-letter file, got %s", err)
+	}
+	expected := [][]any{{int64(33683111000280), `{"answer": 42}`}, {int64(19131243000197), "{}"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
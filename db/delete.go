@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cuducos/minha-receita/cnpj"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeleteOptions configures `BulkDelete`. With DryRun, nothing is deleted and
+// the number of rows that would be deleted is returned instead.
+type DeleteOptions struct {
+	DryRun bool
+}
+
+// BulkDelete removes companies by CNPJ (e.g. cancelled registrations) and
+// returns how many rows were deleted. All CNPJs are validated first, and if
+// any of them is invalid, the database is not touched and the error lists all
+// the invalid ones.
+func (p *PostgreSQL) BulkDelete(ctx context.Context, ids []string) (int64, error) {
+	ns := make([]int64, 0, len(ids))
+	var invalid []string
+	for _, id := range ids {
+		c, err := cnpj.ParseCNPJ(id)
+		if err != nil {
+			invalid = append(invalid, id)
+			continue
+		}
+		n, err := strconv.ParseInt(c, 10, 0)
+		if err != nil {
+			return 0, fmt.Errorf("error converting cnpj %s to integer: %w", c, err)
+		}
+		ns = append(ns, n)
+	}
+	if len(invalid) > 0 {
+		return 0, fmt.Errorf("%w: %d of %d cnpjs are invalid: %s", cnpj.ErrInvalidCNPJ, len(invalid), len(ids), strings.Join(invalid, ", "))
+	}
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Update)
+	defer cancel()
+	if p.DeleteOptions.DryRun {
+		rows, err := p.pool.Query(ctx, p.sql["bulk_delete_count"], ns)
+		if err != nil {
+			return 0, fmt.Errorf("error counting companies to delete: %w", err)
+		}
+		c, err := pgx.CollectOneRow(rows, pgx.RowTo[int64])
+		if err != nil {
+			return 0, fmt.Errorf("error reading count of companies to delete: %w", err)
+		}
+		return c, nil
+	}
+	t, err := p.pool.Exec(ctx, p.sql["bulk_delete"], ns)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting companies: %w", err)
+	}
+	return t.RowsAffected(), nil
+}
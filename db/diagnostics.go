@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// errDiagnosisAborted wraps errors unrelated to the rows being diagnosed (e.g.
+// creating a savepoint, or a cancelled context), which stop the search for the
+// bad row.
+var errDiagnosisAborted = errors.New("diagnosis aborted")
+
+// DiagnosticResult is the outcome of `CreateCompaniesWithDiagnostics`. When
+// the batch fails, Row is the index (in the batch, counting from 0) of the
+// first row of the smallest sub-batch found to fail, and Rows is the size of
+// this sub-batch: 1 means the row fails on its own, more than 1 means these
+// rows only fail together. When the batch is saved, Row is -1.
+type DiagnosticResult struct {
+	Row   int
+	Rows  int
+	Error string
+}
+
+// bisect narrows down the failing range [0, n) to the smallest sub-batch that
+// still fails, trying the first half before the second one. It returns the
+// range and the error of this sub-batch. If none of the halves of a range
+// fails alone, this range is returned. If try returns an error wrapping
+// `errDiagnosisAborted`, the search stops returning this error.
+func bisect(n int, err error, try func(lo, hi int) error) (int, int, error) {
+	lo, hi := 0, n
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if e := try(lo, mid); e != nil {
+			if errors.Is(e, errDiagnosisAborted) {
+				return lo, hi, e
+			}
+			hi, err = mid, e
+			continue
+		}
+		if e := try(mid, hi); e != nil {
+			if errors.Is(e, errDiagnosisAborted) {
+				return lo, hi, e
+			}
+			lo, err = mid, e
+			continue
+		}
+		break
+	}
+	return lo, hi, err
+}
+
+// CreateCompaniesWithDiagnostics works as `CreateCompanies` for rows with the
+// CNPJ and the JSON of each company, but, when the batch fails, it searches
+// for the row causing the failure, since errors from COPY rarely point to it.
+// It splits the batch in halves and tries each of them (and then halves of the
+// failing half, and so on) in savepoints that are rolled back, so nothing is
+// saved from a failed batch. The result and the returned error point to the
+// first bad row found. Errors unrelated to the rows (e.g. creating a savepoint,
+// or a cancelled context) stop the search, and the result covers the whole
+// batch.
+func (p *PostgreSQL) CreateCompaniesWithDiagnostics(ctx context.Context, batch [][]string) (DiagnosticResult, error) {
+	rows := make([][]any, len(batch))
+	for i, r := range batch {
+		if len(r) != 2 {
+			err := fmt.Errorf("row %d should have 2 columns, got %d", i, len(r))
+			return DiagnosticResult{Row: i, Rows: 1, Error: err.Error()}, err
+		}
+		n, err := strconv.ParseInt(r[0], 10, 0)
+		if err != nil {
+			err = fmt.Errorf("error converting cnpj %s in row %d to integer: %w", r[0], i, err)
+			return DiagnosticResult{Row: i, Rows: 1, Error: err.Error()}, err
+		}
+		rows[i] = []any{n, r[1]}
+	}
+	defer p.acquireImportSlot()()
+	err := p.createCompanies(ctx, rows)
+	if err == nil {
+		return DiagnosticResult{Row: -1}, nil
+	}
+	p.log().WarnContext(ctx, "Batch failed, looking for the bad row…", "companies", len(rows), "error", err)
+	tx, txErr := p.pool.Begin(ctx)
+	if txErr != nil {
+		return DiagnosticResult{Row: 0, Rows: len(rows), Error: err.Error()}, fmt.Errorf("error starting transaction to diagnose the batch (%s): %w", err, txErr)
+	}
+	defer tx.Rollback(ctx)
+	batchErr := err
+	lo, hi, err := bisect(len(rows), err, func(lo, hi int) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %w", errDiagnosisAborted, err)
+		}
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: error creating savepoint: %w", errDiagnosisAborted, err)
+		}
+		err = p.copyCompanies(ctx, sp, rows[lo:hi])
+		if e := sp.Rollback(ctx); e != nil {
+			return fmt.Errorf("%w: error rolling back savepoint: %w", errDiagnosisAborted, e)
+		}
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", errDiagnosisAborted, ctx.Err())
+		}
+		return err
+	})
+	if errors.Is(err, errDiagnosisAborted) {
+		return DiagnosticResult{Row: 0, Rows: len(rows), Error: batchErr.Error()}, fmt.Errorf("error diagnosing the batch (%s): %w", batchErr, err)
+	}
+	r := DiagnosticResult{Row: lo, Rows: hi - lo, Error: err.Error()}
+	p.log().WarnContext(ctx, "Bad row found", "row", lo, "rows", hi-lo, "cnpj", batch[lo][0], "error", err)
+	return r, fmt.Errorf("error saving batch, the first bad row is %d (cnpj %s): %w", lo, batch[lo][0], err)
+}
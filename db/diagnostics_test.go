@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBisect(t *testing.T) {
+	bad := errors.New("bad row")
+	for _, c := range []struct {
+		desc   string
+		n      int
+		fails  func(lo, hi int) bool
+		lo, hi int
+	}{
+		{"single row", 1, func(int, int) bool { return true }, 0, 1},
+		{"first row", 8, func(lo, _ int) bool { return lo == 0 }, 0, 1},
+		{"last row", 8, func(_, hi int) bool { return hi == 8 }, 7, 8},
+		{"middle row", 9, func(lo, hi int) bool { return lo <= 5 && 5 < hi }, 5, 6},
+		{"two bad rows", 8, func(lo, hi int) bool { return (lo <= 2 && 2 < hi) || (lo <= 6 && 6 < hi) }, 2, 3},
+		{"rows failing together", 8, func(lo, hi int) bool { return lo <= 3 && 4 < hi }, 0, 8},
+		{"pair failing together", 8, func(lo, hi int) bool { return lo <= 2 && 3 < hi }, 2, 4},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			lo, hi, err := bisect(c.n, bad, func(lo, hi int) error {
+				if c.fails(lo, hi) {
+					return bad
+				}
+				return nil
+			})
+			if lo != c.lo || hi != c.hi {
+				t.Errorf("expected range [%d, %d), got [%d, %d)", c.lo, c.hi, lo, hi)
+			}
+			if !errors.Is(err, bad) {
+				t.Errorf("expected the error of the bad row, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBisectAborted(t *testing.T) {
+	bad := errors.New("bad row")
+	aborted := fmt.Errorf("%w: error creating savepoint", errDiagnosisAborted)
+	var tries int
+	lo, hi, err := bisect(8, bad, func(lo, hi int) error {
+		tries++
+		if tries == 2 {
+			return aborted
+		}
+		return bad
+	})
+	if !errors.Is(err, errDiagnosisAborted) {
+		t.Errorf("expected the search to be aborted, got %v", err)
+	}
+	if tries != 2 || lo != 0 || hi != 4 {
+		t.Errorf("expected the search to stop at [0, 4) after 2 tries, got [%d, %d) after %d", lo, hi, tries)
+	}
+}
+
+func TestCreateCompaniesWithDiagnosticsInvalidRows(t *testing.T) {
+	p := PostgreSQL{}
+	for _, c := range []struct {
+		batch [][]string
+		row   int
+	}{
+		{[][]string{{"33683111000280", "{}"}, {"forty-two", "{}"}}, 1},
+		{[][]string{{"33683111000280"}}, 0},
+	} {
+		r, err := p.CreateCompaniesWithDiagnostics(context.Background(), c.batch)
+		if err == nil {
+			t.Errorf("expected an error for %v, got nil", c.batch)
+		}
+		if r.Row != c.row || r.Rows != 1 || r.Error == "" {
+			t.Errorf("expected row %d to be the bad one, got %+v", c.row, r)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DiffResult is a difference between two databases.
+type DiffResult struct {
+	CNPJ        string `json:"cnpj"`
+	OnlyInSelf  bool   `json:"only_in_self"`
+	OnlyInOther bool   `json:"only_in_other"`
+	JSONDiffers bool   `json:"json_differs"`
+}
+
+// diffRow reads the next ID and JSON from a source of companies sorted by ID.
+func diffRow(s pgx.CopyFromSource) (int64, string, bool, error) {
+	if !s.Next() {
+		return 0, "", false, s.Err()
+	}
+	v, err := s.Values()
+	if err != nil {
+		return 0, "", false, err
+	}
+	var n int64
+	switch id := v[0].(type) {
+	case int64:
+		n = id
+	case int:
+		n = int64(id)
+	default:
+		return 0, "", false, fmt.Errorf("unexpected id type %T", id)
+	}
+	j, ok := v[1].(string)
+	if !ok {
+		return 0, "", false, fmt.Errorf("unexpected json type %T", v[1])
+	}
+	j, err = decompressJSON(j)
+	if err != nil {
+		return 0, "", false, fmt.Errorf("error reading cnpj %d: %w", n, err)
+	}
+	return n, j, true, nil
+}
+
+// diff compares two sources of companies sorted by ID, merging them as they
+// are read, so only one row of each is kept in memory. It stops after limit
+// differences (zero means no limit).
+func diff(self, other pgx.CopyFromSource, limit int) ([]DiffResult, error) {
+	var r []DiffResult
+	a, aj, aok, err := diffRow(self)
+	if err != nil {
+		return nil, err
+	}
+	b, bj, bok, err := diffRow(other)
+	if err != nil {
+		return nil, err
+	}
+	for (aok || bok) && (limit <= 0 || len(r) < limit) {
+		switch {
+		case aok && (!bok || a < b):
+			r = append(r, DiffResult{CNPJ: fmt.Sprintf("%014d", a), OnlyInSelf: true})
+			a, aj, aok, err = diffRow(self)
+		case bok && (!aok || b < a):
+			r = append(r, DiffResult{CNPJ: fmt.Sprintf("%014d", b), OnlyInOther: true})
+			b, bj, bok, err = diffRow(other)
+		default:
+			if aj != bj {
+				r = append(r, DiffResult{CNPJ: fmt.Sprintf("%014d", a), JSONDiffers: true})
+			}
+			a, aj, aok, err = diffRow(self)
+			if err != nil {
+				return r, err
+			}
+			b, bj, bok, err = diffRow(other)
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// diffCursor opens a read-only transaction with a cursor reading all companies
+// sorted by ID. The transaction must be rolled back by the caller.
+func (p *PostgreSQL) diffCursor(ctx context.Context) (pgx.Tx, *cursorSource, error) {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	if _, err := tx.Exec(ctx, p.sql["diff_cursor"]); err != nil {
+		tx.Rollback(ctx)
+		return nil, nil, fmt.Errorf("error declaring cursor with: %s\n%w", p.sql["diff_cursor"], err)
+	}
+	return tx, &cursorSource{name: "diff_companies", ctx: ctx, tx: tx}, nil
+}
+
+// Diff compares the companies in this database with the ones in another
+// database (or schema), for example, to check a new import before using it.
+// It finds CNPJs present in only one of them, and CNPJs whose JSON differ.
+// Both tables are streamed in order of CNPJ, so they are not loaded into
+// memory. It stops after limit differences (zero means no limit).
+func (p *PostgreSQL) Diff(ctx context.Context, other *PostgreSQL, limit int) ([]DiffResult, error) {
+	tx, self, err := p.diffCursor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	otx, o, err := other.diffCursor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer otx.Rollback(ctx)
+	r, err := diff(self, o, limit)
+	if err != nil {
+		return r, fmt.Errorf("error comparing %s and %s: %w", p.CompanyTableFullName(), other.CompanyTableFullName(), err)
+	}
+	return r, nil
+}
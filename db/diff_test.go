@@ -0,0 +1,49 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestDiff(t *testing.T) {
+	self := [][]any{
+		{int64(1), `{"answer": 42}`},
+		{int64(2), `{"answer": 42}`},
+		{int64(4), `{"answer": 42}`},
+		{int64(5), `{"answer": 42}`},
+	}
+	other := [][]any{
+		{int64(2), `{"answer": 42}`},
+		{int64(3), `{"answer": 42}`},
+		{int64(4), `{"answer": "forty-two"}`},
+	}
+	c, err := compressJSON(`{"answer": 42}`)
+	if err != nil {
+		t.Fatalf("expected no error compressing json, got %s", err)
+	}
+	other = append(other, []any{int64(5), c})
+	for _, tc := range []struct {
+		limit    int
+		expected []DiffResult
+	}{
+		{0, []DiffResult{
+			{CNPJ: "00000000000001", OnlyInSelf: true},
+			{CNPJ: "00000000000003", OnlyInOther: true},
+			{CNPJ: "00000000000004", JSONDiffers: true},
+		}},
+		{2, []DiffResult{
+			{CNPJ: "00000000000001", OnlyInSelf: true},
+			{CNPJ: "00000000000003", OnlyInOther: true},
+		}},
+	} {
+		got, err := diff(pgx.CopyFromRows(self), pgx.CopyFromRows(other), tc.limit)
+		if err != nil {
+			t.Errorf("expected no error comparing with limit %d, got %s", tc.limit, err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("expected %+v with limit %d, got %+v", tc.expected, tc.limit, got)
+		}
+	}
+}
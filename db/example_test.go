@@ -0,0 +1,94 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cuducos/minha-receita/cnpj"
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/db/mock"
+)
+
+// The examples use `mock.InMemoryStore`, which has the same methods as
+// `db.PostgreSQL`, so they run without a database.
+
+func ExamplePostgreSQL_GetCompany() {
+	store := mock.NewInMemoryStore(map[string]string{
+		"33683111000280": `{"cnpj": "33683111000280", "razao_social": "SERVICO FEDERAL DE PROCESSAMENTO DE DADOS (SERPRO)", "uf": "DF"}`,
+	})
+	for _, n := range []string{"33.683.111/0002-80", "19.131.243/0001-97"} {
+		id, err := cnpj.ParseCNPJ(n)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		s, err := store.GetCompany(context.Background(), id)
+		if errors.Is(err, mock.ErrNotFound) {
+			fmt.Printf("%s not found\n", n)
+			continue
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var c struct {
+			Name string `json:"razao_social"`
+			UF   string `json:"uf"`
+		}
+		if err := json.Unmarshal([]byte(s), &c); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("%s: %s (%s)\n", n, c.Name, c.UF)
+	}
+	// Output:
+	// 33.683.111/0002-80: SERVICO FEDERAL DE PROCESSAMENTO DE DADOS (SERPRO) (DF)
+	// 19.131.243/0001-97 not found
+}
+
+func ExamplePostgreSQL_MetaSave() {
+	store := mock.NewInMemoryStore(nil)
+	if err := store.MetaSave("updated-at", "2024-01-15"); err != nil {
+		fmt.Println(err)
+		return
+	}
+	v, err := store.MetaRead("updated-at")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(v)
+	if err := store.MetaSave("federal-revenue-updated-at", "2024-01-15"); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 2024-01-15
+	// metatable can only take keys that are at maximum 16 chars long
+}
+
+func ExamplePostgreSQL_CreateCompanies() {
+	store := mock.NewInMemoryStore(nil)
+	batch := [][]any{
+		{int64(33683111000280), `{"cnpj": "33683111000280", "razao_social": "SERVICO FEDERAL DE PROCESSAMENTO DE DADOS (SERPRO)"}`},
+		{int64(19131243000197), `{"cnpj": "19131243000197", "razao_social": "OPEN KNOWLEDGE BRASIL"}`},
+	}
+	if err := store.CreateCompanies(batch); err != nil {
+		fmt.Println(err)
+		return
+	}
+	n, err := store.RowCountExact(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%d companies created\n", n)
+	err = store.CreateCompanies([][]any{{int64(191), `{"cnpj": "00000000000191"`}})
+	if errors.Is(err, db.ErrMalformedData) {
+		fmt.Println(err)
+	}
+	// Output:
+	// 2 companies created
+	// malformed data: cnpj 00000000000191
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ExplainQuery returns, as JSON, the PostgreSQL query plan of `GetCompany` for
+// a CNPJ. The query is actually executed (EXPLAIN ANALYZE), so this is meant
+// for debugging slow lookups, not to be used in the web API.
+func (p *PostgreSQL) ExplainQuery(ctx context.Context, id string) (string, error) {
+	n, err := strconv.ParseInt(id, 10, 0)
+	if err != nil {
+		return "", fmt.Errorf("error converting cnpj %s to integer: %w", id, err)
+	}
+	rows, err := p.pool.Query(ctx, p.sql["explain"], n)
+	if err != nil {
+		return "", fmt.Errorf("error explaining query for cnpj %d: %w", n, err)
+	}
+	s, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", fmt.Errorf("error reading query plan for cnpj %d: %w", n, err)
+	}
+	return s, nil
+}
+
+type planNode struct {
+	NodeType   string     `json:"Node Type"`
+	Relation   string     `json:"Relation Name"`
+	Index      string     `json:"Index Name"`
+	Cost       float64    `json:"Total Cost"`
+	Time       float64    `json:"Actual Total Time"`
+	Rows       int64      `json:"Actual Rows"`
+	Loops      int64      `json:"Actual Loops"`
+	SharedHit  int64      `json:"Shared Hit Blocks"`
+	SharedRead int64      `json:"Shared Read Blocks"`
+	IndexCond  string     `json:"Index Cond"`
+	Filter     string     `json:"Filter"`
+	Plans      []planNode `json:"Plans"`
+}
+
+type queryPlan struct {
+	Plan          planNode `json:"Plan"`
+	PlanningTime  float64  `json:"Planning Time"`
+	ExecutionTime float64  `json:"Execution Time"`
+}
+
+func (n planNode) String() string {
+	var b strings.Builder
+	b.WriteString(n.NodeType)
+	if n.Index != "" {
+		b.WriteString(" using " + n.Index)
+	}
+	if n.Relation != "" {
+		b.WriteString(" on " + n.Relation)
+	}
+	fmt.Fprintf(&b, " (cost=%.2f time=%.3fms rows=%d loops=%d buffers: hit=%d read=%d)", n.Cost, n.Time, n.Rows, n.Loops, n.SharedHit, n.SharedRead)
+	return b.String()
+}
+
+func writePlanNode(b *strings.Builder, n planNode, prefix string, last bool, root bool) {
+	branch, child := "", ""
+	if !root {
+		branch, child = "├── ", "│   "
+		if last {
+			branch, child = "└── ", "    "
+		}
+	}
+	b.WriteString(prefix + branch + n.String() + "\n")
+	for _, c := range []struct{ label, value string }{{"Index Cond", n.IndexCond}, {"Filter", n.Filter}} {
+		if c.value != "" {
+			b.WriteString(prefix + child + "  " + c.label + ": " + c.value + "\n")
+		}
+	}
+	for i, p := range n.Plans {
+		writePlanNode(b, p, prefix+child, i == len(n.Plans)-1, false)
+	}
+}
+
+// FormatQueryPlan formats the JSON returned by `ExplainQuery` as a tree, one
+// node of the plan per line, followed by planning and execution times.
+func FormatQueryPlan(plan string) (string, error) {
+	var ps []queryPlan
+	if err := json.Unmarshal([]byte(plan), &ps); err != nil {
+		return "", fmt.Errorf("error parsing query plan: %w", err)
+	}
+	var b strings.Builder
+	for _, p := range ps {
+		writePlanNode(&b, p.Plan, "", true, true)
+		fmt.Fprintf(&b, "Planning Time: %.3fms\nExecution Time: %.3fms\n", p.PlanningTime, p.ExecutionTime)
+	}
+	return b.String(), nil
+}
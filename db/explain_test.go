@@ -0,0 +1,24 @@
+package db
+
+import "testing"
+
+func TestFormatQueryPlan(t *testing.T) {
+	plan := `[{"Plan": {"Node Type": "Nested Loop", "Total Cost": 16.6, "Actual Total Time": 0.05, "Actual Rows": 1, "Actual Loops": 1, "Shared Hit Blocks": 8, "Shared Read Blocks": 0, "Plans": [{"Node Type": "Index Scan", "Relation Name": "cnpj", "Index Name": "cnpj_pkey", "Total Cost": 8.3, "Actual Total Time": 0.02, "Actual Rows": 1, "Actual Loops": 1, "Shared Hit Blocks": 4, "Shared Read Blocks": 0, "Index Cond": "(id = '33683111000280'::bigint)"}, {"Node Type": "Seq Scan", "Relation Name": "meta", "Total Cost": 8.3, "Actual Total Time": 0.01, "Actual Rows": 1, "Actual Loops": 1, "Shared Hit Blocks": 4, "Shared Read Blocks": 2}]}, "Planning Time": 0.1, "Execution Time": 0.06}]`
+	expected := `Nested Loop (cost=16.60 time=0.050ms rows=1 loops=1 buffers: hit=8 read=0)
+├── Index Scan using cnpj_pkey on cnpj (cost=8.30 time=0.020ms rows=1 loops=1 buffers: hit=4 read=0)
+│     Index Cond: (id = '33683111000280'::bigint)
+└── Seq Scan on meta (cost=8.30 time=0.010ms rows=1 loops=1 buffers: hit=4 read=2)
+Planning Time: 0.100ms
+Execution Time: 0.060ms
+`
+	got, err := FormatQueryPlan(plan)
+	if err != nil {
+		t.Fatalf("expected no error formatting query plan, got %s", err)
+	}
+	if got != expected {
+		t.Errorf("expected query plan to be\n%s\ngot\n%s", expected, got)
+	}
+	if _, err := FormatQueryPlan("42"); err == nil {
+		t.Error("expected error formatting an invalid query plan")
+	}
+}
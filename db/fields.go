@@ -0,0 +1,72 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownField is returned when a field is not part of the company JSON.
+var ErrUnknownField = errors.New("unknown field")
+
+// companyFields are the top-level keys of the company JSON.
+var companyFields = map[string]struct{}{
+	"cnpj":                                  {},
+	"identificador_matriz_filial":           {},
+	"descricao_identificador_matriz_filial": {},
+	"nome_fantasia":                         {},
+	"situacao_cadastral":                    {},
+	"descricao_situacao_cadastral":          {},
+	"data_situacao_cadastral":               {},
+	"motivo_situacao_cadastral":             {},
+	"descricao_motivo_situacao_cadastral":   {},
+	"nome_cidade_no_exterior":               {},
+	"codigo_pais":                           {},
+	"pais":                                  {},
+	"data_inicio_atividade":                 {},
+	"cnae_fiscal":                           {},
+	"cnae_fiscal_descricao":                 {},
+	"descricao_tipo_de_logradouro":          {},
+	"logradouro":                            {},
+	"numero":                                {},
+	"complemento":                           {},
+	"bairro":                                {},
+	"cep":                                   {},
+	"uf":                                    {},
+	"codigo_municipio":                      {},
+	"codigo_municipio_ibge":                 {},
+	"municipio":                             {},
+	"ddd_telefone_1":                        {},
+	"ddd_telefone_2":                        {},
+	"ddd_fax":                               {},
+	"email":                                 {},
+	"situacao_especial":                     {},
+	"data_situacao_especial":                {},
+	"opcao_pelo_simples":                    {},
+	"data_opcao_pelo_simples":               {},
+	"data_exclusao_do_simples":              {},
+	"opcao_pelo_mei":                        {},
+	"data_opcao_pelo_mei":                   {},
+	"data_exclusao_do_mei":                  {},
+	"razao_social":                          {},
+	"codigo_natureza_juridica":              {},
+	"natureza_juridica":                     {},
+	"qualificacao_do_responsavel":           {},
+	"capital_social":                        {},
+	"codigo_porte":                          {},
+	"porte":                                 {},
+	"ente_federativo_responsavel":           {},
+	"descricao_porte":                       {},
+	"qsa":                                   {},
+	"cnaes_secundarios":                     {},
+}
+
+// validateFields returns `ErrUnknownField` if any of the fields is not a
+// top-level key of the company JSON.
+func validateFields(fs []string) error {
+	for _, f := range fs {
+		if _, ok := companyFields[f]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownField, f)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidIndexColumn is returned when a column is not accepted by
+// `CreateGINIndex` or `DropGINIndex`.
+var ErrInvalidIndexColumn = errors.New("invalid index column")
+
+// IndexInfo describes an index of the companies table.
+type IndexInfo struct {
+	Name       string `json:"name"`
+	Method     string `json:"method"`     // e.g. btree or gin
+	Expression string `json:"expression"` // first column or expression, as in pg_get_indexdef
+	Definition string `json:"definition"` // the CREATE INDEX statement
+}
+
+// ListIndexes lists the indexes of the companies table.
+func (p *PostgreSQL) ListIndexes(ctx context.Context) ([]IndexInfo, error) {
+	rows, err := p.pool.Query(ctx, p.sql["list_indexes"])
+	if err != nil {
+		return nil, fmt.Errorf("error listing indexes of %s: %w", p.CompanyTableFullName(), err)
+	}
+	is, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (IndexInfo, error) {
+		var i IndexInfo
+		err := row.Scan(&i.Name, &i.Method, &i.Expression, &i.Definition)
+		return i, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading indexes of %s: %w", p.CompanyTableFullName(), err)
+	}
+	return is, nil
+}
+
+// ginIndex returns the name of the index created by `CreateGINIndex` for a
+// column, and the expression as PostgreSQL shows it in `IndexInfo`. The column
+// is the JSON field name (e.g. json) or a path to a top-level key of the
+// company JSON (e.g. json->'cnaes_secundarios').
+func (p *PostgreSQL) ginIndex(column string) (string, string, error) {
+	if column == p.JSONFieldName {
+		return fmt.Sprintf("idx_%s_gin_%s", p.CompanyTableName, p.JSONFieldName), p.JSONFieldName, nil
+	}
+	f, ok := strings.CutPrefix(column, p.JSONFieldName+"->'")
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidIndexColumn, column)
+	}
+	f, ok = strings.CutSuffix(f, "'")
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidIndexColumn, column)
+	}
+	if err := validateFields([]string{f}); err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidIndexColumn, err)
+	}
+	return fmt.Sprintf("idx_%s_gin_%s", p.CompanyTableName, f), fmt.Sprintf("(%s -> '%s'::text)", p.JSONFieldName, f), nil
+}
+
+// IndexFullName is the name of the schema and index in dot-notation (or only
+// the index name when using the search_path), quoted as identifiers.
+func (p *PostgreSQL) IndexFullName(name string) string {
+	if p.useSearchPath {
+		return pgx.Identifier{name}.Sanitize()
+	}
+	return pgx.Identifier{p.schema, name}.Sanitize()
+}
+
+// CreateGINIndex creates a GIN index, concurrently, on the JSON column (json)
+// or on a top-level key of the company JSON (e.g. json->'cnaes_secundarios'),
+// speeding up containment (@>) and key existence (?) queries. It does nothing
+// if there is already a GIN index on the same expression, even if it was
+// created with a different operator class (e.g. the one on qsa created by
+// `CreateJSONBIndexes`).
+func (p *PostgreSQL) CreateGINIndex(ctx context.Context, column string) error {
+	n, e, err := p.ginIndex(column)
+	if err != nil {
+		return err
+	}
+	is, err := p.ListIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, i := range is {
+		if i.Method == "gin" && i.Expression == e {
+			p.log().InfoContext(ctx, "GIN index already exists", "table", p.CompanyTableFullName(), "index", i.Name, "column", column)
+			return nil
+		}
+	}
+	p.log().InfoContext(ctx, "Creating GIN index…", "table", p.CompanyTableFullName(), "index", n, "column", column)
+	q := fmt.Sprintf("CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s USING GIN ((%s))", pgx.Identifier{n}.Sanitize(), p.CompanyTableFullName(), column)
+	if _, err := p.pool.Exec(ctx, q); err != nil {
+		return fmt.Errorf("error creating gin index with: %s\n%w", q, err)
+	}
+	return nil
+}
+
+// DropGINIndex drops, concurrently, the index created by `CreateGINIndex`
+// for a column.
+func (p *PostgreSQL) DropGINIndex(ctx context.Context, column string) error {
+	n, _, err := p.ginIndex(column)
+	if err != nil {
+		return err
+	}
+	q := fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", p.IndexFullName(n))
+	if _, err := p.pool.Exec(ctx, q); err != nil {
+		return fmt.Errorf("error dropping gin index with: %s\n%w", q, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGINIndex(t *testing.T) {
+	p := PostgreSQL{CompanyTableName: companyTableName, JSONFieldName: jsonFieldName}
+	for _, c := range []struct {
+		column     string
+		name       string
+		expression string
+	}{
+		{"json", "idx_cnpj_gin_json", "json"},
+		{"json->'qsa'", "idx_cnpj_gin_qsa", "(json -> 'qsa'::text)"},
+		{"json->'cnaes_secundarios'", "idx_cnpj_gin_cnaes_secundarios", "(json -> 'cnaes_secundarios'::text)"},
+	} {
+		n, e, err := p.ginIndex(c.column)
+		if err != nil {
+			t.Errorf("expected no error for %s, got %s", c.column, err)
+		}
+		if n != c.name || e != c.expression {
+			t.Errorf("expected %s and %s for %s, got %s and %s", c.name, c.expression, c.column, n, e)
+		}
+	}
+	for _, c := range []string{"", "id", "json->qsa", "json->'answer'", "json->'qsa", "json->'qsa'); DROP TABLE cnpj; --'"} {
+		if _, _, err := p.ginIndex(c); !errors.Is(err, ErrInvalidIndexColumn) {
+			t.Errorf("expected ErrInvalidIndexColumn for %q, got %v", c, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// undefinedTable is the PostgreSQL error code for queries on tables that do
+// not exist.
+const undefinedTable = "42P01"
+
+var (
+	// ErrTableMissing is returned by `TestConnection` when the companies or
+	// the metadata table does not exist.
+	ErrTableMissing = errors.New("table does not exist")
+
+	// ErrDatabaseUnavailable is returned by `TestConnection` when it cannot
+	// reach the database.
+	ErrDatabaseUnavailable = errors.New("database unavailable")
+)
+
+// TestConnection is a more thorough health check than `pgxpool.Pool.Ping`:
+// besides checking the connection, it reads from the companies and metadata
+// tables to make sure they exist and are readable.
+func (p *PostgreSQL) TestConnection(ctx context.Context) error {
+	for _, t := range []struct {
+		name  string
+		query string
+	}{
+		{p.CompanyTableFullName(), "test_company_table"},
+		{p.MetaTableFullName(), "test_meta_table"},
+	} {
+		var n int
+		err := p.pool.QueryRow(ctx, p.sql[t.query]).Scan(&n)
+		if err == nil || errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) {
+			return fmt.Errorf("%w: %w", ErrDatabaseUnavailable, err)
+		}
+		if pgErr.Code == undefinedTable {
+			return fmt.Errorf("%w: %s", ErrTableMissing, t.name)
+		}
+		return fmt.Errorf("error reading from %s: %w", t.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// VersionedCompany is a snapshot of the JSON of a company from the history
+// table.
+type VersionedCompany struct {
+	ImportedAt time.Time
+	JSON       string
+}
+
+// HistoryTableFullName is the name of the schame and table in dot-notation
+// (or only the table name when using the search_path).
+func (p *PostgreSQL) HistoryTableFullName() string {
+	if p.useSearchPath {
+		return p.HistoryTableName
+	}
+	return fmt.Sprintf("%s.%s", p.schema, p.HistoryTableName)
+}
+
+// saveHistory copies the rows of a batch (as saved to the companies table) to
+// the history table.
+func (p *PostgreSQL) saveHistory(ctx context.Context, c copier, rows [][]any) error {
+	_, err := c.CopyFrom(
+		ctx,
+		pgx.Identifier{p.HistoryTableName},
+		[]string{idFieldName, jsonFieldName},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return fmt.Errorf("error while saving history to postgres: %w", err)
+	}
+	return nil
+}
+
+// GetCompanyHistory returns the snapshots of a company saved to the history
+// table (see `KeepHistory`), from the oldest to the newest.
+func (p *PostgreSQL) GetCompanyHistory(ctx context.Context, id string) ([]VersionedCompany, error) {
+	n, err := strconv.ParseInt(id, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error converting cnpj %s to integer: %w", id, err)
+	}
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Get)
+	defer cancel()
+	rows, err := p.pool.Query(ctx, p.sql["history"], n)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for history of cnpj %d: %w", n, err)
+	}
+	vs, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (VersionedCompany, error) {
+		var v VersionedCompany
+		var s string
+		if err := r.Scan(&s, &v.ImportedAt); err != nil {
+			return v, err
+		}
+		v.JSON, err = decompressJSON(s)
+		return v, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history of cnpj %d: %w", n, err)
+	}
+	return vs, nil
+}
+
+// PruneHistory deletes the snapshots in the history table imported before a
+// given time, and returns how many were deleted.
+func (p *PostgreSQL) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	t, err := p.pool.Exec(ctx, p.sql["prune_history"], before)
+	if err != nil {
+		return 0, fmt.Errorf("error pruning history: %w", err)
+	}
+	return t.RowsAffected(), nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	importStatusKey     = "import_status"
+	importStatusRunning = "running"
+)
+
+// ErrImportInProgress is returned when an operation cannot run because an
+// import is in progress.
+var ErrImportInProgress = errors.New("import in progress")
+
+// ImportLock is a PostgreSQL session-level advisory lock held while importing
+// data. It holds a connection from the pool until it is released. In
+// `PgBouncerCompatible` mode there is no lock and releasing it does nothing.
+type ImportLock struct {
+	conn   *pgxpool.Conn
+	unlock string
+}
+
+// Release releases the advisory lock and returns its connection to the pool.
+func (l *ImportLock) Release(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	defer l.conn.Release()
+	if _, err := l.conn.Exec(ctx, l.unlock); err != nil {
+		return fmt.Errorf("error releasing the import lock: %w", err)
+	}
+	return nil
+}
+
+// AcquireImportLock acquires an advisory lock signaling that an import is
+// running. It does not wait: if the lock is already taken, it returns
+// `ErrImportInProgress`.
+func (p *PostgreSQL) AcquireImportLock(ctx context.Context) (*ImportLock, error) {
+	if p.pgBouncer {
+		p.log().WarnContext(ctx, "Skipping the import lock in PgBouncer compatible mode", "table", p.CompanyTableFullName())
+		return &ImportLock{}, nil
+	}
+	c, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error acquiring a database connection: %w", err)
+	}
+	var ok bool
+	if err := c.QueryRow(ctx, p.sql["import_lock"]).Scan(&ok); err != nil {
+		c.Release()
+		return nil, fmt.Errorf("error acquiring the import lock with: %s\n%w", p.sql["import_lock"], err)
+	}
+	if !ok {
+		c.Release()
+		return nil, ErrImportInProgress
+	}
+	return &ImportLock{c, p.sql["import_unlock"]}, nil
+}
+
+// SetImportStatus saves the import status to the metadata table.
+func (p *PostgreSQL) SetImportStatus(s string) error {
+	return p.MetaSave(importStatusKey, s)
+}
+
+// checkImportNotRunning returns `ErrImportInProgress` if an import is running.
+// With the import lock l held, no other import can be running (the advisory
+// lock is released even when an import crashes), so a running import status
+// in the metadata table is left by an interrupted import and only logged. In
+// `PgBouncerCompatible` mode there is no lock, so the import status is trusted
+// (a missing status or a missing metadata table means no import is running).
+func (p *PostgreSQL) checkImportNotRunning(ctx context.Context, l *ImportLock) error {
+	s, err := p.MetaRead(importStatusKey)
+	if err != nil || s != importStatusRunning {
+		return nil
+	}
+	if l.conn != nil {
+		p.log().WarnContext(ctx, "Ignoring the import status left by an interrupted import", "key", importStatusKey, "value", s, "table", p.MetaTableFullName())
+		return nil
+	}
+	return fmt.Errorf("%w: %s is set as %s in %s", ErrImportInProgress, importStatusKey, importStatusRunning, p.MetaTableFullName())
+}
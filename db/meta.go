@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// ExportMeta returns all the key/value pairs from the metadata table, e.g. to
+// copy the import dates and checksums when cloning a database.
+func (p *PostgreSQL) ExportMeta(ctx context.Context) (map[string]string, error) {
+	m, err := p.MetaAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting metadata: %w", err)
+	}
+	return m, nil
+}
+
+// ImportMeta saves key/value pairs (e.g. from `ExportMeta`) to the metadata
+// table, replacing the existing values of the same keys. All keys are
+// validated before saving any of them.
+func (p *PostgreSQL) ImportMeta(ctx context.Context, data map[string]string) error {
+	for k := range data {
+		if len(k) > 16 {
+			return fmt.Errorf("error importing metadata: key %s is longer than 16 chars", k)
+		}
+	}
+	for k, v := range data {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("error importing metadata: %w", err)
+		}
+		if err := p.MetaSave(k, v); err != nil {
+			return fmt.Errorf("error importing metadata: %w", err)
+		}
+	}
+	return nil
+}
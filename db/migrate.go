@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const schemaVersionKey = "schema_version"
+
+// Migration is a versioned change to the database schema (e.g. adding a
+// column or an index). `Up` applies the change and `Down` reverts it (`Down`
+// is optional, but required by `RollbackSchema`). Both run within a
+// transaction, together with the update of the schema version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, tx pgx.Tx) error
+	Down        func(ctx context.Context, tx pgx.Tx) error
+}
+
+// sortedMigrations validates the migrations and returns a copy of them sorted
+// by version.
+func sortedMigrations(ms []Migration) ([]Migration, error) {
+	s := make([]Migration, len(ms))
+	copy(s, ms)
+	sort.Slice(s, func(i, j int) bool { return s[i].Version < s[j].Version })
+	for i, m := range s {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q should have a positive version, got %d", m.Description, m.Version)
+		}
+		if i > 0 && s[i-1].Version == m.Version {
+			return nil, fmt.Errorf("more than one migration with version %d", m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d (%s) has no up function", m.Version, m.Description)
+		}
+	}
+	return s, nil
+}
+
+// SchemaVersion returns the version of the last migration applied by
+// `MigrateSchema`, or zero if no migration was applied.
+func (p *PostgreSQL) SchemaVersion(ctx context.Context) (int, error) {
+	rows, err := p.pool.Query(ctx, p.sql["meta_read"], schemaVersionKey)
+	if err != nil {
+		return 0, fmt.Errorf("error looking for the schema version: %w", err)
+	}
+	v, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading the schema version: %w", err)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing the schema version %q: %w", v, err)
+	}
+	return n, nil
+}
+
+// migrate runs a migration function and saves the new schema version within
+// the same transaction.
+func (p *PostgreSQL) migrate(ctx context.Context, fn func(context.Context, pgx.Tx) error, version int) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, p.sql["meta_save"], schemaVersionKey, strconv.Itoa(version)); err != nil {
+		return fmt.Errorf("error saving the schema version: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing the migration: %w", err)
+	}
+	return nil
+}
+
+// MigrateSchema applies, in order, the migrations with a version greater than
+// the current `SchemaVersion`. Each migration runs in its own transaction, so
+// if one fails, the schema is left at the version of the previous one.
+func (p *PostgreSQL) MigrateSchema(ctx context.Context, migrations []Migration) error {
+	ms, err := sortedMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	cur, err := p.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if m.Version <= cur {
+			continue
+		}
+		p.log().InfoContext(ctx, "Applying migration…", "version", m.Version, "description", m.Description)
+		if err := p.migrate(ctx, m.Up, m.Version); err != nil {
+			return fmt.Errorf("error applying migration %d (%s): %w", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
+
+// RollbackSchema reverts, in reverse order, the applied migrations with a
+// version greater than targetVersion, using their `Down` function. Each
+// migration runs in its own transaction. The migrations are required because
+// only their versions are saved in the database.
+func (p *PostgreSQL) RollbackSchema(ctx context.Context, migrations []Migration, targetVersion int) error {
+	ms, err := sortedMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	cur, err := p.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(ms) - 1; i >= 0; i-- {
+		m := ms[i]
+		if m.Version > cur || m.Version <= targetVersion {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %d (%s) has no down function", m.Version, m.Description)
+		}
+		var prev int
+		if i > 0 {
+			prev = ms[i-1].Version
+		}
+		p.log().InfoContext(ctx, "Reverting migration…", "version", m.Version, "description", m.Description)
+		if err := p.migrate(ctx, m.Down, prev); err != nil {
+			return fmt.Errorf("error reverting migration %d (%s): %w", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
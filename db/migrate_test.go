@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestSortedMigrations(t *testing.T) {
+	up := func(context.Context, pgx.Tx) error { return nil }
+	ms, err := sortedMigrations([]Migration{{Version: 2, Up: up}, {Version: 1, Up: up}, {Version: 42, Up: up}})
+	if err != nil {
+		t.Fatalf("expected no error sorting migrations, got %s", err)
+	}
+	for i, v := range []int{1, 2, 42} {
+		if ms[i].Version != v {
+			t.Errorf("expected migration %d to have version %d, got %d", i, v, ms[i].Version)
+		}
+	}
+	for _, c := range []struct {
+		desc       string
+		migrations []Migration
+	}{
+		{"duplicated version", []Migration{{Version: 1, Up: up}, {Version: 1, Up: up}}},
+		{"zero version", []Migration{{Version: 0, Up: up}}},
+		{"negative version", []Migration{{Version: -1, Up: up}}},
+		{"no up function", []Migration{{Version: 1}}},
+	} {
+		if _, err := sortedMigrations(c.migrations); err == nil {
+			t.Errorf("expected an error with %s, got nil", c.desc)
+		}
+	}
+}
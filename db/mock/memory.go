@@ -0,0 +1,356 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// ErrNotFound is returned by `InMemoryStore` when a company or a metadata key
+// does not exist.
+var ErrNotFound = errors.New("not found")
+
+// InMemoryStore is a `Store` keeping the companies and the metadata in maps,
+// allowing tests of the web API without a database. It is safe for concurrent
+// use.
+type InMemoryStore struct {
+	mutex     sync.RWMutex
+	companies map[string]string
+	meta      map[string]string
+}
+
+// NewInMemoryStore creates an `InMemoryStore` with companies (the JSON of each
+// company indexed by the 14-digit CNPJ).
+func NewInMemoryStore(companies map[string]string) *InMemoryStore {
+	s := InMemoryStore{companies: make(map[string]string), meta: make(map[string]string)}
+	for k, v := range companies {
+		s.companies[k] = v
+	}
+	return &s
+}
+
+// SetCompany creates or replaces the JSON of a company.
+func (s *InMemoryStore) SetCompany(id, j string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.companies[id] = j
+}
+
+// CreateCompanies saves a batch in the format used by
+// `db.PostgreSQL.CreateCompanies`: rows with the CNPJ (as an integer or as a
+// string) and the JSON of the company.
+func (s *InMemoryStore) CreateCompanies(batch [][]any) error {
+	cs := make(map[string]string, len(batch))
+	for i, r := range batch {
+		if len(r) != 2 {
+			return fmt.Errorf("row %d should have 2 columns, got %d", i, len(r))
+		}
+		var id string
+		switch v := r[0].(type) {
+		case int64:
+			id = fmt.Sprintf("%014d", v)
+		case string:
+			id = v
+		default:
+			return fmt.Errorf("row %d has an invalid cnpj: %v", i, r[0])
+		}
+		j, ok := r[1].(string)
+		if !ok || !json.Valid([]byte(j)) {
+			return fmt.Errorf("%w: cnpj %s", db.ErrMalformedData, id)
+		}
+		cs[id] = j
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, j := range cs {
+		s.companies[id] = j
+	}
+	return nil
+}
+
+// MetaSave sets a metadata key. As in `db.PostgreSQL.MetaSave`, keys are
+// limited to 16 chars.
+func (s *InMemoryStore) MetaSave(k, v string) error {
+	if len(k) > 16 {
+		return fmt.Errorf("metatable can only take keys that are at maximum 16 chars long")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.meta[k] = v
+	return nil
+}
+
+func (s *InMemoryStore) GetCompany(_ context.Context, id string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	j, ok := s.companies[id]
+	if !ok {
+		return "", fmt.Errorf("%w: cnpj %s", ErrNotFound, id)
+	}
+	return j, nil
+}
+
+func (s *InMemoryStore) GetCompanyRaw(ctx context.Context, id string) ([]byte, error) {
+	j, err := s.GetCompany(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(j), nil
+}
+
+func (s *InMemoryStore) GetCompanyExcludeFields(ctx context.Context, id string, fs []string) (string, error) {
+	j, err := s.GetCompany(ctx, id)
+	if err != nil || len(fs) == 0 {
+		return j, err
+	}
+	var c map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(j), &c); err != nil {
+		return "", fmt.Errorf("%w: cnpj %s", db.ErrMalformedData, id)
+	}
+	for _, f := range fs {
+		if _, ok := c[f]; !ok {
+			return "", fmt.Errorf("%w: %s", db.ErrUnknownField, f)
+		}
+		delete(c, f)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (s *InMemoryStore) MetaRead(k string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	v, ok := s.meta[k]
+	if !ok {
+		return "", fmt.Errorf("%w: metadata key %s", ErrNotFound, k)
+	}
+	return v, nil
+}
+
+func (s *InMemoryStore) GetImportSource(_ context.Context) (db.ImportSource, error) {
+	return db.ImportSource{}, fmt.Errorf("%w: import source", ErrNotFound)
+}
+
+func (s *InMemoryStore) TableSize(_ context.Context) (db.TableSizeInfo, error) {
+	return db.TableSizeInfo{}, nil
+}
+
+func (s *InMemoryStore) MetaAll(_ context.Context) (map[string]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	m := make(map[string]string, len(s.meta))
+	for k, v := range s.meta {
+		m[k] = v
+	}
+	return m, nil
+}
+
+func (s *InMemoryStore) PoolStats() db.PoolStats { return db.PoolStats{} }
+
+func (s *InMemoryStore) RowCountApproximate(ctx context.Context) (int64, error) {
+	return s.RowCountExact(ctx)
+}
+
+func (s *InMemoryStore) RowCountExact(_ context.Context) (int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return int64(len(s.companies)), nil
+}
+
+// TestConnection never fails, since there is no database to connect to.
+func (s *InMemoryStore) TestConnection(_ context.Context) error {
+	return nil
+}
+
+// TableExists is true for any table, since there are no tables to create.
+func (s *InMemoryStore) TableExists(_ context.Context, _ string) (bool, error) {
+	return true, nil
+}
+
+func (s *InMemoryStore) CacheStats() db.CacheStatistics { return db.CacheStatistics{} }
+
+func (s *InMemoryStore) GetCompanyHistory(_ context.Context, _ string) ([]db.VersionedCompany, error) {
+	return []db.VersionedCompany{}, nil
+}
+
+func (s *InMemoryStore) GetImportReport(_ context.Context) (db.ImportReport, error) {
+	return db.ImportReport{}, fmt.Errorf("%w: import report", ErrNotFound)
+}
+
+// Listen blocks until the context is cancelled, since there are no updates.
+func (s *InMemoryStore) Listen(ctx context.Context, _ string, _ func(string)) error {
+	<-ctx.Done()
+	return nil
+}
+
+// countBy counts the companies by the value of a field of their JSON (an empty
+// string for companies without the field).
+func (s *InMemoryStore) countBy(field string) (map[string]int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	counts := make(map[string]int64)
+	for id, j := range s.companies {
+		var c map[string]any
+		if err := json.Unmarshal([]byte(j), &c); err != nil {
+			return nil, fmt.Errorf("%w: cnpj %s", db.ErrMalformedData, id)
+		}
+		var v string
+		if f, ok := c[field]; ok && f != nil {
+			v = fmt.Sprint(f)
+		}
+		counts[v]++
+	}
+	return counts, nil
+}
+
+// CountByField counts the values of a field in the JSON of all companies, using
+// the same rules as `db.PostgreSQL.CountByField`.
+func (s *InMemoryStore) CountByField(_ context.Context, field string, topN int) ([]db.FieldCount, error) {
+	if !slices.Contains(db.AnalyticsFields, field) {
+		return nil, fmt.Errorf("%w: %s", db.ErrUnknownField, field)
+	}
+	if topN < 1 {
+		return nil, fmt.Errorf("%w: %d", db.ErrInvalidTopN, topN)
+	}
+	counts, err := s.countBy(field)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]db.FieldCount, 0, len(counts))
+	for v, n := range counts {
+		r = append(r, db.FieldCount{Value: v, Count: n})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Count == r[j].Count {
+			return r[i].Value < r[j].Value
+		}
+		return r[i].Count > r[j].Count
+	})
+	if len(r) > topN {
+		r = r[:topN]
+	}
+	return r, nil
+}
+
+// StatusDistribution counts the companies by situacao_cadastral, using the
+// same rules as `db.PostgreSQL.StatusDistribution`.
+func (s *InMemoryStore) StatusDistribution(_ context.Context) (map[string]int64, error) {
+	return s.countBy("situacao_cadastral")
+}
+
+// GetCompaniesByBasePaged pages the companies whose CNPJ starts with base in
+// CNPJ order, using the same cursor rules as
+// `db.PostgreSQL.GetCompaniesByBasePaged`.
+func (s *InMemoryStore) GetCompaniesByBasePaged(_ context.Context, base string, pageSize int, cursor int64) ([]string, int64, error) {
+	if len(base) != 8 || pageSize < 1 {
+		return nil, 0, fmt.Errorf("invalid base cnpj %s or page size %d", base, pageSize)
+	}
+	c := fmt.Sprintf("%014d", cursor)
+	if cursor != 0 && c[:8] != base {
+		return nil, 0, fmt.Errorf("%w: %d is not a cnpj with base %s", db.ErrInvalidCursor, cursor, base)
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var ids []string
+	for id := range s.companies {
+		if strings.HasPrefix(id, base) && (cursor == 0 || id > c) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	var next int64
+	if len(ids) > pageSize {
+		ids = ids[:pageSize]
+		n, err := strconv.ParseInt(ids[pageSize-1], 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error converting cnpj %s to integer: %w", ids[pageSize-1], err)
+		}
+		next = n
+	}
+	r := make([]string, len(ids))
+	for i, id := range ids {
+		r[i] = s.companies[id]
+	}
+	return r, next, nil
+}
+
+// UpdateCompaniesFromReader merges the data of each line of the JSONL (in the
+// format of `db.PostgreSQL.UpdateCompaniesFromReader`) in the JSON of all the
+// companies with the same base CNPJ. The stream is validated before any
+// company is changed.
+func (s *InMemoryStore) UpdateCompaniesFromReader(_ context.Context, r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("error reading updates: %w", err)
+	}
+	n, err := db.ValidateUpdates(bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, l := range bytes.Split(b, []byte("\n")) {
+		if len(l) == 0 {
+			continue
+		}
+		var u struct {
+			BaseCNPJ string                     `json:"cnpj_basico"`
+			Data     map[string]json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(l, &u); err != nil {
+			return 0, fmt.Errorf("error decoding update: %w", err)
+		}
+		for id, j := range s.companies {
+			if !strings.HasPrefix(id, u.BaseCNPJ) {
+				continue
+			}
+			var c map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(j), &c); err != nil {
+				return 0, fmt.Errorf("%w: cnpj %s", db.ErrMalformedData, id)
+			}
+			for k, v := range u.Data {
+				c[k] = v
+			}
+			m, err := json.Marshal(c)
+			if err != nil {
+				return 0, fmt.Errorf("error serializing cnpj %s: %w", id, err)
+			}
+			s.companies[id] = string(m)
+		}
+	}
+	return n, nil
+}
+
+// importStatusKey is the metadata key used by `db.PostgreSQL.SetImportStatus`.
+const importStatusKey = "import_status"
+
+// AcquireImportLock emulates the advisory lock of
+// `db.PostgreSQL.AcquireImportLock`: as there is no database session to hold
+// it, the lock is taken while the import status (see `SetImportStatus`) is
+// running, returning `db.ErrImportInProgress`. The returned lock does nothing
+// when released.
+func (s *InMemoryStore) AcquireImportLock(_ context.Context) (*db.ImportLock, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.meta[importStatusKey] == "running" {
+		return nil, db.ErrImportInProgress
+	}
+	return &db.ImportLock{}, nil
+}
+
+func (s *InMemoryStore) SetImportStatus(v string) error {
+	return s.MetaSave(importStatusKey, v)
+}
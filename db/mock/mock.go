@@ -0,0 +1,212 @@
+// Package mock provides test doubles for the database layer.
+package mock
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// Store is the set of read methods used by the web API, implemented by
+// `db.PostgreSQL`.
+type Store interface {
+	GetCompany(context.Context, string) (string, error)
+	GetCompanyRaw(context.Context, string) ([]byte, error)
+	GetCompanyExcludeFields(context.Context, string, []string) (string, error)
+	MetaRead(string) (string, error)
+	GetImportSource(context.Context) (db.ImportSource, error)
+	TableSize(context.Context) (db.TableSizeInfo, error)
+	MetaAll(context.Context) (map[string]string, error)
+	PoolStats() db.PoolStats
+	RowCountApproximate(context.Context) (int64, error)
+	RowCountExact(context.Context) (int64, error)
+	TableExists(context.Context, string) (bool, error)
+	TestConnection(context.Context) error
+	CacheStats() db.CacheStatistics
+	GetCompanyHistory(context.Context, string) ([]db.VersionedCompany, error)
+	GetImportReport(context.Context) (db.ImportReport, error)
+	Listen(context.Context, string, func(string)) error
+	CountByField(context.Context, string, int) ([]db.FieldCount, error)
+	StatusDistribution(context.Context) (map[string]int64, error)
+	GetCompaniesByBasePaged(context.Context, string, int, int64) ([]string, int64, error)
+	MetaSave(string, string) error
+	UpdateCompaniesFromReader(context.Context, io.Reader) (int64, error)
+	AcquireImportLock(context.Context) (*db.ImportLock, error)
+	SetImportStatus(string) error
+}
+
+// MethodCall is a call to a method of a `RecordingStore`. The context is not
+// included in the arguments.
+type MethodCall struct {
+	Method string
+	Args   []any
+	Time   time.Time
+}
+
+// RecordingStore wraps a `Store` recording every method call, so tests can
+// assert how the database layer was used. It is safe for concurrent use.
+type RecordingStore struct {
+	store Store
+	mutex sync.Mutex
+	calls []MethodCall
+}
+
+// NewRecordingStore creates a `RecordingStore` wrapping s.
+func NewRecordingStore(s Store) *RecordingStore {
+	return &RecordingStore{store: s}
+}
+
+func (r *RecordingStore) record(m string, args ...any) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, MethodCall{m, args, time.Now()})
+}
+
+// Calls returns all the method calls recorded, in order.
+func (r *RecordingStore) Calls() []MethodCall {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	c := make([]MethodCall, len(r.calls))
+	copy(c, r.calls)
+	return c
+}
+
+// CallsTo returns the calls recorded to a given method, in order.
+func (r *RecordingStore) CallsTo(method string) []MethodCall {
+	var c []MethodCall
+	for _, m := range r.Calls() {
+		if m.Method == method {
+			c = append(c, m)
+		}
+	}
+	return c
+}
+
+// Reset discards all the method calls recorded so far.
+func (r *RecordingStore) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = nil
+}
+
+// The `Store` methods record the call and then call the wrapped store.
+
+func (r *RecordingStore) GetCompany(ctx context.Context, id string) (string, error) {
+	r.record("GetCompany", id)
+	return r.store.GetCompany(ctx, id)
+}
+
+func (r *RecordingStore) GetCompanyRaw(ctx context.Context, id string) ([]byte, error) {
+	r.record("GetCompanyRaw", id)
+	return r.store.GetCompanyRaw(ctx, id)
+}
+
+func (r *RecordingStore) GetCompanyExcludeFields(ctx context.Context, id string, fs []string) (string, error) {
+	r.record("GetCompanyExcludeFields", id, fs)
+	return r.store.GetCompanyExcludeFields(ctx, id, fs)
+}
+
+func (r *RecordingStore) MetaRead(k string) (string, error) {
+	r.record("MetaRead", k)
+	return r.store.MetaRead(k)
+}
+
+func (r *RecordingStore) GetImportSource(ctx context.Context) (db.ImportSource, error) {
+	r.record("GetImportSource")
+	return r.store.GetImportSource(ctx)
+}
+
+func (r *RecordingStore) TableSize(ctx context.Context) (db.TableSizeInfo, error) {
+	r.record("TableSize")
+	return r.store.TableSize(ctx)
+}
+
+func (r *RecordingStore) MetaAll(ctx context.Context) (map[string]string, error) {
+	r.record("MetaAll")
+	return r.store.MetaAll(ctx)
+}
+
+func (r *RecordingStore) PoolStats() db.PoolStats {
+	r.record("PoolStats")
+	return r.store.PoolStats()
+}
+
+func (r *RecordingStore) RowCountApproximate(ctx context.Context) (int64, error) {
+	r.record("RowCountApproximate")
+	return r.store.RowCountApproximate(ctx)
+}
+
+func (r *RecordingStore) RowCountExact(ctx context.Context) (int64, error) {
+	r.record("RowCountExact")
+	return r.store.RowCountExact(ctx)
+}
+
+func (r *RecordingStore) TestConnection(ctx context.Context) error {
+	r.record("TestConnection")
+	return r.store.TestConnection(ctx)
+}
+
+func (r *RecordingStore) TableExists(ctx context.Context, name string) (bool, error) {
+	r.record("TableExists", name)
+	return r.store.TableExists(ctx, name)
+}
+
+func (r *RecordingStore) CacheStats() db.CacheStatistics {
+	r.record("CacheStats")
+	return r.store.CacheStats()
+}
+
+func (r *RecordingStore) GetCompanyHistory(ctx context.Context, id string) ([]db.VersionedCompany, error) {
+	r.record("GetCompanyHistory", id)
+	return r.store.GetCompanyHistory(ctx, id)
+}
+
+func (r *RecordingStore) GetImportReport(ctx context.Context) (db.ImportReport, error) {
+	r.record("GetImportReport")
+	return r.store.GetImportReport(ctx)
+}
+
+func (r *RecordingStore) Listen(ctx context.Context, channel string, handler func(string)) error {
+	r.record("Listen", channel)
+	return r.store.Listen(ctx, channel, handler)
+}
+
+func (r *RecordingStore) CountByField(ctx context.Context, field string, topN int) ([]db.FieldCount, error) {
+	r.record("CountByField", field, topN)
+	return r.store.CountByField(ctx, field, topN)
+}
+
+func (r *RecordingStore) StatusDistribution(ctx context.Context) (map[string]int64, error) {
+	r.record("StatusDistribution")
+	return r.store.StatusDistribution(ctx)
+}
+
+func (r *RecordingStore) GetCompaniesByBasePaged(ctx context.Context, base string, pageSize int, cursor int64) ([]string, int64, error) {
+	r.record("GetCompaniesByBasePaged", base, pageSize, cursor)
+	return r.store.GetCompaniesByBasePaged(ctx, base, pageSize, cursor)
+}
+
+func (r *RecordingStore) MetaSave(k, v string) error {
+	r.record("MetaSave", k, v)
+	return r.store.MetaSave(k, v)
+}
+
+// UpdateCompaniesFromReader records the call without the reader, which is
+// consumed by the wrapped store.
+func (r *RecordingStore) UpdateCompaniesFromReader(ctx context.Context, rd io.Reader) (int64, error) {
+	r.record("UpdateCompaniesFromReader")
+	return r.store.UpdateCompaniesFromReader(ctx, rd)
+}
+
+func (r *RecordingStore) AcquireImportLock(ctx context.Context) (*db.ImportLock, error) {
+	r.record("AcquireImportLock")
+	return r.store.AcquireImportLock(ctx)
+}
+
+func (r *RecordingStore) SetImportStatus(s string) error {
+	r.record("SetImportStatus", s)
+	return r.store.SetImportStatus(s)
+}
@@ -0,0 +1,119 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// check that the real database can be wrapped
+var _ Store = &db.PostgreSQL{}
+
+type fakeStore struct{ Store }
+
+func (fakeStore) GetCompany(_ context.Context, id string) (string, error) {
+	return `{"cnpj":"` + id + `"}`, nil
+}
+
+func (fakeStore) MetaRead(_ string) (string, error) { return "42", nil }
+
+func TestRecordingStore(t *testing.T) {
+	r := NewRecordingStore(fakeStore{})
+	var wg sync.WaitGroup
+	for i := 0; i < 42; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.GetCompany(context.Background(), "19131243000197")
+		}()
+	}
+	wg.Wait()
+	if got, err := r.MetaRead("updated-at"); err != nil || got != "42" {
+		t.Errorf("expected the wrapped store response, got %s and %v", got, err)
+	}
+	if n := len(r.Calls()); n != 43 {
+		t.Errorf("expected 43 calls, got %d", n)
+	}
+	c := r.CallsTo("MetaRead")
+	if len(c) != 1 || !reflect.DeepEqual(c[0].Args, []any{"updated-at"}) || c[0].Time.IsZero() {
+		t.Errorf("expected one call to MetaRead with updated-at, got %+v", c)
+	}
+	if n := len(r.CallsTo("GetCompany")); n != 42 {
+		t.Errorf("expected 42 calls to GetCompany, got %d", n)
+	}
+	r.Reset()
+	if n := len(r.Calls()); n != 0 {
+		t.Errorf("expected no calls after reset, got %d", n)
+	}
+}
+
+// check that the in-memory store implements the whole interface
+var _ Store = &InMemoryStore{}
+
+func TestInMemoryStore(t *testing.T) {
+	s := NewInMemoryStore(map[string]string{"19131243000197": `{"cnpj":"19131243000197","qsa":[]}`})
+	if _, err := s.GetCompany(context.Background(), "00000000000191"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown company, got %v", err)
+	}
+	got, err := s.GetCompanyExcludeFields(context.Background(), "19131243000197", []string{"qsa"})
+	if err != nil || got != `{"cnpj":"19131243000197"}` {
+		t.Errorf("expected company without qsa, got %s and %v", got, err)
+	}
+	if _, err := s.GetCompanyExcludeFields(context.Background(), "19131243000197", []string{"answer"}); !errors.Is(err, db.ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField, got %v", err)
+	}
+	s.MetaSave("updated-at", "2023-01-01")
+	if got, err := s.MetaRead("updated-at"); err != nil || got != "2023-01-01" {
+		t.Errorf("expected the metadata saved, got %s and %v", got, err)
+	}
+	if n, err := s.RowCountExact(context.Background()); err != nil || n != 1 {
+		t.Errorf("expected 1 company, got %d and %v", n, err)
+	}
+	s.SetCompany("33683111000280", `{"cnpj":"33683111000280","uf":"DF"}`)
+	c, err := s.CountByField(context.Background(), "uf", 10)
+	if err != nil || len(c) != 2 || c[0] != (db.FieldCount{Value: "", Count: 1}) || c[1] != (db.FieldCount{Value: "DF", Count: 1}) {
+		t.Errorf("expected 1 company without uf and 1 in DF, got %v and %v", c, err)
+	}
+	if _, err := s.CountByField(context.Background(), "email", 10); !errors.Is(err, db.ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField, got %v", err)
+	}
+	s.SetCompany("33683111000280", `{"cnpj":"33683111000280","situacao_cadastral":2}`)
+	d, err := s.StatusDistribution(context.Background())
+	if err != nil || len(d) != 2 || d["2"] != 1 || d[""] != 1 {
+		t.Errorf("expected 1 active company and 1 without status, got %v and %v", d, err)
+	}
+	s.SetCompany("19131243000278", `{"cnpj":"19131243000278"}`)
+	p, next, err := s.GetCompaniesByBasePaged(context.Background(), "19131243", 1, 0)
+	if err != nil || len(p) != 1 || next != 19131243000197 {
+		t.Errorf("expected the first venue and a next cursor, got %v, %d and %v", p, next, err)
+	}
+	p, next, err = s.GetCompaniesByBasePaged(context.Background(), "19131243", 1, next)
+	if err != nil || len(p) != 1 || p[0] != `{"cnpj":"19131243000278"}` || next != 0 {
+		t.Errorf("expected the last venue and no next cursor, got %v, %d and %v", p, next, err)
+	}
+	if _, _, err := s.GetCompaniesByBasePaged(context.Background(), "19131243", 1, 33683111000280); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+	n, err := s.UpdateCompaniesFromReader(context.Background(), strings.NewReader(`{"cnpj_basico": "19131243", "data": {"answer": 42}}`))
+	if err != nil || n != 1 {
+		t.Errorf("expected 1 record processed, got %d and %v", n, err)
+	}
+	if got, err := s.GetCompany(context.Background(), "19131243000278"); err != nil || got != `{"answer":42,"cnpj":"19131243000278"}` {
+		t.Errorf("expected the updated company, got %s and %v", got, err)
+	}
+	if _, err := s.UpdateCompaniesFromReader(context.Background(), strings.NewReader(`{"cnpj_basico": "42", "data": {}}`)); err == nil {
+		t.Error("expected an error for an invalid base cnpj, got nil")
+	}
+	if _, err := s.AcquireImportLock(context.Background()); err != nil {
+		t.Errorf("expected the import lock, got %v", err)
+	}
+	s.SetImportStatus("running")
+	if _, err := s.AcquireImportLock(context.Background()); !errors.Is(err, db.ErrImportInProgress) {
+		t.Errorf("expected ErrImportInProgress while an import is running, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Listen subscribes to a PostgreSQL notification channel (e.g.
+// `UpdatesChannel`, notified with the CNPJ of each company changed by
+// `UpsertCompanies`) and calls handler with the payload of each notification.
+// It holds a connection from the pool until the context is cancelled. It
+// returns `ErrPgBouncerUnsupported` in `PgBouncerCompatible` mode.
+func (p *PostgreSQL) Listen(ctx context.Context, channel string, handler func(cnpj string)) error {
+	if p.pgBouncer {
+		return fmt.Errorf("listening to %s %w", channel, ErrPgBouncerUnsupported)
+	}
+	c, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring a database connection: %w", err)
+	}
+	defer c.Release()
+	if _, err := c.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("error listening to %s: %w", channel, err)
+	}
+	defer c.Exec(context.Background(), "UNLISTEN *")
+	for {
+		n, err := c.Conn().WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error waiting for notifications from %s: %w", channel, err)
+		}
+		handler(n.Payload)
+	}
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// rangeFor returns the first and the last IDs of the venues of a company,
+// given its base CNPJ (the first 8 digits).
+func rangeFor(base string) (int64, int64, error) {
+	if len(base) != 8 {
+		return 0, 0, fmt.Errorf("base cnpj %q should have 8 digits", base)
+	}
+	for _, c := range base {
+		if c < '0' || c > '9' {
+			return 0, 0, fmt.Errorf("base cnpj %q should have only digits", base)
+		}
+	}
+	n, err := strconv.ParseInt(base, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error converting base cnpj %s to integer: %w", base, err)
+	}
+	return n * 1000000, n*1000000 + 999999, nil
+}
+
+// partnersRow validates a row of `AddPartners`, returning the range of IDs of
+// the venues of the company. It returns false (and logs a warning) if the row
+// should be skipped.
+func (p *PostgreSQL) partnersRow(v []string) (int64, int64, bool) {
+	if len(v) != 2 {
+		p.log().Warn("Skipping partners row without 2 items", "items", len(v))
+		return 0, 0, false
+	}
+	first, last, err := rangeFor(v[0])
+	if err != nil {
+		p.log().Warn("Skipping partners of invalid base cnpj", "error", err)
+		return 0, 0, false
+	}
+	var qsa []json.RawMessage
+	if err := json.Unmarshal([]byte(v[1]), &qsa); err != nil {
+		p.log().Warn("Skipping partners that are not a json array", "base_cnpj", v[0], "error", err)
+		return 0, 0, false
+	}
+	if p.MaxPartnersPerCompany > 0 && len(qsa) > p.MaxPartnersPerCompany {
+		p.log().Warn("Skipping partners above the maximum per company", "base_cnpj", v[0], "partners", len(qsa), "max", p.MaxPartnersPerCompany)
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// AddPartners replaces the partners (QSA) of all the venues of companies. It
+// expects an array and each item should be another array with only two items:
+// the base CNPJ (first 8 digits) and the JSON array of partners. Rows with
+// invalid data, or with more than `MaxPartnersPerCompany` partners, are skipped
+// (and logged) instead of failing the batch. It does not work with compressed
+// JSON (see `ErrCompressedJSON`).
+func (p *PostgreSQL) AddPartners(ctx context.Context, batch [][]string) (int64, error) {
+	if p.CompressJSON {
+		return 0, ErrCompressedJSON
+	}
+	var firsts, lasts []int64
+	var qsas []string
+	for _, v := range batch {
+		first, last, ok := p.partnersRow(v)
+		if !ok {
+			continue
+		}
+		firsts = append(firsts, first)
+		lasts = append(lasts, last)
+		qsas = append(qsas, v[1])
+	}
+	if len(qsas) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Update)
+	defer cancel()
+	var n, compressed int64
+	if err := p.pool.QueryRow(ctx, p.sql["add_partners"], firsts, lasts, qsas).Scan(&n, &compressed); err != nil {
+		return 0, fmt.Errorf("error adding partners: %w", err)
+	}
+	if compressed > 0 {
+		return n, errCompressedRows(compressed)
+	}
+	return n, nil
+}
+
+// ReplacePartners replaces the partners (QSA) of all the venues of a company,
+// given its base CNPJ (first 8 digits) and the JSON array of partners, in a
+// single statement, so no venue is left with the old partners. Unlike
+// `AddPartners`, invalid data returns an error instead of being skipped. It
+// does not work with compressed JSON (see `ErrCompressedJSON`).
+func (p *PostgreSQL) ReplacePartners(ctx context.Context, baseID, partnersJSON string) error {
+	if p.CompressJSON {
+		return ErrCompressedJSON
+	}
+	first, last, err := rangeFor(baseID)
+	if err != nil {
+		return err
+	}
+	var qsa []json.RawMessage
+	if err := json.Unmarshal([]byte(partnersJSON), &qsa); err != nil {
+		return fmt.Errorf("partners of base cnpj %s should be a json array: %w", baseID, err)
+	}
+	if p.MaxPartnersPerCompany > 0 && len(qsa) > p.MaxPartnersPerCompany {
+		return fmt.Errorf("base cnpj %s has %d partners, more than the maximum of %d", baseID, len(qsa), p.MaxPartnersPerCompany)
+	}
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Update)
+	defer cancel()
+	var n, compressed int64
+	if err := p.pool.QueryRow(ctx, p.sql["add_partners"], []int64{first}, []int64{last}, []string{partnersJSON}).Scan(&n, &compressed); err != nil {
+		return fmt.Errorf("error replacing partners of base cnpj %s: %w", baseID, err)
+	}
+	if compressed > 0 {
+		return fmt.Errorf("error replacing partners of base cnpj %s: %w", baseID, errCompressedRows(compressed))
+	}
+	return nil
+}
+
+// DeletePartners removes the partners (QSA) of all the venues of a company,
+// given its base CNPJ (first 8 digits), setting them to an empty array.
+func (p *PostgreSQL) DeletePartners(ctx context.Context, baseID string) error {
+	if err := p.ReplacePartners(ctx, baseID, "[]"); err != nil {
+		return fmt.Errorf("error deleting partners: %w", err)
+	}
+	return nil
+}
+
+// TrimPartners keeps only the first `maxPerCompany` partners of companies
+// with more partners than that (usually a sign of bad data), and returns how
+// many companies were changed.
+func (p *PostgreSQL) TrimPartners(ctx context.Context, maxPerCompany int) (int64, error) {
+	if maxPerCompany <= 0 {
+		return 0, fmt.Errorf("maximum number of partners should be positive, got %d", maxPerCompany)
+	}
+	r, err := p.pool.Exec(ctx, p.sql["trim_partners"], maxPerCompany)
+	if err != nil {
+		return 0, fmt.Errorf("error trimming partners: %w", err)
+	}
+	return r.RowsAffected(), nil
+}
+
+// PartnersTableFullName is the name of the schame and table in dot-notation
+// (or only the table name when using the search_path).
+func (p *PostgreSQL) PartnersTableFullName() string {
+	if p.useSearchPath {
+		return p.PartnersTableName
+	}
+	return fmt.Sprintf("%s.%s", p.schema, p.PartnersTableName)
+}
+
+// BackfillPartnersIndex (re-)creates the partners table from the partners
+// (QSA) in the JSON of the companies, with one row per base CNPJ, CPF (or CNPJ)
+// and name of the partner. Looking up companies by partner in this table (see
+// `GetCompaniesByPartnerCPF`) does not require a GIN index on the whole JSON.
+// It returns the number of rows in the partners table.
+func (p *PostgreSQL) BackfillPartnersIndex(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Index)
+	defer cancel()
+	p.log().InfoContext(ctx, "Filling partners table…", "table", p.PartnersTableFullName())
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, p.sql["truncate_partners"]); err != nil {
+		return 0, fmt.Errorf("error truncating %s: %w", p.PartnersTableFullName(), err)
+	}
+	r, err := tx.Exec(ctx, p.sql["backfill_partners"])
+	if err != nil {
+		return 0, fmt.Errorf("error filling %s: %w", p.PartnersTableFullName(), err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing %s: %w", p.PartnersTableFullName(), err)
+	}
+	return r.RowsAffected(), nil
+}
+
+// GetCompaniesByPartnerCPF returns the JSON of all the venues of companies
+// that have a partner with the given CPF, using the table filled by
+// `BackfillPartnersIndex`. As in `SearchByPartner`, the CPF is matched by its
+// 6 middle digits, the only ones published by the Federal Revenue.
+func (p *PostgreSQL) GetCompaniesByPartnerCPF(ctx context.Context, cpf string) ([]string, error) {
+	c, err := partnerCPF(cpf)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Get)
+	defer cancel()
+	rows, err := p.pool.Query(ctx, p.sql["companies_by_partner_cpf"], c)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for companies of partner %s: %w", c, err)
+	}
+	r, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error reading companies of partner %s: %w", c, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPartnersRow(t *testing.T) {
+	p := PostgreSQL{MaxPartnersPerCompany: 2}
+	for _, c := range []struct {
+		row      []string
+		expected bool
+	}{
+		{[]string{"19131243", `[{"nome_socio": "A"}]`}, true},
+		{[]string{"19131243", `[]`}, true},
+		{[]string{"19131243", `[{}, {}, {}]`}, false},
+		{[]string{"19131243", `{"nome_socio": "A"}`}, false},
+		{[]string{"19131243", "forty-two"}, false},
+		{[]string{"forty-two", "[]"}, false},
+		{[]string{"19131243"}, false},
+	} {
+		if _, _, got := p.partnersRow(c.row); got != c.expected {
+			t.Errorf("expected %t for %q, got %t", c.expected, c.row, got)
+		}
+	}
+	var b bytes.Buffer
+	p.logger = slog.New(slog.NewTextHandler(&b, nil))
+	p.partnersRow([]string{"19131243", `[{}, {}, {}]`})
+	if got := b.String(); !strings.Contains(got, "level=WARN") || !strings.Contains(got, "base_cnpj=19131243") {
+		t.Errorf("expected a warning with the base cnpj in the logger, got %s", got)
+	}
+	p.MaxPartnersPerCompany = 0
+	if _, _, ok := p.partnersRow([]string{"19131243", `[{}, {}, {}]`}); !ok {
+		t.Error("expected no limit of partners with 0")
+	}
+}
+
+func FuzzRangeFor(f *testing.F) {
+	for _, s := range []string{"19131243", "00000000", "99999999", "19131243000197", "19.131.243", "", "1913124ç", "+1913124", "-1913124", "99999999999999999999"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		first, last, err := rangeFor(s)
+		if err != nil {
+			return
+		}
+		if len(s) != 8 {
+			t.Errorf("expected an error for %q, which does not have 8 bytes", s)
+		}
+		if first < 0 || first%1000000 != 0 || last-first != 999999 {
+			t.Errorf("expected a range of 1,000,000 ids for %q, got %d to %d", s, first, last)
+		}
+	})
+}
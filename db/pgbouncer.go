@@ -0,0 +1,26 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPgBouncerUnsupported is returned by operations that depend on the state
+// of a database session, which is not kept in `PgBouncerCompatible` mode.
+var ErrPgBouncerUnsupported = errors.New("not supported in pgbouncer compatible mode")
+
+// validatePgBouncerConfig rejects settings that rely on the state of each
+// connection, since PgBouncer in transaction mode might run each transaction
+// in a different server connection.
+func validatePgBouncerConfig(cfg PostgreSQLConfig) error {
+	if !cfg.PgBouncerCompatible {
+		return nil
+	}
+	if cfg.PrepareStatements {
+		return fmt.Errorf("prepared statements %w", ErrPgBouncerUnsupported)
+	}
+	if cfg.UseSearchPath {
+		return fmt.Errorf("search path %w", ErrPgBouncerUnsupported)
+	}
+	return nil
+}
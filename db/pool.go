@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WarmPool opens the minimum number of connections of the pool (MinConns, set
+// with pool_min_conns in the URI) concurrently, so the first requests do not
+// all pay for opening connections at the same time. It returns the first
+// error opening a connection.
+func (p *PostgreSQL) WarmPool(ctx context.Context) error {
+	n := int(p.pool.Config().MinConns)
+	if n == 0 {
+		return nil
+	}
+	start := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	release := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := p.pool.Acquire(ctx)
+			errs <- err
+			if err != nil {
+				return
+			}
+			<-release // holds the connection so each goroutine opens a new one
+			c.Release()
+		}()
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		if err = <-errs; err != nil {
+			break
+		}
+	}
+	cancel()
+	close(release)
+	wg.Wait()
+	if err != nil {
+		return fmt.Errorf("error warming up the connection pool: %w", err)
+	}
+	p.log().InfoContext(ctx, "Connection pool warmed up", "connections", n, "duration", time.Since(start))
+	return nil
+}
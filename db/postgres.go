@@ -3,26 +3,62 @@ package db
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"text/template"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
 	companyTableName      = "cnpj"
 	metaTableName         = "meta"
+	historyTableName      = "cnpj_history"
+	partnersTableName     = "partners"
+	updatesChannel        = "cnpj_updates"
 	idFieldName           = "id"
 	jsonFieldName         = "json"
 	keyFieldName          = "key"
 	valueFieldName        = "value"
 	partnersJSONFieldName = "qsa"
+
+	sourceDateKey     = "source_date"
+	sourceURLKey      = "source_url"
+	sourceChecksumKey = "source_checksum"
+	sourceDateFormat  = "2006-01-02"
+
+	// metadata keys are limited to 16 chars
+	templateChecksumKey = "template_sha256"
+
+	indexProgressInterval = 5 * time.Second
+
+	// metadata values are stored as text, so there is no hard limit, but we warn
+	// when values are larger than this
+	metaValueWarningSize = 1 << 20
+
+	minPostgresVersionNum = 120000
+
+	// how many bytes of a malformed JSON are included in error messages
+	malformedDataSampleSize = 100
 )
 
 //go:embed postgres
@@ -34,8 +70,35 @@ type PostgreSQL struct {
 	uri                   string
 	schema                string
 	sql                   map[string]string
+	imports               *atomic.Pointer[chan struct{}] // see `SetMaxConcurrentImports`
+	report                *importReport
+	queries               *querySlots
+	batches               *atomic.Int64 // batches started by `CreateCompanies`, used in error messages
+	types                 *customTypes
+	logger                *slog.Logger
+	templateChecksum      string
+	useSearchPath         bool
+	prepared              bool // whether `preparedStatements` are prepared on each connection
+	serverVersionNum      int  // set by `checkVersion`
+	pgBouncer             bool // see `PostgreSQLConfig.PgBouncerCompatible`
+	Timeouts              TimeoutConfig
+	CompressJSON          bool // compress JSON with zstd when creating companies (see `compressJSON` and `ErrCompressedJSON`)
+	KeepHistory           bool // also save created and upserted companies to the history table
+	Cache                 Cache
+	BatchSize             int // set by `AutoTuneBatchSize`
+	MaxConcurrentQueries  int // queries looking for companies at the same time before `ErrDatabaseBusy` (0 for no limit)
+	MaxPartnersPerCompany int // partners above which `AddPartners` skips a company (0 for no limit)
+	CreateOptions         CreateOptions
+	CopyOptions           CopyOptions
+	DeleteOptions         DeleteOptions
+	UpdateOptions         UpdateOptions
+	CloneOptions          CloneOptions
 	CompanyTableName      string
 	MetaTableName         string
+	HistoryTableName      string
+	PartnersTableName     string // filled by `BackfillPartnersIndex`
+	UpdatesChannel        string // PostgreSQL channel notified by `UpsertCompanies`
+	JSONBCompression      string // set with `PostgreSQLConfig.JSONBCompression`
 	IDFieldName           string
 	JSONFieldName         string
 	KeyFieldName          string
@@ -43,21 +106,116 @@ type PostgreSQL struct {
 	PartnersJSONFieldName string
 }
 
-func (p *PostgreSQL) loadTemplates() error {
+// templates returns the file system with the SQL templates: the embedded one
+// if dir is empty, or the given directory otherwise.
+func templates(dir string) (fs.FS, error) {
+	if dir == "" {
+		return fs.Sub(sql, "postgres")
+	}
+	return os.DirFS(dir), nil
+}
+
+// missingTemplates lists the embedded templates not found in a directory.
+func missingTemplates(dir string) ([]string, error) {
 	ls, err := sql.ReadDir("postgres")
 	if err != nil {
-		return fmt.Errorf("error looking for templates: %w", err)
+		return nil, fmt.Errorf("error looking for templates: %w", err)
 	}
+	var m []string
 	for _, f := range ls {
-		t, err := template.ParseFS(sql, filepath.Join("postgres", f.Name()))
+		if _, err := os.Stat(filepath.Join(dir, f.Name())); errors.Is(err, fs.ErrNotExist) {
+			m = append(m, f.Name())
+		}
+	}
+	return m, nil
+}
+
+func (p *PostgreSQL) loadTemplates(dir string) error {
+	if dir != "" {
+		m, err := missingTemplates(dir)
+		if err != nil {
+			return err
+		}
+		if len(m) > 0 {
+			return fmt.Errorf("missing templates in %s: %s", dir, strings.Join(m, ", "))
+		}
+	}
+	fsys, err := templates(dir)
+	if err != nil {
+		return fmt.Errorf("error opening templates: %w", err)
+	}
+	ls, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("error looking for templates: %w", err)
+	}
+	h := sha256.New()
+	sql := make(map[string]string)
+	for _, f := range ls { // fs.ReadDir returns the files sorted by name
+		if f.IsDir() || filepath.Ext(f.Name()) != ".sql" {
+			continue
+		}
+		c, err := fs.ReadFile(fsys, f.Name())
 		if err != nil {
-			return fmt.Errorf("error parsing %s template: %w", f, err)
+			return fmt.Errorf("error reading %s template: %w", f.Name(), err)
+		}
+		h.Write(c)
+		t, err := template.New(f.Name()).Parse(string(c))
+		if err != nil {
+			return fmt.Errorf("error parsing %s template: %w", f.Name(), err)
 		}
 		var b bytes.Buffer
 		if err = t.Execute(&b, p); err != nil {
-			return fmt.Errorf("error rendering %s template: %w", f, err)
+			return fmt.Errorf("error rendering %s template: %w", f.Name(), err)
+		}
+		sql[strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))] = b.String()
+	}
+	p.sql = sql
+	p.templateChecksum = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// TemplateChecksum returns the SHA-256 (hex encoded) of the contents of the SQL
+// templates in use, concatenated in lexicographic order of their file names.
+func (p *PostgreSQL) TemplateChecksum() string { return p.templateChecksum }
+
+// checkTemplateChecksum warns if the SQL templates differ from the ones used
+// the last time the database was accessed, and saves the current checksum.
+// Errors are ignored, since the metadata table might not exist yet.
+func (p *PostgreSQL) checkTemplateChecksum() {
+	if v, err := p.MetaRead(templateChecksumKey); err == nil && v != p.templateChecksum {
+		p.log().Warn("SQL templates changed since the database was last used, the database might have been created with different SQL templates", "checksum", p.templateChecksum, "previous_checksum", v)
+	}
+	if err := p.MetaSave(templateChecksumKey, p.templateChecksum); err != nil {
+		p.log().Warn("Could not save the checksum of the SQL templates", "error", err)
+	}
+}
+
+// preparedStatements are the templates prepared on each connection when
+// `PostgreSQLConfig.PrepareStatements` is set, named after the templates.
+var preparedStatements = []string{"get", "get_exclude_fields", "meta_read", "meta_save"}
+
+// query returns what to pass to pgx to run a template: the name of the
+// prepared statement, if it was prepared, or the SQL otherwise.
+func (p *PostgreSQL) query(tmpl string) string {
+	if p.prepared && slices.Contains(preparedStatements, tmpl) {
+		return tmpl
+	}
+	return p.sql[tmpl]
+}
+
+// execStatements runs each statement of a template on its own, which is
+// required for statements such as `CREATE INDEX CONCURRENTLY` that cannot run
+// inside a transaction (and multiple statements sent at once are implicitly
+// wrapped in one).
+func (p *PostgreSQL) execStatements(ctx context.Context, name string) error {
+	for _, q := range strings.Split(p.sql[name], ";") {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			continue
+		}
+		if _, err := p.pool.Exec(ctx, q); err != nil {
+			return fmt.Errorf("error running: %s\n%w", q, err)
 		}
-		p.sql[strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))] = b.String()
 	}
 	return nil
 }
@@ -65,75 +223,655 @@ func (p *PostgreSQL) loadTemplates() error {
 // Close closes the PostgreSQL connection
 func (p *PostgreSQL) Close() { p.pool.Close() }
 
-// CompanyTableFullName is the name of the schame and table in dot-notation.
+// CompanyTableFullName is the name of the schame and table in dot-notation
+// (or only the table name when using the search_path).
 func (p *PostgreSQL) CompanyTableFullName() string {
+	if p.useSearchPath {
+		return p.CompanyTableName
+	}
 	return fmt.Sprintf("%s.%s", p.schema, p.CompanyTableName)
 }
 
-// MetaTableFullName is the name of the schame and table in dot-notation.
+// companyTableIdentifier is the name of the company table (with the schema,
+// unless using the search_path) as used by pgx in COPY statements.
+func (p *PostgreSQL) companyTableIdentifier() pgx.Identifier {
+	if p.useSearchPath {
+		return pgx.Identifier{p.CompanyTableName}
+	}
+	return pgx.Identifier{p.schema, p.CompanyTableName}
+}
+
+// MetaTableFullName is the name of the schame and table in dot-notation (or
+// only the table name when using the search_path).
 func (p *PostgreSQL) MetaTableFullName() string {
+	if p.useSearchPath {
+		return p.MetaTableName
+	}
 	return fmt.Sprintf("%s.%s", p.schema, p.MetaTableName)
 }
 
-// CreateTable creates the required database table.
-func (p *PostgreSQL) CreateTable() error {
-	log.Output(1, fmt.Sprintf("Creating table %s…", p.CompanyTableFullName()))
+// CreateTable creates the required database tables if they do not exist yet,
+// so it is safe to call it on startup. It returns true if the companies table
+// was created, or false if it already existed.
+func (p *PostgreSQL) CreateTable() (bool, error) {
+	var exists bool
+	if err := p.pool.QueryRow(context.Background(), p.sql["company_table_exists"]).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking if table %s exists: %w", p.CompanyTableFullName(), err)
+	}
+	if exists {
+		p.log().Info("Table already exists", "table", p.CompanyTableFullName())
+	} else {
+		p.log().Info("Creating table…", "table", p.CompanyTableFullName())
+	}
 	if _, err := p.pool.Exec(context.Background(), p.sql["create"]); err != nil {
-		return fmt.Errorf("error creating table with: %s\n%w", p.sql["create"], err)
+		return false, fmt.Errorf("error creating table with: %s\n%w", p.sql["create"], err)
 	}
-	return nil
+	return !exists, nil
 }
 
-// DropTable drops the database table created by `CreateTable`.
-func (p *PostgreSQL) DropTable() error {
-	log.Output(1, fmt.Sprintf("Dropping table %s…", p.CompanyTableFullName()))
+// DropTable drops the database table created by `CreateTable`. As a safety
+// measure, `confirm` must match the company table name. It returns
+// `ErrImportInProgress` if an import is running.
+func (p *PostgreSQL) DropTable(confirm string) error {
+	if confirm != p.CompanyTableName {
+		return fmt.Errorf("confirmation %q does not match the table name %s", confirm, p.CompanyTableName)
+	}
+	l, err := p.AcquireImportLock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer l.Release(context.Background())
+	if err := p.checkImportNotRunning(context.Background(), l); err != nil {
+		return err
+	}
+	p.log().Info("Dropping table…", "table", p.CompanyTableFullName())
 	if _, err := p.pool.Exec(context.Background(), p.sql["drop"]); err != nil {
 		return fmt.Errorf("error dropping table with: %s\n%w", p.sql["drop"], err)
 	}
 	return nil
 }
 
+// truncate runs a truncate template, unless an import is running.
+func (p *PostgreSQL) truncate(ctx context.Context, tmpl, table string) error {
+	l, err := p.AcquireImportLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer l.Release(ctx)
+	if err := p.checkImportNotRunning(ctx, l); err != nil {
+		return err
+	}
+	p.log().InfoContext(ctx, "Truncating table…", "table", table)
+	if _, err := p.pool.Exec(ctx, p.sql[tmpl]); err != nil {
+		return fmt.Errorf("error truncating table with: %s\n%w", p.sql[tmpl], err)
+	}
+	return nil
+}
+
+// TruncateTable empties the companies table keeping its structure, which is
+// faster than `DropTable` followed by `CreateTable`. It returns
+// `ErrImportInProgress` if an import is running.
+func (p *PostgreSQL) TruncateTable(ctx context.Context) error {
+	return p.truncate(ctx, "truncate", p.CompanyTableFullName())
+}
+
+// TruncateMeta empties the metadata table keeping its structure. It returns
+// `ErrImportInProgress` if an import is running.
+func (p *PostgreSQL) TruncateMeta(ctx context.Context) error {
+	return p.truncate(ctx, "truncate_meta", p.MetaTableFullName())
+}
+
+// SetMaxConcurrentImports limits how many `CreateCompanies` calls can copy data
+// to the database at the same time. Use 1 to serialize all the copies even if
+// the caller launches parallel goroutines, or 0 (the default) for no limit.
+// Changing the limit does not affect copies already waiting or running.
+func (p *PostgreSQL) SetMaxConcurrentImports(n int) {
+	if p.imports == nil {
+		p.imports = &atomic.Pointer[chan struct{}]{}
+	}
+	if n <= 0 {
+		p.imports.Store(nil)
+		return
+	}
+	c := make(chan struct{}, n)
+	p.imports.Store(&c)
+}
+
+// acquireImportSlot waits until a copy can start (see
+// `SetMaxConcurrentImports`) and returns the function to be called when the
+// copy finishes. The slot is released in the same channel it was taken from,
+// even if the limit changes in the meantime.
+func (p *PostgreSQL) acquireImportSlot() func() {
+	if p.imports == nil {
+		return func() {}
+	}
+	sem := p.imports.Load()
+	if sem == nil {
+		return func() {}
+	}
+	*sem <- struct{}{}
+	return func() { <-*sem }
+}
+
+// ErrBatchVerificationFailed is returned by `CreateCompanies` when the batch
+// verification is enabled and the IDs in the database do not match the ones in
+// the batch.
+var ErrBatchVerificationFailed = errors.New("batch verification failed")
+
+// CreateOptions configures `CreateCompanies`. Enabling `VerifyBatch` makes
+// each batch to be read back from the database and compared to the IDs of the
+// batch. It is expensive, but useful for data integrity checks.
+//
+// If `DeadLetterPath` is set, batches that fail are saved to a gzipped JSONL
+// file (the path with a timestamp suffix) instead of interrupting the import,
+// and they can be re-attempted later with `ReplayDeadLetter`.
+type CreateOptions struct {
+	VerifyBatch    bool
+	DeadLetterPath string
+}
+
+func batchIDs(batch [][]any) ([]int64, error) {
+	ids := make(map[int64]struct{})
+	for _, r := range batch {
+		var n int64
+		switch v := r[0].(type) {
+		case int:
+			n = int64(v)
+		case int64:
+			n = v
+		case string:
+			var err error
+			n, err = strconv.ParseInt(v, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("error converting id %s to integer: %w", v, err)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected id type %T", v)
+		}
+		ids[n] = struct{}{}
+	}
+	var s []int64
+	for n := range ids {
+		s = append(s, n)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s, nil
+}
+
+func (p *PostgreSQL) verifyBatch(ctx context.Context, batch [][]any) error {
+	ids, err := batchIDs(batch)
+	if err != nil {
+		return fmt.Errorf("error reading ids from batch: %w", err)
+	}
+	s := make([]string, len(ids))
+	for i, n := range ids {
+		s[i] = strconv.FormatInt(n, 10)
+	}
+	h := md5.Sum([]byte(strings.Join(s, ",")))
+	expected := hex.EncodeToString(h[:])
+	var c int64
+	var got string
+	if err := p.pool.QueryRow(ctx, p.sql["verify_batch"], ids).Scan(&c, &got); err != nil {
+		return fmt.Errorf("error verifying batch with: %s\n%w", p.sql["verify_batch"], err)
+	}
+	if c != int64(len(ids)) || got != expected {
+		return fmt.Errorf("%w: expected %d ids with checksum %s, got %d ids with checksum %s", ErrBatchVerificationFailed, len(ids), expected, c, got)
+	}
+	return nil
+}
+
 // CreateCompanies performs a copy to create a batch of companies in the
 // database. It expects an array and each item should be another array with only
 // two items: the ID and the JSON field values.
+//
+// The batch is saved within a transaction, so if it fails none of its companies
+// are saved, and the error includes the index of the batch (counting from 1,
+// in the order the calls started).
+//
+// It is safe to call it from parallel goroutines: duplicated IDs are allowed
+// at this stage and are only removed by `CreateIndex`. Yet, the number of
+// concurrent copies can be limited with `SetMaxConcurrentImports`.
 func (p *PostgreSQL) CreateCompanies(batch [][]any) error {
-	_, err := p.pool.CopyFrom(
-		context.Background(),
-		pgx.Identifier{p.CompanyTableName},
+	return p.createBatch(context.Background(), batch)
+}
+
+// createBatch saves a batch as `CreateCompanies` does, with a context.
+func (p *PostgreSQL) createBatch(ctx context.Context, batch [][]any) error {
+	n := p.batches.Add(1)
+	defer p.acquireImportSlot()()
+	ctx, cancel := withTimeout(ctx, p.Timeouts.ImportBatch)
+	defer cancel()
+	if err := p.createCompanies(ctx, batch); err != nil {
+		return p.deadLetter(batch, fmt.Errorf("error saving batch %d: %w", n, err))
+	}
+	p.report.success(batch)
+	return nil
+}
+
+// deadLetter saves a batch that failed with `err` to the dead-letter file, if
+// it is enabled, or returns the error otherwise.
+func (p *PostgreSQL) deadLetter(batch [][]any, err error) error {
+	if p.CreateOptions.DeadLetterPath == "" {
+		return err
+	}
+	f, dlErr := writeDeadLetter(p.CreateOptions.DeadLetterPath, batch)
+	if dlErr != nil {
+		return fmt.Errorf("%w (could not save batch to the dead-letter file: %s)", err, dlErr)
+	}
+	p.log().Warn("Companies saved to the dead-letter file", "companies", len(batch), "file", f, "error", err)
+	p.report.failure(batch, err)
+	return nil
+}
+
+func (p *PostgreSQL) createCompanies(ctx context.Context, batch [][]any) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := p.copyCompanies(ctx, tx, batch); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing batch: %w", err)
+	}
+	if p.CreateOptions.VerifyBatch {
+		return p.verifyBatch(ctx, batch)
+	}
+	return nil
+}
+
+// copier is what `copyCompanies` needs to save a batch, so it works both with
+// the pool and within a transaction.
+type copier interface {
+	CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error)
+}
+
+func (p *PostgreSQL) copyCompanies(ctx context.Context, c copier, batch [][]any) error {
+	rows := batch
+	if p.CompressJSON {
+		var err error
+		if rows, err = compressBatch(batch); err != nil {
+			return fmt.Errorf("error compressing batch: %w", err)
+		}
+	}
+	_, err := c.CopyFrom(
+		ctx,
+		p.companyTableIdentifier(),
 		[]string{idFieldName, jsonFieldName},
-		pgx.CopyFromRows(batch),
+		pgx.CopyFromRows(rows),
 	)
 	if err != nil {
 		return fmt.Errorf("error while importing data to postgres: %w", err)
 	}
+	if p.KeepHistory {
+		if err := p.saveHistory(ctx, c, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasPrimaryKey checks whether `CreateIndex` has already run.
+func (p *PostgreSQL) hasPrimaryKey(ctx context.Context) (bool, error) {
+	var ok bool
+	if err := p.pool.QueryRow(ctx, p.sql["has_primary_key"]).Scan(&ok); err != nil {
+		return false, fmt.Errorf("error checking the primary key of %s: %w", p.CompanyTableFullName(), err)
+	}
+	if ok {
+		p.log().InfoContext(ctx, "Table is already indexed", "table", p.CompanyTableFullName())
+	}
+	return ok, nil
+}
+
+// dropInvalidIndexes drops the indexes created by `createIndex` that were left
+// invalid by a concurrent build that failed or was interrupted, since `CREATE
+// INDEX CONCURRENTLY IF NOT EXISTS` would skip them and the primary key cannot
+// use an invalid index.
+func (p *PostgreSQL) dropInvalidIndexes(ctx context.Context) error {
+	ns := []string{"idx_remove_duplicates", p.CompanyTableName + "_pkey"}
+	rows, err := p.pool.Query(ctx, p.sql["invalid_indexes"], ns)
+	if err != nil {
+		return fmt.Errorf("error looking for invalid indexes of %s: %w", p.CompanyTableFullName(), err)
+	}
+	ns, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("error reading invalid indexes of %s: %w", p.CompanyTableFullName(), err)
+	}
+	for _, n := range ns {
+		p.log().WarnContext(ctx, "Dropping invalid index left by a failed build", "index", n)
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", p.IndexFullName(n))); err != nil {
+			return fmt.Errorf("error dropping invalid index %s: %w", n, err)
+		}
+	}
+	return nil
+}
+
+func (p *PostgreSQL) createIndex(ctx context.Context) error {
+	if ok, err := p.hasPrimaryKey(ctx); err != nil || ok {
+		return err
+	}
+	if err := p.dropInvalidIndexes(ctx); err != nil {
+		return err
+	}
+	p.log().InfoContext(ctx, "Creating indexes…", "table", p.CompanyTableFullName())
+	if err := p.execStatements(ctx, "create_index_concurrently"); err != nil {
+		return fmt.Errorf("error creating index: %w", err)
+	}
+	return nil
+}
+
+// UpsertCompanies creates or updates companies, useful for incremental imports
+// in which some CNPJs might not exist in the database yet. It expects an array
+// and each item should be another array with only two items: the ID and the
+// JSON field values. Existing companies have their JSON merged with the new
+// one (keys in the new JSON take precedence). IDs cannot be repeated in the
+// same batch and the table has to be indexed (see `CreateIndex`). Each CNPJ
+// is notified to `UpdatesChannel` (see `Listen`). It returns how many
+// companies were inserted and how many were updated. It does not work with
+// compressed JSON (see `ErrCompressedJSON`).
+func (p *PostgreSQL) UpsertCompanies(ctx context.Context, data [][]string) (int64, int64, error) {
+	if p.CompressJSON {
+		return 0, 0, ErrCompressedJSON
+	}
+	ids := make([]int64, len(data))
+	js := make([]string, len(data))
+	for i, r := range data {
+		n, err := strconv.ParseInt(r[0], 10, 0)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error converting cnpj %s to integer: %w", r[0], err)
+		}
+		ids[i] = n
+		js[i] = r[1]
+	}
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Update)
+	defer cancel()
+	var inserted, updated int64
+	if err := p.pool.QueryRow(ctx, p.sql["upsert"], ids, js).Scan(&inserted, &updated); err != nil {
+		return 0, 0, fmt.Errorf("error upserting companies with: %s\n%w", p.sql["upsert"], err)
+	}
+	if err := p.companiesChanged(ctx, ids); err != nil {
+		return 0, 0, err
+	}
+	if n := int64(len(ids)) - inserted - updated; n > 0 {
+		return inserted, updated, errCompressedRows(n)
+	}
+	return inserted, updated, nil
+}
+
+// companiesChanged saves companies to the history table (if `KeepHistory` is
+// set) and notifies them to `UpdatesChannel` after they were changed.
+func (p *PostgreSQL) companiesChanged(ctx context.Context, ids []int64) error {
+	if p.KeepHistory {
+		if _, err := p.pool.Exec(ctx, p.sql["history_upserted"], ids); err != nil {
+			return fmt.Errorf("error saving changed companies to history: %w", err)
+		}
+	}
+	if _, err := p.pool.Exec(ctx, p.sql["notify_updates"], ids); err != nil {
+		return fmt.Errorf("error notifying changed companies: %w", err)
+	}
 	return nil
 }
 
-// CreateIndex runs after all the data is creates. It drops duplicates and
-// create a primary key on the ID field.
+// CreateIndex runs after all the data is creates. It is the same as
+// `CreateIndexConcurrently` with no deadline. It does nothing if the table is
+// already indexed.
 func (p *PostgreSQL) CreateIndex() error {
-	log.Output(1, "Creating indexes…")
-	if _, err := p.pool.Exec(context.Background(), p.sql["create_index"]); err != nil {
+	return p.CreateIndexConcurrently(context.Background())
+}
+
+// CreateIndexConcurrently drops duplicates, create a primary key on the ID
+// field and analyzes the table. The indexes are created with `CREATE INDEX
+// CONCURRENTLY`, which does not lock the table against writes, but cannot be
+// used inside an explicit transaction. Thus any migration wrapped in a
+// transaction has to call it separately.
+func (p *PostgreSQL) CreateIndexConcurrently(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Index)
+	defer cancel()
+	if err := p.createIndex(ctx); err != nil {
+		return err
+	}
+	return p.AnalyzeTable(ctx)
+}
+
+// CreateIndexBlocking works as `CreateIndexConcurrently`, but creating the
+// indexes in a single transaction that locks the table while it runs.
+func (p *PostgreSQL) CreateIndexBlocking(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Index)
+	defer cancel()
+	if ok, err := p.hasPrimaryKey(ctx); err != nil || ok {
+		return err
+	}
+	p.log().InfoContext(ctx, "Creating indexes…", "table", p.CompanyTableFullName())
+	if _, err := p.pool.Exec(ctx, p.sql["create_index"]); err != nil {
 		return fmt.Errorf("error creating index with: %s\n%w", p.sql["create_index"], err)
 	}
+	return p.AnalyzeTable(ctx)
+}
+
+// IndexProgress is a snapshot of the progress reported by PostgreSQL while
+// creating an index.
+type IndexProgress struct {
+	Phase       string
+	BlocksTotal int64
+	BlocksDone  int64
+}
+
+// pollIndexProgress sends the progress of the index creation to the channel
+// every `indexProgressInterval` until the context is cancelled. It does not
+// close the channel.
+func (p *PostgreSQL) pollIndexProgress(ctx context.Context, ch chan<- IndexProgress) {
+	t := time.NewTicker(indexProgressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rows, err := p.pool.Query(ctx, p.sql["index_progress"])
+			if err != nil {
+				p.log().ErrorContext(ctx, "Error reading index progress", "table", p.CompanyTableFullName(), "error", err)
+				continue
+			}
+			ls, err := pgx.CollectRows(rows, pgx.RowToStructByPos[IndexProgress])
+			if err != nil {
+				p.log().ErrorContext(ctx, "Error reading index progress", "table", p.CompanyTableFullName(), "error", err)
+				continue
+			}
+			for _, i := range ls {
+				select {
+				case ch <- i:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// CreateIndexWithProgress works like `CreateIndex`, but polls PostgreSQL every
+// 5 seconds for the progress of the index creation, sending it to the channel.
+// This method owns the channel: it is closed when the index creation finishes,
+// fails or the context is cancelled (before the table is analyzed), so callers
+// must not close it and can range over it.
+func (p *PostgreSQL) CreateIndexWithProgress(ctx context.Context, ch chan<- IndexProgress) error {
+	ctx, cancelTimeout := withTimeout(ctx, p.Timeouts.Index)
+	defer cancelTimeout()
+	c, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.pollIndexProgress(c, ch)
+	}()
+	err := p.createIndex(ctx)
+	cancel()
+	<-done
+	close(ch)
+	if err != nil {
+		return err
+	}
+	return p.AnalyzeTable(ctx)
+}
+
+// AnalyzeTable vacuums and updates the query planner statistics of the company
+// table. It is meant to be used after bulk imports, since stale statistics lead
+// to poor query plans.
+func (p *PostgreSQL) AnalyzeTable(ctx context.Context) error {
+	p.log().InfoContext(ctx, "Analyzing table…", "table", p.CompanyTableFullName())
+	t := time.Now()
+	if _, err := p.pool.Exec(ctx, p.sql["analyze"]); err != nil {
+		return fmt.Errorf("error analyzing table with: %s\n%w", p.sql["analyze"], err)
+	}
+	p.log().InfoContext(ctx, "Table analyzed", "table", p.CompanyTableFullName(), "duration", time.Since(t))
 	return nil
 }
 
-// GetCompany returns the JSON of a company based on a CNPJ number.
-func (p *PostgreSQL) GetCompany(id string) (string, error) {
+// VacuumTable runs a full vacuum (VACUUM FULL) in the company table, which
+// rewrites it returning the storage occupied by dead rows to the operating
+// system. The table is locked, even for reading, while it runs (see `Shrink`
+// for the same operation reporting the space reclaimed).
+func (p *PostgreSQL) VacuumTable(ctx context.Context) error {
+	p.log().InfoContext(ctx, "Vacuuming table…", "table", p.CompanyTableFullName())
+	t := time.Now()
+	if _, err := p.pool.Exec(ctx, p.sql["vacuum_full"]); err != nil {
+		return fmt.Errorf("error vacuuming table with: %s\n%w", p.sql["vacuum_full"], err)
+	}
+	p.log().InfoContext(ctx, "Table vacuumed", "table", p.CompanyTableFullName(), "duration", time.Since(t))
+	return nil
+}
+
+// ErrMalformedData is returned when the JSON of a company in the database is
+// not valid, for example, if it was truncated during a failed import.
+var ErrMalformedData = errors.New("malformed data")
+
+// GetCompany returns the JSON of a company based on a CNPJ number. If the
+// context has no deadline, the query times out after `Timeouts.Get`. If there
+// is a `Cache`, it is used before querying the database (see
+// `WithCacheResult`).
+func (p *PostgreSQL) GetCompany(ctx context.Context, id string) (string, error) {
+	if p.Cache != nil {
+		if j, ok := p.Cache.Get(id); ok {
+			recordCacheResult(ctx, true)
+			return j, nil
+		}
+		recordCacheResult(ctx, false)
+	}
+	j, _, err := p.getCompany(ctx, id, "get")
+	if err == nil && p.Cache != nil {
+		p.Cache.Set(id, j)
+	}
+	return j, err
+}
+
+// GetCompanyRaw works as `GetCompany`, but returns the JSON as bytes read
+// straight from the query result, avoiding the copy to a string when the JSON
+// is written to an `io.Writer` right away (e.g. in the web API).
+func (p *PostgreSQL) GetCompanyRaw(ctx context.Context, id string) ([]byte, error) {
+	if p.Cache != nil {
+		if j, ok := p.Cache.Get(id); ok {
+			recordCacheResult(ctx, true)
+			return []byte(j), nil
+		}
+		recordCacheResult(ctx, false)
+	}
+	b, _, err := p.getCompanyRaw(ctx, id, "get")
+	if err == nil && p.Cache != nil {
+		p.Cache.Set(id, string(b))
+	}
+	return b, err
+}
+
+// CacheStats returns the statistics of the `Cache` (zeroed if there is no
+// cache).
+func (p *PostgreSQL) CacheStats() CacheStatistics {
+	if p.Cache == nil {
+		return CacheStatistics{}
+	}
+	return p.Cache.CacheStats()
+}
+
+// GetCompanyExcludeFields works as `GetCompany`, but removes top-level fields
+// from the JSON (e.g. qsa, the list of partners, which might be large). It
+// returns `ErrUnknownField` if a field is not part of the company JSON.
+func (p *PostgreSQL) GetCompanyExcludeFields(ctx context.Context, id string, excludeFields []string) (string, error) {
+	if len(excludeFields) == 0 {
+		return p.GetCompany(ctx, id)
+	}
+	if err := validateFields(excludeFields); err != nil {
+		return "", err
+	}
+	j, compressed, err := p.getCompany(ctx, id, "get_exclude_fields", excludeFields)
+	if err != nil || !compressed {
+		return j, err
+	}
+	var m map[string]json.RawMessage // compressed JSON cannot be changed in the query
+	if err := json.Unmarshal([]byte(j), &m); err != nil {
+		return "", fmt.Errorf("%w for cnpj %s: %s", ErrMalformedData, id, err)
+	}
+	for _, f := range excludeFields {
+		delete(m, f)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("error serializing cnpj %s: %w", id, err)
+	}
+	return string(b), nil
+}
+
+// getCompany runs a query template taking the CNPJ as the first argument and
+// returns the (decompressed) JSON, and whether it was compressed.
+func (p *PostgreSQL) getCompany(ctx context.Context, id, tmpl string, args ...any) (string, bool, error) {
+	b, compressed, err := p.getCompanyRaw(ctx, id, tmpl, args...)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), compressed, nil
+}
+
+func (p *PostgreSQL) getCompanyRaw(ctx context.Context, id, tmpl string, args ...any) ([]byte, bool, error) {
 	n, err := strconv.ParseInt(id, 10, 0)
 	if err != nil {
-		return "", fmt.Errorf("error converting cnpj %s to integer: %w", id, err)
+		return nil, false, fmt.Errorf("error converting cnpj %s to integer: %w", id, err)
+	}
+	if !p.queries.acquire(p.MaxConcurrentQueries) {
+		return nil, false, ErrDatabaseBusy
 	}
-	rows, err := p.pool.Query(context.Background(), p.sql["get"], n)
+	defer p.queries.release(p.MaxConcurrentQueries)
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Get)
+	defer cancel()
+	rows, err := p.pool.Query(ctx, p.query(tmpl), append([]any{n}, args...)...)
 	if err != nil {
-		return "", fmt.Errorf("error looking for cnpj %d: %w", n, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			p.log().DebugContext(ctx, "Timeout looking for cnpj", "table", p.CompanyTableFullName(), "cnpj", n)
+		}
+		return nil, false, fmt.Errorf("error looking for cnpj %d: %w", n, err)
 	}
-	j, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	j, err := pgx.CollectOneRow(rows, pgx.RowTo[[]byte])
 	if err != nil {
-		return "", fmt.Errorf("error reading cnpj %d: %w", n, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			p.log().DebugContext(ctx, "Timeout reading cnpj", "table", p.CompanyTableFullName(), "cnpj", n)
+		}
+		return nil, false, fmt.Errorf("error reading cnpj %d: %w", n, err)
 	}
-	return j, nil
+	var compressed bool
+	if len(j) > 0 && j[0] == '"' { // compressed JSON is saved as a JSON string
+		d, err := decompressJSON(string(j))
+		if err != nil {
+			return nil, false, fmt.Errorf("%w for cnpj %d: %s", ErrMalformedData, n, err)
+		}
+		if d != string(j) {
+			j, compressed = []byte(d), true
+		}
+	}
+	if !json.Valid(j) {
+		p.log().WarnContext(ctx, "Malformed JSON, it should be re-imported", "table", p.CompanyTableFullName(), "cnpj", n)
+		b := j
+		if len(b) > malformedDataSampleSize {
+			b = b[:malformedDataSampleSize]
+		}
+		return nil, false, fmt.Errorf("%w for cnpj %d: %s", ErrMalformedData, n, b)
+	}
+	return j, compressed, nil
 }
 
 // PreLoad runs before starting to load data into the database. Currently it
@@ -159,15 +897,31 @@ func (p *PostgreSQL) MetaSave(k, v string) error {
 	if len(k) > 16 {
 		return fmt.Errorf("metatable can only take keys that are at maximum 16 chars long")
 	}
-	if _, err := p.pool.Exec(context.Background(), p.sql["meta_save"], k, v); err != nil {
+	if len(v) > metaValueWarningSize {
+		p.log().Warn("Large metadata values might indicate a design issue", "table", p.MetaTableFullName(), "key", k, "bytes", len(v))
+	}
+	if _, err := p.pool.Exec(context.Background(), p.query("meta_save"), k, v); err != nil {
 		return fmt.Errorf("error saving %s to metadata: %w", k, err)
 	}
 	return nil
 }
 
+// MetaCAS (compare-and-swap) sets the value of a key in the metadata table
+// only if its current value is `expected`, atomically. It returns true if the
+// value was set, and false if the current value was not the expected one (or
+// if the key does not exist). It allows coordinating processes, e.g. only one
+// of them can change the import status from done to running.
+func (p *PostgreSQL) MetaCAS(ctx context.Context, key, expected, newValue string) (bool, error) {
+	r, err := p.pool.Exec(ctx, p.sql["meta_cas"], key, expected, newValue)
+	if err != nil {
+		return false, fmt.Errorf("error swapping %s in metadata: %w", key, err)
+	}
+	return r.RowsAffected() == 1, nil
+}
+
 // MetaRead reads a key/value pair from the metadata table.
 func (p *PostgreSQL) MetaRead(k string) (string, error) {
-	rows, err := p.pool.Query(context.Background(), p.sql["meta_read"], k)
+	rows, err := p.pool.Query(context.Background(), p.query("meta_read"), k)
 	if err != nil {
 		return "", fmt.Errorf("error looking for metadata key %s: %w", k, err)
 	}
@@ -178,30 +932,346 @@ func (p *PostgreSQL) MetaRead(k string) (string, error) {
 	return v, nil
 }
 
-// NewPostgreSQL creates a new PostgreSQL connection and ping it to make sure it works.
-func NewPostgreSQL(uri, schema string) (PostgreSQL, error) {
-	conn, err := pgxpool.New(context.Background(), uri)
+// ImportSource describes the Federal Revenue release imported to the database.
+type ImportSource struct {
+	Date     time.Time `json:"date"`
+	URL      string    `json:"url"`
+	Checksum string    `json:"checksum"`
+}
+
+// RecordImportSource saves to the metadata table the date, the URL and the
+// checksum of the Federal Revenue release being imported.
+func (p *PostgreSQL) RecordImportSource(ctx context.Context, releaseDate time.Time, sourceURL string, checksum string) error {
+	for _, m := range []struct{ k, v string }{
+		{sourceDateKey, releaseDate.Format(sourceDateFormat)},
+		{sourceURLKey, sourceURL},
+		{sourceChecksumKey, checksum},
+	} {
+		if _, err := p.pool.Exec(ctx, p.sql["meta_save"], m.k, m.v); err != nil {
+			return fmt.Errorf("error saving %s to metadata: %w", m.k, err)
+		}
+	}
+	return nil
+}
+
+// GetImportSource reads from the metadata table the Federal Revenue release
+// recorded with `RecordImportSource`.
+func (p *PostgreSQL) GetImportSource(ctx context.Context) (ImportSource, error) {
+	var s ImportSource
+	v := make(map[string]string)
+	for _, k := range []string{sourceDateKey, sourceURLKey, sourceChecksumKey} {
+		rows, err := p.pool.Query(ctx, p.sql["meta_read"], k)
+		if err != nil {
+			return s, fmt.Errorf("error looking for metadata key %s: %w", k, err)
+		}
+		v[k], err = pgx.CollectOneRow(rows, pgx.RowTo[string])
+		if err != nil {
+			return s, fmt.Errorf("error reading for metadata key %s: %w", k, err)
+		}
+	}
+	t, err := time.Parse(sourceDateFormat, v[sourceDateKey])
 	if err != nil {
-		return PostgreSQL{}, fmt.Errorf("could not connect to the database: %w", err)
+		return s, fmt.Errorf("error parsing source date %s: %w", v[sourceDateKey], err)
+	}
+	s.Date = t
+	s.URL = v[sourceURLKey]
+	s.Checksum = v[sourceChecksumKey]
+	return s, nil
+}
+
+// Version returns the PostgreSQL server version.
+func (p *PostgreSQL) Version(ctx context.Context) (string, error) {
+	var v string
+	if err := p.pool.QueryRow(ctx, "SHOW server_version").Scan(&v); err != nil {
+		return "", fmt.Errorf("error reading postgres version: %w", err)
 	}
+	return v, nil
+}
+
+func (p *PostgreSQL) versionNum(ctx context.Context) (int, error) {
+	var v string
+	if err := p.pool.QueryRow(ctx, "SHOW server_version_num").Scan(&v); err != nil {
+		return 0, fmt.Errorf("error reading postgres version number: %w", err)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("error converting postgres version number %s to integer: %w", v, err)
+	}
+	return n, nil
+}
+
+// checkVersion logs the PostgreSQL server version and makes sure it is
+// supported (JSONB operators we use are stable since PostgreSQL 12).
+func (p *PostgreSQL) checkVersion(ctx context.Context) error {
+	v, err := p.Version(ctx)
+	if err != nil {
+		return err
+	}
+	p.log().InfoContext(ctx, "Using PostgreSQL", "version", v, "schema", p.schema)
+	n, err := p.versionNum(ctx)
+	if err != nil {
+		return err
+	}
+	if n < minPostgresVersionNum {
+		return fmt.Errorf("postgres %s is not supported, the minimum required version is 12.0", v)
+	}
+	p.serverVersionNum = n
+	return nil
+}
+
+// matches the password in key/value connection strings (e.g. host=localhost
+// password=secret), quoted or not
+var dsnPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// MaskConnectionURI replaces the password in a PostgreSQL URI (postgres:// or
+// postgresql://), or in a key/value connection string (password=…), with
+// `***` so it is safe to use in logs and error messages. URIs that cannot be
+// parsed are replaced as a whole, since the password cannot be found in them.
+func MaskConnectionURI(uri string) string {
+	if !strings.Contains(uri, "://") {
+		return dsnPassword.ReplaceAllString(uri, "${1}***")
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "***"
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", "***")
+		u.RawQuery = q.Encode()
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "***")
+		}
+	}
+	return strings.ReplaceAll(u.String(), "%2A%2A%2A", "***")
+}
+
+// log returns the logger set in `PostgreSQLConfig`, or the default one.
+func (p *PostgreSQL) log() *slog.Logger {
+	if p.logger == nil {
+		return slog.Default()
+	}
+	return p.logger
+}
+
+// PostgreSQLConfig configures `NewPostgreSQLWithConfig`.
+type PostgreSQLConfig struct {
+	// Schema is where the tables are (public if empty).
+	Schema string
+
+	// TemplateDir is a directory with customized SQL templates, see
+	// `NewPostgreSQLWithTemplateDir`.
+	TemplateDir string
+
+	// UseSearchPath sets the search_path of each connection to the schema and
+	// uses table names without the schema prefix in the queries, which is
+	// useful for tools that do not work well with qualified table names.
+	UseSearchPath bool
+
+	// Tracer, if set, creates a span for each SQL query (see
+	// `OTELQueryTracer`).
+	Tracer Tracer
+
+	// Logger is used for the logs of the database operations (the default
+	// logger, `slog.Default()`, if nil).
+	Logger *slog.Logger
+
+	// PrepareStatements prepares the statements used by `GetCompany`,
+	// `GetCompanyExcludeFields`, `MetaRead` and `MetaSave` when each
+	// connection is created, so these queries are not parsed and planned
+	// again. pgx already caches the statements it runs in each connection by
+	// default, so this makes a difference mostly when the cache is disabled
+	// (e.g. default_query_exec_mode=exec in the URI). The tables must exist
+	// before connecting, so it is meant for the web API, and it does not work
+	// with connection poolers in transaction mode, such as PgBouncer.
+	PrepareStatements bool
+
+	// TypeMap, if set, is called with the type map of each new connection,
+	// allowing the registration of codecs for custom PostgreSQL types (the
+	// type map of pgx is not safe for concurrent use, so each connection has
+	// its own). See also `RegisterCustomTypes`.
+	TypeMap func(*pgtype.Map)
+
+	// JSONBCompression is the compression method of the JSONB columns in the
+	// tables created by `CreateTable`: pglz, lz4 or default (the server
+	// default, also used if empty). It requires PostgreSQL 14 or newer, and
+	// LZ4 falls back to pglz, with a warning, on older versions. Tables that
+	// already exist are not changed.
+	JSONBCompression string
+
+	// PgBouncerCompatible avoids features that do not work with PgBouncer in
+	// transaction pooling mode, where consecutive transactions might run in
+	// different server connections: statements are not prepared (not even by
+	// the statement cache of pgx, so queries are planned every time), the
+	// import lock is not acquired (only the import status in the metadata
+	// table protects the tables while importing), and `Listen` returns
+	// `ErrPgBouncerUnsupported`. It cannot be used with `PrepareStatements`
+	// or `UseSearchPath`.
+	PgBouncerCompatible bool
+
+	// cycleConnections closes each connection when it is released to the
+	// pool, simulating PgBouncer in tests.
+	cycleConnections bool
+}
+
+func newPostgreSQL(ctx context.Context, uri string, cfg PostgreSQLConfig) (PostgreSQL, error) {
+	if cfg.Schema == "" {
+		cfg.Schema = "public"
+	}
+	if err := validateJSONBCompression(cfg.JSONBCompression); err != nil {
+		return PostgreSQL{}, err
+	}
+	if err := validatePgBouncerConfig(cfg); err != nil {
+		return PostgreSQL{}, err
+	}
+	c, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("could not parse the database uri %s: %w", MaskConnectionURI(uri), err)
+	}
+	types := &customTypes{}
 	p := PostgreSQL{
-		pool:                  conn,
 		uri:                   uri,
-		schema:                schema,
+		schema:                cfg.Schema,
+		useSearchPath:         cfg.UseSearchPath,
 		sql:                   make(map[string]string),
+		prepared:              cfg.PrepareStatements,
+		pgBouncer:             cfg.PgBouncerCompatible,
 		CompanyTableName:      companyTableName,
 		MetaTableName:         metaTableName,
+		HistoryTableName:      historyTableName,
+		PartnersTableName:     partnersTableName,
+		UpdatesChannel:        updatesChannel,
 		IDFieldName:           idFieldName,
 		JSONFieldName:         jsonFieldName,
 		KeyFieldName:          keyFieldName,
 		ValueFieldName:        valueFieldName,
 		PartnersJSONFieldName: partnersJSONFieldName,
+		Timeouts:              DefaultTimeoutConfig(),
+		report:                newImportReport(),
+		queries:               &querySlots{},
+		batches:               &atomic.Int64{},
+		imports:               &atomic.Pointer[chan struct{}]{},
+		types:                 types,
+		logger:                cfg.Logger,
+		JSONBCompression:      cfg.JSONBCompression,
 	}
-	if err = p.loadTemplates(); err != nil {
+	if err = p.loadTemplates(cfg.TemplateDir); err != nil {
 		return PostgreSQL{}, fmt.Errorf("could not load the sql templates: %w", err)
 	}
-	if err := p.pool.Ping(context.Background()); err != nil {
-		return PostgreSQL{}, fmt.Errorf("could not connect to postgres: %w", err)
+	// AfterConnect runs in the pool's goroutines, so it gets its own copy of
+	// the statements instead of reading p.sql, which is replaced when the
+	// templates are loaded again.
+	stmts := make(map[string]string, len(preparedStatements))
+	for _, n := range preparedStatements {
+		stmts[n] = p.sql[n]
 	}
+	q := fmt.Sprintf("SET search_path TO %s", pgx.Identifier{cfg.Schema}.Sanitize())
+	c.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if cfg.UseSearchPath {
+			if _, err := conn.Exec(ctx, q); err != nil {
+				return fmt.Errorf("could not set search_path to %s: %w", cfg.Schema, err)
+			}
+		}
+		if cfg.TypeMap != nil {
+			cfg.TypeMap(conn.TypeMap())
+		}
+		if err := types.register(ctx, conn); err != nil {
+			return err
+		}
+		if cfg.PrepareStatements {
+			for _, n := range preparedStatements {
+				if _, err := conn.Prepare(ctx, n, stmts[n]); err != nil {
+					return fmt.Errorf("could not prepare the %s statement: %w", n, err)
+				}
+			}
+		}
+		return nil
+	}
+	if cfg.Tracer != nil {
+		c.ConnConfig.Tracer = NewOTELQueryTracer(cfg.Tracer)
+	}
+	if cfg.PgBouncerCompatible {
+		c.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+	if cfg.cycleConnections {
+		c.AfterRelease = func(*pgx.Conn) bool { return false }
+	}
+	conn, err := pgxpool.NewWithConfig(ctx, c)
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("could not connect to the database %s: %w", MaskConnectionURI(uri), err)
+	}
+	p.pool = conn
+	if err := p.pool.Ping(ctx); err != nil {
+		conn.Close()
+		return PostgreSQL{}, fmt.Errorf("could not connect to postgres %s: %w", MaskConnectionURI(uri), err)
+	}
+	if err := p.checkVersion(ctx); err != nil {
+		conn.Close()
+		return PostgreSQL{}, err
+	}
+	if p.JSONBCompression != "" {
+		p.checkJSONBCompression(ctx)
+		if err = p.loadTemplates(cfg.TemplateDir); err != nil { // the compression clause depends on the server version
+			conn.Close()
+			return PostgreSQL{}, fmt.Errorf("could not load the sql templates: %w", err)
+		}
+	}
+	p.checkTemplateChecksum()
 	return p, nil
 }
+
+// NewPostgreSQL creates a new PostgreSQL connection and ping it to make sure it works.
+func NewPostgreSQL(uri, schema string) (PostgreSQL, error) {
+	return newPostgreSQL(context.Background(), uri, PostgreSQLConfig{Schema: schema})
+}
+
+// NewPostgreSQLWithTemplateDir works as `NewPostgreSQL`, but reads the SQL
+// templates from a directory instead of using the ones embedded in the binary,
+// allowing customized queries. The directory must have all the templates
+// found in db/postgres. If templateDir is empty, the embedded templates are
+// used.
+func NewPostgreSQLWithTemplateDir(uri, schema, templateDir string) (PostgreSQL, error) {
+	return newPostgreSQL(context.Background(), uri, PostgreSQLConfig{Schema: schema, TemplateDir: templateDir})
+}
+
+// NewPostgreSQLWithConfig works as `NewPostgreSQL` with the settings from a
+// `PostgreSQLConfig`.
+func NewPostgreSQLWithConfig(uri string, cfg PostgreSQLConfig) (PostgreSQL, error) {
+	return newPostgreSQL(context.Background(), uri, cfg)
+}
+
+// ConnectWithRetry works as `NewPostgreSQL`, but retries up to `maxAttempts`
+// times waiting `delay` between attempts, which is useful when the application
+// starts before the database is ready. It stops retrying if the context is
+// cancelled.
+func ConnectWithRetry(ctx context.Context, uri, schema string, maxAttempts int, delay time.Duration) (PostgreSQL, error) {
+	return ConnectWithRetryWithConfig(ctx, uri, PostgreSQLConfig{Schema: schema}, maxAttempts, delay)
+}
+
+// ConnectWithRetryWithConfig works as `ConnectWithRetry` with the settings
+// from a `PostgreSQLConfig`. A maxAttempts lower than 1 means a single
+// attempt.
+func ConnectWithRetryWithConfig(ctx context.Context, uri string, cfg PostgreSQLConfig, maxAttempts int, delay time.Duration) (PostgreSQL, error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for i := 1; i <= maxAttempts; i++ {
+		var p PostgreSQL
+		p, err = newPostgreSQL(ctx, uri, cfg)
+		if err == nil {
+			return p, nil
+		}
+		slog.WarnContext(ctx, "Attempt to connect to postgres failed", "attempt", i, "max_attempts", maxAttempts, "error", err)
+		if i == maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return PostgreSQL{}, fmt.Errorf("gave up connecting to postgres: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return PostgreSQL{}, fmt.Errorf("could not connect to postgres after %d attempts: %w", maxAttempts, err)
+}
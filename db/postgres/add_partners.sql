@@ -0,0 +1,19 @@
+WITH partners AS (
+    SELECT *
+    FROM unnest($1::bigint[], $2::bigint[], $3::text[]) AS u(first, last, partners)
+), updated AS (
+    UPDATE {{ .CompanyTableFullName }} AS c
+    SET {{ .JSONFieldName }} = jsonb_set(c.{{ .JSONFieldName }}, ARRAY['{{ .PartnersJSONFieldName }}'], u.partners::jsonb)
+    FROM partners AS u
+    WHERE c.{{ .IDFieldName }} BETWEEN u.first AND u.last
+    AND jsonb_typeof(c.{{ .JSONFieldName }}) = 'object'
+    RETURNING 1
+)
+SELECT
+    (SELECT count(*) FROM updated),
+    (
+        SELECT count(*)
+        FROM {{ .CompanyTableFullName }} AS c
+        JOIN partners AS u ON c.{{ .IDFieldName }} BETWEEN u.first AND u.last
+        WHERE jsonb_typeof(c.{{ .JSONFieldName }}) = 'string'
+    );
@@ -0,0 +1 @@
+VACUUM ANALYZE {{ .CompanyTableFullName }};
@@ -0,0 +1,4 @@
+INSERT INTO {{ .PartnersTableFullName }} (base_cnpj, cpf, nome)
+SELECT DISTINCT c.{{ .IDFieldName }} / 1000000, left(p->>'cnpj_cpf_do_socio', 14), left(p->>'nome_socio', 255)
+FROM {{ .CompanyTableFullName }} AS c, jsonb_array_elements(c.{{ .JSONFieldName }}->'{{ .PartnersJSONFieldName }}') AS p
+WHERE jsonb_typeof(c.{{ .JSONFieldName }}->'{{ .PartnersJSONFieldName }}') = 'array';
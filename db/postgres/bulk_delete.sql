@@ -0,0 +1,2 @@
+DELETE FROM {{ .CompanyTableFullName }}
+WHERE id = ANY($1::bigint[]);
@@ -0,0 +1,3 @@
+SELECT count(*)
+FROM {{ .CompanyTableFullName }}
+WHERE id = ANY($1::bigint[]);
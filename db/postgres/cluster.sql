@@ -0,0 +1 @@
+CLUSTER {{ .CompanyTableFullName }} USING {{ .CompanyTableName }}_pkey;
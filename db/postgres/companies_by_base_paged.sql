@@ -0,0 +1,6 @@
+SELECT {{ .IDFieldName }}, {{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .IDFieldName }} > $1
+AND {{ .IDFieldName }} <= $2
+ORDER BY {{ .IDFieldName }}
+LIMIT $3;
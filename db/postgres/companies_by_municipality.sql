@@ -0,0 +1,6 @@
+SELECT {{ .JSONFieldName }}, count(*) OVER ()
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .JSONFieldName }}->>'codigo_municipio' = $1
+ORDER BY {{ .IDFieldName }}
+LIMIT $2
+OFFSET $3;
@@ -0,0 +1,9 @@
+SELECT c.{{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }} AS c
+JOIN (
+    SELECT DISTINCT base_cnpj
+    FROM {{ .PartnersTableFullName }}
+    WHERE cpf = $1
+) AS p
+ON c.{{ .IDFieldName }} BETWEEN p.base_cnpj * 1000000 AND p.base_cnpj * 1000000 + 999999
+ORDER BY c.{{ .IDFieldName }};
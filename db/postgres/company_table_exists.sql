@@ -0,0 +1 @@
+SELECT to_regclass('{{ .CompanyTableFullName }}') IS NOT NULL;
@@ -0,0 +1,3 @@
+DECLARE copy_companies NO SCROLL CURSOR FOR
+SELECT {{ .IDFieldName }}, {{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }};
@@ -0,0 +1,5 @@
+SELECT {{ .JSONFieldName }}->>$1::text, count(*)
+FROM {{ .CompanyTableFullName }}
+GROUP BY 1
+ORDER BY 2 DESC, 1
+LIMIT $2;
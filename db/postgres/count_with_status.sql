@@ -0,0 +1,3 @@
+SELECT count(*)
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .JSONFieldName }}->>'situacao_cadastral' = $1;
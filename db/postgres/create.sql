@@ -1,8 +1,22 @@
 CREATE UNLOGGED TABLE IF NOT EXISTS {{ .CompanyTableFullName }} (
     {{ .IDFieldName }}   bigint NOT NULL,
-    {{ .JSONFieldName }} jsonb NOT NULL
+    {{ .JSONFieldName }} jsonb {{ .JSONBCompressionClause }} NOT NULL
 );
 CREATE TABLE IF NOT EXISTS {{ .MetaTableFullName }} (
     {{ .KeyFieldName }}   char(16) NOT NULL PRIMARY KEY,
     {{ .ValueFieldName }} text NOT NULL
-)
+);
+CREATE TABLE IF NOT EXISTS {{ .HistoryTableFullName }} (
+    {{ .IDFieldName }}   bigint NOT NULL,
+    {{ .JSONFieldName }} jsonb {{ .JSONBCompressionClause }} NOT NULL,
+    imported_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS {{ .HistoryTableName }}_id_imported_at_idx
+ON {{ .HistoryTableFullName }} ({{ .IDFieldName }}, imported_at);
+CREATE TABLE IF NOT EXISTS {{ .PartnersTableFullName }} (
+    base_cnpj bigint NOT NULL,
+    cpf       varchar(14),
+    nome      varchar(255)
+);
+CREATE INDEX IF NOT EXISTS {{ .PartnersTableName }}_cpf_idx
+ON {{ .PartnersTableFullName }} (cpf);
@@ -1,4 +1,4 @@
-CREATE INDEX idx_remove_duplicates ON {{ .CompanyTableFullName }} ({{ .IDFieldName }});
+CREATE INDEX IF NOT EXISTS idx_remove_duplicates ON {{ .CompanyTableFullName }} ({{ .IDFieldName }});
 
 DELETE FROM {{ .CompanyTableFullName }}
 WHERE ctid IN (
@@ -15,6 +15,6 @@ WHERE ctid IN (
   WHERE count > 1
 );
 
-DROP INDEX idx_remove_duplicates;
+DROP INDEX IF EXISTS {{ .IndexFullName "idx_remove_duplicates" }};
 
-ALTER TABLE cnpj ADD PRIMARY KEY (id);
+ALTER TABLE {{ .CompanyTableFullName }} ADD PRIMARY KEY ({{ .IDFieldName }});
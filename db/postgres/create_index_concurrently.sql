@@ -0,0 +1,22 @@
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_remove_duplicates ON {{ .CompanyTableFullName }} ({{ .IDFieldName }});
+
+DELETE FROM {{ .CompanyTableFullName }}
+WHERE ctid IN (
+  SELECT ctid
+  FROM (
+    SELECT
+      ctid,
+      row_number() OVER (
+        PARTITION BY ({{ .IDFieldName }})
+        ORDER BY ctid DESC
+      ) AS count
+    FROM {{ .CompanyTableFullName }}
+  ) t
+  WHERE count > 1
+);
+
+DROP INDEX CONCURRENTLY IF EXISTS {{ .IndexFullName "idx_remove_duplicates" }};
+
+CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS {{ .CompanyTableName }}_pkey ON {{ .CompanyTableFullName }} ({{ .IDFieldName }});
+
+ALTER TABLE {{ .CompanyTableFullName }} ADD PRIMARY KEY USING INDEX {{ .CompanyTableName }}_pkey;
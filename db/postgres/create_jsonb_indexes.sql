@@ -0,0 +1,18 @@
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_{{ .CompanyTableName }}_{{ .PartnersJSONFieldName }}
+ON {{ .CompanyTableFullName }}
+USING GIN (({{ .JSONFieldName }}->'{{ .PartnersJSONFieldName }}') jsonb_path_ops);
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_{{ .CompanyTableName }}_codigo_municipio
+ON {{ .CompanyTableFullName }} (({{ .JSONFieldName }}->>'codigo_municipio'));
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_{{ .CompanyTableName }}_uf
+ON {{ .CompanyTableFullName }} (({{ .JSONFieldName }}->>'uf'));
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_{{ .CompanyTableName }}_cnae_fiscal
+ON {{ .CompanyTableFullName }} (({{ .JSONFieldName }}->>'cnae_fiscal'));
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_{{ .CompanyTableName }}_codigo_natureza_juridica
+ON {{ .CompanyTableFullName }} (({{ .JSONFieldName }}->>'codigo_natureza_juridica'));
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_{{ .CompanyTableName }}_situacao_cadastral
+ON {{ .CompanyTableFullName }} (({{ .JSONFieldName }}->>'situacao_cadastral'));
@@ -0,0 +1,4 @@
+DECLARE diff_companies NO SCROLL CURSOR FOR
+SELECT {{ .IDFieldName }}, {{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }}
+ORDER BY {{ .IDFieldName }};
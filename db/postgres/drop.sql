@@ -1,2 +1,4 @@
 DROP TABLE IF EXISTS {{ .CompanyTableFullName }} CASCADE;
 DROP TABLE IF EXISTS {{ .MetaTableFullName }} CASCADE;
+DROP TABLE IF EXISTS {{ .PartnersTableFullName }} CASCADE;
+DROP TABLE IF EXISTS {{ .HistoryTableFullName }} CASCADE;
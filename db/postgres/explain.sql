@@ -0,0 +1,4 @@
+EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON)
+SELECT {{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }}
+WHERE id = $1;
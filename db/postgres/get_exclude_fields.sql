@@ -0,0 +1,6 @@
+SELECT CASE
+    WHEN jsonb_typeof({{ .JSONFieldName }}) = 'object' THEN {{ .JSONFieldName }} - $2::text[]
+    ELSE {{ .JSONFieldName }}
+END
+FROM {{ .CompanyTableFullName }}
+WHERE id = $1;
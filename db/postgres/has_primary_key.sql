@@ -0,0 +1,5 @@
+SELECT EXISTS (
+    SELECT 1
+    FROM pg_index
+    WHERE indrelid = '{{ .CompanyTableFullName }}'::regclass AND indisprimary
+);
@@ -0,0 +1,4 @@
+SELECT {{ .JSONFieldName }}, imported_at
+FROM {{ .HistoryTableFullName }}
+WHERE {{ .IDFieldName }} = $1
+ORDER BY imported_at;
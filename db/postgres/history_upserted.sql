@@ -0,0 +1,4 @@
+INSERT INTO {{ .HistoryTableFullName }} ({{ .IDFieldName }}, {{ .JSONFieldName }})
+SELECT {{ .IDFieldName }}, {{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .IDFieldName }} = ANY($1::bigint[]);
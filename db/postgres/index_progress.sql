@@ -0,0 +1,3 @@
+SELECT phase, coalesce(blocks_total, 0), coalesce(blocks_done, 0)
+FROM pg_stat_progress_create_index
+WHERE relid = '{{ .CompanyTableFullName }}'::regclass;
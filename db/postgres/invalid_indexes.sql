@@ -0,0 +1,7 @@
+SELECT i.relname
+FROM pg_index x
+JOIN pg_class i ON i.oid = x.indexrelid
+WHERE x.indrelid = '{{ .CompanyTableFullName }}'::regclass
+    AND NOT x.indisvalid
+    AND i.relname = ANY($1)
+ORDER BY i.relname;
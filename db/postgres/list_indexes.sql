@@ -0,0 +1,10 @@
+SELECT
+    i.relname,
+    am.amname,
+    pg_get_indexdef(x.indexrelid, 1, true),
+    pg_get_indexdef(x.indexrelid)
+FROM pg_index x
+JOIN pg_class i ON i.oid = x.indexrelid
+JOIN pg_am am ON am.oid = i.relam
+WHERE x.indrelid = '{{ .CompanyTableFullName }}'::regclass
+ORDER BY i.relname;
@@ -0,0 +1,4 @@
+SELECT table_schema
+FROM information_schema.tables
+WHERE table_name = '{{ .CompanyTableName }}'
+ORDER BY table_schema;
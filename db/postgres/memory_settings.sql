@@ -0,0 +1,3 @@
+SELECT
+    (SELECT setting::bigint * 1024 FROM pg_settings WHERE name = 'work_mem'),
+    (SELECT setting::bigint FROM pg_settings WHERE name = 'max_connections');
@@ -0,0 +1,3 @@
+SELECT trim({{ .KeyFieldName }}), {{ .ValueFieldName }}
+FROM {{ .MetaTableFullName }}
+ORDER BY {{ .KeyFieldName }};
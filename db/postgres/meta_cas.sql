@@ -0,0 +1,3 @@
+UPDATE {{ .MetaTableFullName }}
+SET {{ .ValueFieldName }} = $3
+WHERE {{ .KeyFieldName }} = $1 AND {{ .ValueFieldName }} = $2;
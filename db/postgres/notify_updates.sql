@@ -0,0 +1,2 @@
+SELECT pg_notify('{{ .UpdatesChannel }}', lpad(id::text, 14, '0'))
+FROM unnest($1::bigint[]) AS id;
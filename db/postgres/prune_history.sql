@@ -0,0 +1,2 @@
+DELETE FROM {{ .HistoryTableFullName }}
+WHERE imported_at < $1;
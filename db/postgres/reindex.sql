@@ -0,0 +1 @@
+REINDEX TABLE {{ .CompanyTableFullName }};
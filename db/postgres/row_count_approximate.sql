@@ -0,0 +1,3 @@
+SELECT reltuples::bigint
+FROM pg_class
+WHERE oid = '{{ .CompanyTableFullName }}'::regclass;
@@ -0,0 +1,2 @@
+SELECT count(*)
+FROM {{ .CompanyTableFullName }};
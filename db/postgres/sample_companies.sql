@@ -0,0 +1,3 @@
+SELECT {{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }} TABLESAMPLE BERNOULLI ($1::real)
+LIMIT $2;
@@ -0,0 +1,5 @@
+SELECT EXISTS (
+    SELECT 1
+    FROM information_schema.schemata
+    WHERE schema_name = $1
+);
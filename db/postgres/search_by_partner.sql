@@ -0,0 +1,6 @@
+SELECT {{ .JSONFieldName }}
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .JSONFieldName }}->'{{ .PartnersJSONFieldName }}' @> $1::jsonb
+ORDER BY {{ .IDFieldName }}
+LIMIT $2
+OFFSET $3;
@@ -0,0 +1,3 @@
+SELECT coalesce({{ .JSONFieldName }}->>'situacao_cadastral', ''), count(*)
+FROM {{ .CompanyTableFullName }}
+GROUP BY 1;
@@ -0,0 +1,4 @@
+SELECT
+    pg_relation_size('{{ .CompanyTableFullName }}'),
+    pg_indexes_size('{{ .CompanyTableFullName }}'),
+    pg_total_relation_size('{{ .CompanyTableFullName }}');
@@ -0,0 +1 @@
+SELECT 1 FROM {{ .CompanyTableFullName }} LIMIT 1;
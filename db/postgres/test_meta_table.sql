@@ -0,0 +1 @@
+SELECT 1 FROM {{ .MetaTableFullName }} LIMIT 1;
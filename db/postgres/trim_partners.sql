@@ -0,0 +1,8 @@
+UPDATE {{ .CompanyTableFullName }}
+SET {{ .JSONFieldName }} = jsonb_set({{ .JSONFieldName }}, ARRAY['{{ .PartnersJSONFieldName }}'], (
+    SELECT jsonb_agg(p.value ORDER BY p.n)
+    FROM jsonb_array_elements({{ .JSONFieldName }}->'{{ .PartnersJSONFieldName }}') WITH ORDINALITY AS p(value, n)
+    WHERE p.n <= $1
+))
+WHERE jsonb_typeof({{ .JSONFieldName }}->'{{ .PartnersJSONFieldName }}') = 'array'
+AND jsonb_array_length({{ .JSONFieldName }}->'{{ .PartnersJSONFieldName }}') > $1;
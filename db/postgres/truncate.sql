@@ -0,0 +1 @@
+TRUNCATE TABLE {{ .CompanyTableFullName }} RESTART IDENTITY CASCADE;
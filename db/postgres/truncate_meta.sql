@@ -0,0 +1 @@
+TRUNCATE TABLE {{ .MetaTableFullName }} RESTART IDENTITY CASCADE;
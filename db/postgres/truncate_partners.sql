@@ -0,0 +1 @@
+TRUNCATE {{ .PartnersTableFullName }};
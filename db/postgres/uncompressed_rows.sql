@@ -0,0 +1,5 @@
+SELECT {{ .IDFieldName }}, {{ .JSONFieldName }}::text
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .IDFieldName }} > $1 AND jsonb_typeof({{ .JSONFieldName }}) = 'object'
+ORDER BY {{ .IDFieldName }}
+LIMIT $2;
@@ -0,0 +1,17 @@
+WITH updates AS (
+    SELECT *
+    FROM unnest($1::bigint[], $2::bigint[], $3::text[]) AS u(first, last, data)
+), updated AS (
+    UPDATE {{ .CompanyTableFullName }} AS c
+    SET {{ .JSONFieldName }} = c.{{ .JSONFieldName }} || u.data::jsonb
+    FROM updates AS u
+    WHERE c.{{ .IDFieldName }} BETWEEN u.first AND u.last
+    AND jsonb_typeof(c.{{ .JSONFieldName }}) = 'object'
+    RETURNING c.{{ .IDFieldName }}
+)
+SELECT {{ .IDFieldName }}, false AS compressed FROM updated
+UNION ALL
+SELECT c.{{ .IDFieldName }}, true AS compressed
+FROM {{ .CompanyTableFullName }} AS c
+JOIN updates AS u ON c.{{ .IDFieldName }} BETWEEN u.first AND u.last
+WHERE jsonb_typeof(c.{{ .JSONFieldName }}) = 'string';
@@ -0,0 +1,4 @@
+UPDATE {{ .CompanyTableFullName }} AS c
+SET {{ .JSONFieldName }} = u.json::jsonb
+FROM unnest($1::bigint[], $2::text[]) AS u(id, json)
+WHERE c.{{ .IDFieldName }} = u.id;
@@ -0,0 +1,11 @@
+WITH upserted AS (
+    INSERT INTO {{ .CompanyTableFullName }} AS c ({{ .IDFieldName }}, {{ .JSONFieldName }})
+    SELECT t.id, t.json::jsonb
+    FROM unnest($1::bigint[], $2::text[]) AS t(id, json)
+    ON CONFLICT ({{ .IDFieldName }})
+    DO UPDATE SET {{ .JSONFieldName }} = c.{{ .JSONFieldName }} || EXCLUDED.{{ .JSONFieldName }}
+    WHERE jsonb_typeof(c.{{ .JSONFieldName }}) = 'object'
+    RETURNING xmax = 0 AS inserted
+)
+SELECT count(*) FILTER (WHERE inserted), count(*) FILTER (WHERE NOT inserted)
+FROM upserted;
@@ -0,0 +1 @@
+VACUUM FULL {{ .CompanyTableFullName }};
@@ -0,0 +1,6 @@
+SELECT count(*), coalesce(md5(string_agg({{ .IDFieldName }}::text, ',' ORDER BY {{ .IDFieldName }})), '')
+FROM (
+    SELECT DISTINCT {{ .IDFieldName }}
+    FROM {{ .CompanyTableFullName }}
+    WHERE {{ .IDFieldName }} = ANY($1)
+) t;
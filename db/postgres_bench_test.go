@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const benchmarkCompanies = 1000
+
+// benchmarkBase is the first base CNPJ of the fixture companies.
+const benchmarkBase = 10000000
+
+// benchmarkDB connects to the test database and creates a table with
+// `benchmarkCompanies` companies, dropped when the benchmark finishes.
+func benchmarkDB(b *testing.B) (*PostgreSQL, []string) {
+	return benchmarkDBWithConfig(b, PostgreSQLConfig{})
+}
+
+func benchmarkDBWithConfig(b *testing.B, cfg PostgreSQLConfig) (*PostgreSQL, []string) {
+	b.Helper()
+	u := os.Getenv("TEST_DATABASE_URL")
+	if u == "" {
+		b.Skip("TEST_DATABASE_URL not set")
+	}
+	pg, err := NewPostgreSQLWithConfig(u, cfg)
+	if err != nil {
+		b.Fatalf("expected no error connecting to postgres, got %s", err)
+	}
+	b.Cleanup(func() {
+		if err := pg.DropTable(pg.CompanyTableName); err != nil {
+			b.Errorf("expected no error dropping the table, got %s", err)
+		}
+		pg.Close()
+	})
+	if _, err := pg.CreateTable(); err != nil {
+		b.Fatalf("expected no error creating the table, got %s", err)
+	}
+	ids := make([]string, benchmarkCompanies)
+	batch := make([][]any, benchmarkCompanies)
+	for i := range batch {
+		n := (benchmarkBase+int64(i))*1000000 + 1
+		ids[i] = fmt.Sprintf("%014d", n)
+		batch[i] = []any{n, fmt.Sprintf(`{"cnpj": "%s", "qsa": []}`, ids[i])}
+	}
+	if err := pg.CreateCompanies(batch); err != nil {
+		b.Fatalf("expected no error creating companies, got %s", err)
+	}
+	if err := pg.CreateIndex(); err != nil {
+		b.Fatalf("expected no error creating the index, got %s", err)
+	}
+	return &pg, ids
+}
+
+func reportRowsPerSecond(b *testing.B, rows int) {
+	if s := b.Elapsed().Seconds(); s > 0 {
+		b.ReportMetric(float64(rows)/s, "rows/s")
+	}
+}
+
+func BenchmarkGetCompany(b *testing.B) {
+	for _, c := range []struct {
+		name string
+		cfg  PostgreSQLConfig
+	}{
+		{"default", PostgreSQLConfig{}},
+		{"prepared", PostgreSQLConfig{PrepareStatements: true}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			pg, ids := benchmarkDBWithConfig(b, c.cfg)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := pg.GetCompany(context.Background(), ids[i%len(ids)]); err != nil {
+					b.Fatalf("expected no error getting a company, got %s", err)
+				}
+			}
+			reportRowsPerSecond(b, b.N)
+		})
+	}
+}
+
+// BenchmarkGetCompanyRaw compares the allocations of `GetCompany` and
+// `GetCompanyRaw`, which skips copying the JSON to a string.
+func BenchmarkGetCompanyRaw(b *testing.B) {
+	pg, ids := benchmarkDB(b)
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := pg.GetCompany(context.Background(), ids[i%len(ids)]); err != nil {
+				b.Fatalf("expected no error getting a company, got %s", err)
+			}
+		}
+	})
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := pg.GetCompanyRaw(context.Background(), ids[i%len(ids)]); err != nil {
+				b.Fatalf("expected no error getting a company, got %s", err)
+			}
+		}
+	})
+}
+
+// BenchmarkJSONBCompression reports the size of the companies table with each
+// compression method. Compression only applies to values larger than about
+// 2kB, so the companies have a large list of partners.
+func BenchmarkJSONBCompression(b *testing.B) {
+	for _, c := range []string{JSONBCompressionPGLZ, JSONBCompressionLZ4} {
+		b.Run(c, func(b *testing.B) {
+			pg, ids := benchmarkDBWithConfig(b, PostgreSQLConfig{JSONBCompression: c})
+			data := make([][]string, len(ids))
+			for i, id := range ids {
+				qsa := make([]string, 64)
+				for j := range qsa {
+					qsa[j] = fmt.Sprintf(`{"nome_socio": "SOCIO %d DA EMPRESA %s", "qualificacao_socio": "Sócio-Administrador"}`, j, id)
+				}
+				data[i] = []string{id, fmt.Sprintf(`{"cnpj": "%s", "qsa": [%s]}`, id, strings.Join(qsa, ", "))}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := pg.UpsertCompanies(context.Background(), data); err != nil {
+					b.Fatalf("expected no error upserting companies, got %s", err)
+				}
+			}
+			b.StopTimer()
+			s, err := pg.TableSize(context.Background())
+			if err != nil {
+				b.Fatalf("expected no error reading the table size, got %s", err)
+			}
+			b.ReportMetric(float64(s.TableBytes), "table_bytes")
+		})
+	}
+}
+
+func BenchmarkUpsertCompanies(b *testing.B) {
+	pg, ids := benchmarkDB(b)
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			data := make([][]string, n)
+			for i := range data {
+				data[i] = []string{ids[i], fmt.Sprintf(`{"cnpj": "%s", "answer": 42}`, ids[i])}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := pg.UpsertCompanies(context.Background(), data); err != nil {
+					b.Fatalf("expected no error upserting companies, got %s", err)
+				}
+			}
+			reportRowsPerSecond(b, b.N*n)
+		})
+	}
+}
+
+func BenchmarkAddPartners(b *testing.B) {
+	pg, ids := benchmarkDB(b)
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			data := make([][]string, n)
+			for i := range data {
+				data[i] = []string{ids[i][:8], `[{"nome_socio": "FORTY-TWO", "cnpj_cpf_do_socio": "***456789**"}]`}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := pg.AddPartners(context.Background(), data); err != nil {
+					b.Fatalf("expected no error adding partners, got %s", err)
+				}
+			}
+			reportRowsPerSecond(b, b.N*n)
+		})
+	}
+}
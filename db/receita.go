@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// receitaCSVOptions are the CSV options of the files published by the Federal
+// Revenue.
+var receitaCSVOptions = CSVOptions{Delimiter: ';', Encoding: "iso-8859-1"}
+
+const (
+	empresasColumns         = 7
+	estabelecimentosColumns = 30
+)
+
+var (
+	matrizFilialDescriptions = map[int]string{1: "MATRIZ", 2: "FILIAL"}
+	situacaoDescriptions     = map[int]string{1: "NULA", 2: "ATIVA", 3: "SUSPENSA", 4: "INAPTA", 8: "BAIXADA"}
+	porteDescriptions        = map[int]string{0: "NÃO INFORMADO", 1: "MICRO EMPRESA", 3: "EMPRESA DE PEQUENO PORTE", 5: "DEMAIS"}
+)
+
+// receitaInt converts a number from the Federal Revenue CSV files, returning
+// nil for empty values (serialized as null in the JSON).
+func receitaInt(v string) (*int, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("error converting %s to int: %w", v, err)
+	}
+	return &i, nil
+}
+
+// receitaDate converts a YYYYMMDD date from the Federal Revenue CSV files to
+// YYYY-MM-DD, returning nil for empty values or dates with only zeros.
+func receitaDate(v string) (*string, error) {
+	v = strings.TrimSpace(v)
+	if strings.Trim(v, "0") == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("20060102", v)
+	if err != nil {
+		return nil, fmt.Errorf("error converting %s to date: %w", v, err)
+	}
+	d := t.Format("2006-01-02")
+	return &d, nil
+}
+
+// describe returns the description of a code, or nil if there is none.
+func describe(m map[int]string, i *int) *string {
+	if i == nil {
+		return nil
+	}
+	if s, ok := m[*i]; ok {
+		return &s
+	}
+	return nil
+}
+
+// empresaData parses a row of the Empresas files, returning the base CNPJ and
+// the JSON with the fields of the company shared by all of its venues.
+func empresaData(r []string) (string, string, error) {
+	if _, _, err := rangeFor(r[0]); err != nil {
+		return "", "", err
+	}
+	natureza, err := receitaInt(r[2])
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing codigo_natureza_juridica: %w", err)
+	}
+	qualificacao, err := receitaInt(r[3])
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing qualificacao_do_responsavel: %w", err)
+	}
+	var capital *float64
+	if v := strings.TrimSpace(r[4]); v != "" {
+		f, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", "."), 64)
+		if err != nil {
+			return "", "", fmt.Errorf("error parsing capital_social %s: %w", v, err)
+		}
+		capital = &f
+	}
+	porte, err := receitaInt(r[5])
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing codigo_porte: %w", err)
+	}
+	b, err := json.Marshal(map[string]any{
+		"razao_social":                r[1],
+		"codigo_natureza_juridica":    natureza,
+		"qualificacao_do_responsavel": qualificacao,
+		"capital_social":              capital,
+		"codigo_porte":                porte,
+		"porte":                       describe(porteDescriptions, porte),
+		"ente_federativo_responsavel": r[6],
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error serializing empresa %s: %w", r[0], err)
+	}
+	return r[0], string(b), nil
+}
+
+// estabelecimentoData parses a row of the Estabelecimentos files, returning
+// the CNPJ and the JSON with the fields of the venue.
+func estabelecimentoData(r []string) (string, string, error) {
+	ints := make(map[int]*int)
+	for _, i := range []int{3, 5, 7, 9, 11, 20} {
+		v, err := receitaInt(r[i])
+		if err != nil {
+			return "", "", fmt.Errorf("error parsing column %d: %w", i+1, err)
+		}
+		ints[i] = v
+	}
+	dates := make(map[int]*string)
+	for _, i := range []int{6, 10, 29} {
+		v, err := receitaDate(r[i])
+		if err != nil {
+			return "", "", fmt.Errorf("error parsing column %d: %w", i+1, err)
+		}
+		dates[i] = v
+	}
+	id := r[0] + r[1] + r[2]
+	if _, err := strconv.ParseInt(id, 10, 0); err != nil {
+		return "", "", fmt.Errorf("error converting cnpj %s to integer: %w", id, err)
+	}
+	var email *string
+	if r[27] != "" {
+		email = &r[27]
+	}
+	b, err := json.Marshal(map[string]any{
+		"cnpj":                                  id,
+		"identificador_matriz_filial":           ints[3],
+		"descricao_identificador_matriz_filial": describe(matrizFilialDescriptions, ints[3]),
+		"nome_fantasia":                         r[4],
+		"situacao_cadastral":                    ints[5],
+		"descricao_situacao_cadastral":          describe(situacaoDescriptions, ints[5]),
+		"data_situacao_cadastral":               dates[6],
+		"motivo_situacao_cadastral":             ints[7],
+		"nome_cidade_no_exterior":               r[8],
+		"codigo_pais":                           ints[9],
+		"data_inicio_atividade":                 dates[10],
+		"cnae_fiscal":                           ints[11],
+		"descricao_tipo_de_logradouro":          r[13],
+		"logradouro":                            r[14],
+		"numero":                                r[15],
+		"complemento":                           r[16],
+		"bairro":                                r[17],
+		"cep":                                   r[18],
+		"uf":                                    r[19],
+		"codigo_municipio":                      ints[20],
+		"ddd_telefone_1":                        r[21] + r[22],
+		"ddd_telefone_2":                        r[23] + r[24],
+		"ddd_fax":                               r[25] + r[26],
+		"email":                                 email,
+		"situacao_especial":                     r[28],
+		"data_situacao_especial":                dates[29],
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error serializing estabelecimento %s: %w", id, err)
+	}
+	return id, string(b), nil
+}
+
+// importReceitaCSV reads a CSV from the Federal Revenue with the expected
+// number of columns, parses each row with parse, and calls save with batches
+// of the parsed rows (see `UpdateOptions`). It returns the number of rows
+// saved.
+func (p *PostgreSQL) importReceitaCSV(
+	ctx context.Context,
+	r io.Reader,
+	columns int,
+	parse func([]string) (string, string, error),
+	save func(context.Context, [][]string) error,
+) (int64, error) {
+	size := p.UpdateOptions.BatchSize
+	if size <= 0 {
+		size = DefaultUpdateBatchSize
+	}
+	c, err := receitaCSVOptions.reader(r)
+	if err != nil {
+		return 0, fmt.Errorf("error creating csv reader: %w", err)
+	}
+	c.FieldsPerRecord = columns
+	var t int64
+	var b [][]string
+	for l := 1; ; l++ {
+		row, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return t, fmt.Errorf("error reading csv line %d: %w", l, err)
+		}
+		k, v, err := parse(row)
+		if err != nil {
+			return t, fmt.Errorf("error in csv line %d: %w", l, err)
+		}
+		b = append(b, []string{k, v})
+		if len(b) == size {
+			if err := save(ctx, b); err != nil {
+				return t, err
+			}
+			t += int64(len(b))
+			b = nil
+		}
+	}
+	if len(b) > 0 {
+		if err := save(ctx, b); err != nil {
+			return t, err
+		}
+		t += int64(len(b))
+	}
+	return t, nil
+}
+
+// ImportEstabelecimentos reads one of the Estabelecimentos CSV files from the
+// Federal Revenue (semicolon separated and encoded in ISO-8859-1) and upserts
+// the fields of each venue in its JSON, creating companies that do not exist
+// yet. Only codes are saved for fields whose descriptions depend on lookup
+// tables (e.g. `codigo_municipio`, `codigo_pais`, `cnae_fiscal`), keeping
+// existing descriptions untouched. It does not work with compressed JSON (see
+// `ErrCompressedJSON`).
+func (p *PostgreSQL) ImportEstabelecimentos(ctx context.Context, r io.Reader) error {
+	n, err := p.importReceitaCSV(ctx, r, estabelecimentosColumns, estabelecimentoData, func(ctx context.Context, b [][]string) error {
+		_, _, err := p.UpsertCompanies(ctx, b)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error importing estabelecimentos: %w", err)
+	}
+	p.log().Info("Estabelecimentos imported", "rows", n, "table", p.CompanyTableFullName())
+	return nil
+}
+
+// ImportEmpresas reads one of the Empresas CSV files from the Federal Revenue
+// (semicolon separated and encoded in ISO-8859-1) and merges the company data
+// in the JSON of all of its venues. Venues are created by
+// `ImportEstabelecimentos`, so this should be called after it; rows of
+// companies without venues are ignored. As in `ImportEstabelecimentos`, the
+// description of `codigo_natureza_juridica` is kept untouched. It does not
+// work with compressed JSON (see `ErrCompressedJSON`).
+func (p *PostgreSQL) ImportEmpresas(ctx context.Context, r io.Reader) error {
+	n, err := p.importReceitaCSV(ctx, r, empresasColumns, empresaData, func(ctx context.Context, b [][]string) error {
+		var u updateBatch
+		for _, r := range b {
+			first, last, err := rangeFor(r[0])
+			if err != nil {
+				return err
+			}
+			u.firsts = append(u.firsts, first)
+			u.lasts = append(u.lasts, last)
+			u.data = append(u.data, r[1])
+		}
+		return p.updateCompanies(ctx, &u)
+	})
+	if err != nil {
+		return fmt.Errorf("error importing empresas: %w", err)
+	}
+	p.log().Info("Empresas imported", "rows", n, "table", p.CompanyTableFullName())
+	return nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const (
+	testEmpresa         = `"19131243";"OPEN KNOWLEDGE BRASIL";"3999";"16";"0,00";"01";""`
+	testEstabelecimento = `"19131243";"0001";"97";"1";"";"02";"20150923";"00";"";"";"20131023";"9430800";"9493600,9499500";"RUA";"JOSE DA SILVA";"123";"";"CENTRO";"01001000";"SP";"7107";"11";"23456789";"";"";"";"";"";"";"00000000"`
+)
+
+func TestEmpresaData(t *testing.T) {
+	p := PostgreSQL{}
+	c, err := receitaCSVOptions.reader(strings.NewReader(testEmpresa))
+	if err != nil {
+		t.Fatalf("expected no error creating the csv reader, got %s", err)
+	}
+	r, err := c.Read()
+	if err != nil {
+		t.Fatalf("expected no error reading the csv, got %s", err)
+	}
+	k, v, err := empresaData(r)
+	if err != nil {
+		t.Fatalf("expected no error parsing empresa, got %s", err)
+	}
+	if k != "19131243" {
+		t.Errorf("expected base cnpj 19131243, got %s", k)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(v), &got); err != nil {
+		t.Fatalf("expected valid json, got %s", err)
+	}
+	for f, e := range map[string]any{
+		"razao_social":             "OPEN KNOWLEDGE BRASIL",
+		"codigo_natureza_juridica": 3999.0,
+		"capital_social":           0.0,
+		"codigo_porte":             1.0,
+		"porte":                    "MICRO EMPRESA",
+	} {
+		if got[f] != e {
+			t.Errorf("expected %s to be %v, got %v", f, e, got[f])
+		}
+	}
+	if _, err := p.importReceitaCSV(context.Background(), strings.NewReader(`"42";"";"";"";"";"";""`), empresasColumns, empresaData, nil); err == nil {
+		t.Error("expected an error for an invalid base cnpj, got nil")
+	}
+}
+
+func TestEstabelecimentoData(t *testing.T) {
+	p := PostgreSQL{}
+	c, err := receitaCSVOptions.reader(strings.NewReader(testEstabelecimento))
+	if err != nil {
+		t.Fatalf("expected no error creating the csv reader, got %s", err)
+	}
+	r, err := c.Read()
+	if err != nil {
+		t.Fatalf("expected no error reading the csv, got %s", err)
+	}
+	k, v, err := estabelecimentoData(r)
+	if err != nil {
+		t.Fatalf("expected no error parsing estabelecimento, got %s", err)
+	}
+	if k != "19131243000197" {
+		t.Errorf("expected cnpj 19131243000197, got %s", k)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(v), &got); err != nil {
+		t.Fatalf("expected valid json, got %s", err)
+	}
+	for f, e := range map[string]any{
+		"descricao_identificador_matriz_filial": "MATRIZ",
+		"descricao_situacao_cadastral":          "ATIVA",
+		"data_situacao_cadastral":               "2015-09-23",
+		"data_inicio_atividade":                 "2013-10-23",
+		"cnae_fiscal":                           9430800.0,
+		"codigo_municipio":                      7107.0,
+		"ddd_telefone_1":                        "1123456789",
+		"email":                                 nil,
+		"data_situacao_especial":                nil,
+	} {
+		if got[f] != e {
+			t.Errorf("expected %s to be %v, got %v", f, e, got[f])
+		}
+	}
+	for _, c := range []string{
+		`"19131243";"0001";"97"`,
+		strings.Replace(testEstabelecimento, "20150923", "2015-09-23", 1),
+		strings.Replace(testEstabelecimento, `"0001"`, `"ABCD"`, 1),
+	} {
+		if _, err := p.importReceitaCSV(context.Background(), strings.NewReader(c), estabelecimentosColumns, estabelecimentoData, nil); err == nil {
+			t.Errorf("expected an error for %s, got nil", c)
+		}
+	}
+}
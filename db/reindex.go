@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// minReindexConcurrentlyVersionNum is the first PostgreSQL version (as in
+// server_version_num) with REINDEX CONCURRENTLY.
+const minReindexConcurrentlyVersionNum = 120000
+
+func (p *PostgreSQL) reindex(ctx context.Context, tmpl string) error {
+	p.log().InfoContext(ctx, "Reindexing table…", "table", p.CompanyTableFullName())
+	t := time.Now()
+	if _, err := p.pool.Exec(ctx, p.sql[tmpl]); err != nil {
+		return fmt.Errorf("error reindexing table with: %s\n%w", p.sql[tmpl], err)
+	}
+	p.log().InfoContext(ctx, "Table reindexed", "table", p.CompanyTableFullName(), "duration", time.Since(t))
+	return p.AnalyzeTable(ctx)
+}
+
+// Reindex rebuilds all the indexes of the companies table, e.g. after data
+// corruption or a failed import left them inconsistent, and then updates the
+// query planner statistics (see `AnalyzeTable`). It uses REINDEX CONCURRENTLY,
+// which does not lock the table, but falls back to `ReindexLocking` (with a
+// warning) in PostgreSQL older than 12.
+func (p *PostgreSQL) Reindex(ctx context.Context) error {
+	if p.serverVersionNum < minReindexConcurrentlyVersionNum {
+		p.log().WarnContext(ctx, "REINDEX CONCURRENTLY requires PostgreSQL 12 or newer, the table will be locked while reindexing", "version_num", p.serverVersionNum)
+		return p.ReindexLocking(ctx)
+	}
+	return p.reindex(ctx, "reindex_concurrently")
+}
+
+// ReindexLocking works as `Reindex`, but uses a plain REINDEX, which blocks
+// writes to the table (and reads using its indexes) while it runs. It is
+// usually faster than REINDEX CONCURRENTLY and, unlike it, does not leave
+// invalid indexes behind if it fails.
+func (p *PostgreSQL) ReindexLocking(ctx context.Context) error {
+	return p.reindex(ctx, "reindex")
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	importReportKey = "import_report"
+
+	// maximum number of errors in the import report, keeping the metadata
+	// value small
+	maxImportReportErrors = 100
+)
+
+// RowError is an error importing companies, identified by their base CNPJ
+// (empty for errors not related to specific companies).
+type RowError struct {
+	BaseCNPJ string `json:"base_cnpj,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ImportReport summarizes the last step of an import.
+type ImportReport struct {
+	Step          string     `json:"step"`
+	RowsSucceeded int64      `json:"rows_succeeded"`
+	RowsFailed    int64      `json:"rows_failed"`
+	Errors        []RowError `json:"errors"`
+}
+
+// importReport collects the results of `CreateCompanies` during an import.
+type importReport struct {
+	mutex     sync.Mutex
+	succeeded int64
+	failed    int64
+	errors    []RowError
+	bases     map[string]struct{}
+}
+
+func newImportReport() *importReport {
+	return &importReport{bases: make(map[string]struct{})}
+}
+
+func (r *importReport) success(batch [][]any) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.succeeded += int64(len(batch))
+}
+
+// failure records a batch that could not be saved, with one error per base
+// CNPJ in the batch (up to `maxImportReportErrors` in total).
+func (r *importReport) failure(batch [][]any, err error) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failed += int64(len(batch))
+	for _, row := range batch {
+		if len(r.errors) >= maxImportReportErrors {
+			return
+		}
+		b := fmt.Sprintf("%014d", row[0])[:8]
+		if _, ok := r.bases[b]; ok {
+			continue
+		}
+		r.bases[b] = struct{}{}
+		r.errors = append(r.errors, RowError{b, err.Error()})
+	}
+}
+
+func (r *importReport) snapshot(step string, err error) ImportReport {
+	s := ImportReport{Step: step, Errors: []RowError{}}
+	if r != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		s.RowsSucceeded = r.succeeded
+		s.RowsFailed = r.failed
+		s.Errors = append(s.Errors, r.errors...)
+	}
+	if err != nil {
+		s.Errors = append(s.Errors, RowError{Message: err.Error()})
+	}
+	return s
+}
+
+// SaveImportReport saves to the metadata table a report of an import step,
+// with the number of companies saved (or not) by `CreateCompanies` so far,
+// and the error that interrupted the step, if any.
+func (p *PostgreSQL) SaveImportReport(step string, stepErr error) error {
+	b, err := json.Marshal(p.report.snapshot(step, stepErr))
+	if err != nil {
+		return fmt.Errorf("error serializing import report: %w", err)
+	}
+	return p.MetaSave(importReportKey, string(b))
+}
+
+// GetImportReport reads the report saved by `SaveImportReport`.
+func (p *PostgreSQL) GetImportReport(ctx context.Context) (ImportReport, error) {
+	var r ImportReport
+	rows, err := p.pool.Query(ctx, p.sql["meta_read"], importReportKey)
+	if err != nil {
+		return r, fmt.Errorf("error looking for the import report: %w", err)
+	}
+	v, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	if err != nil {
+		return r, fmt.Errorf("error reading the import report: %w", err)
+	}
+	if err := json.Unmarshal([]byte(v), &r); err != nil {
+		return r, fmt.Errorf("error parsing the import report: %w", err)
+	}
+	return r, nil
+}
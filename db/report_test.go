@@ -0,0 +1,33 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestImportReport(t *testing.T) {
+	r := newImportReport()
+	r.success([][]any{{33683111000280, "{}"}, {19131243000197, "{}"}})
+	r.failure([][]any{{191000110, "{}"}, {191000200, "{}"}, {33683111000280, "{}"}}, errors.New("forty-two"))
+	got := r.snapshot("companies", errors.New("interrupted"))
+	expected := ImportReport{
+		Step:          "companies",
+		RowsSucceeded: 2,
+		RowsFailed:    3,
+		Errors: []RowError{
+			{"00000191", "forty-two"},
+			{"33683111", "forty-two"},
+			{"", "interrupted"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected report %+v, got %+v", expected, got)
+	}
+
+	var n *importReport
+	n.success([][]any{{33683111000280, "{}"}})
+	if got := n.snapshot("companies", nil); got.RowsSucceeded != 0 || len(got.Errors) != 0 {
+		t.Errorf("expected an empty report without a collector, got %+v", got)
+	}
+}
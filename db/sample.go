@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// the sample percentage is multiplied by this factor so the random sample
+// is unlikely to have less than the requested number of companies
+const sampleOversampling = 2
+
+// samplePercentage is the percentage of the table to sample to get about n
+// rows out of total.
+func samplePercentage(n int, total int64) float64 {
+	if total <= 0 {
+		return 100
+	}
+	p := float64(n) / float64(total) * 100 * sampleOversampling
+	if p > 100 {
+		return 100
+	}
+	return p
+}
+
+// SampleCompanies returns the JSON of up to n random companies, useful for
+// testing and benchmarking. It samples the table (TABLESAMPLE BERNOULLI)
+// based on the approximate row count, so it might return less than n
+// companies.
+func (p *PostgreSQL) SampleCompanies(ctx context.Context, n int) ([]string, error) {
+	t, err := p.RowCountApproximate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.pool.Query(ctx, p.sql["sample_companies"], samplePercentage(n, t), n)
+	if err != nil {
+		return nil, fmt.Errorf("error sampling companies: %w", err)
+	}
+	s, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (string, error) {
+		var j string
+		if err := r.Scan(&j); err != nil {
+			return "", err
+		}
+		return decompressJSON(j)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading sampled companies: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,20 @@
+package db
+
+import "testing"
+
+func TestSamplePercentage(t *testing.T) {
+	for _, c := range []struct {
+		n        int
+		total    int64
+		expected float64
+	}{
+		{10, 0, 100},
+		{10, 10, 100},
+		{10, 1000, 2},
+		{1, 800, 0.25},
+	} {
+		if got := samplePercentage(c.n, c.total); got != c.expected {
+			t.Errorf("expected sample percentage for %d out of %d to be %f, got %f", c.n, c.total, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidSchemaName is returned when a schema name is not made of lower
+// case letters, digits and underscores.
+var ErrInvalidSchemaName = errors.New("invalid schema name")
+
+var schemaName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+func validateSchemaName(n string) error {
+	if !schemaName.MatchString(n) {
+		return fmt.Errorf("%w: %q", ErrInvalidSchemaName, n)
+	}
+	return nil
+}
+
+// SchemaManager creates, drops and lists schemas, allowing isolated copies of
+// the data (e.g. one per client) in the same PostgreSQL instance.
+type SchemaManager struct {
+	db *PostgreSQL
+}
+
+// NewSchemaManager creates a SchemaManager using the same connection pool as
+// the given PostgreSQL.
+func NewSchemaManager(p *PostgreSQL) *SchemaManager {
+	return &SchemaManager{db: p}
+}
+
+// CreateSchema creates a schema if it does not exist yet.
+func (m *SchemaManager) CreateSchema(ctx context.Context, name string) error {
+	if err := validateSchemaName(name); err != nil {
+		return err
+	}
+	q := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", pgx.Identifier{name}.Sanitize())
+	if _, err := m.db.pool.Exec(ctx, q); err != nil {
+		return fmt.Errorf("error creating schema %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropSchema drops a schema. If cascade is false, it fails if the schema has
+// any table.
+func (m *SchemaManager) DropSchema(ctx context.Context, name string, cascade bool) error {
+	if err := validateSchemaName(name); err != nil {
+		return err
+	}
+	q := fmt.Sprintf("DROP SCHEMA IF EXISTS %s", pgx.Identifier{name}.Sanitize())
+	if cascade {
+		q += " CASCADE"
+	}
+	if _, err := m.db.pool.Exec(ctx, q); err != nil {
+		return fmt.Errorf("error dropping schema %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListSchemas lists the schemas with the companies table.
+func (m *SchemaManager) ListSchemas(ctx context.Context) ([]string, error) {
+	rows, err := m.db.pool.Query(ctx, m.db.sql["list_schemas"])
+	if err != nil {
+		return nil, fmt.Errorf("error listing schemas: %w", err)
+	}
+	s, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error reading schemas: %w", err)
+	}
+	return s, nil
+}
+
+// SchemaExists checks whether a schema exists.
+func (m *SchemaManager) SchemaExists(ctx context.Context, name string) (bool, error) {
+	if err := validateSchemaName(name); err != nil {
+		return false, err
+	}
+	var ok bool
+	if err := m.db.pool.QueryRow(ctx, m.db.sql["schema_exists"], name).Scan(&ok); err != nil {
+		return false, fmt.Errorf("error checking if schema %s exists: %w", name, err)
+	}
+	return ok, nil
+}
+
+// ListTables lists the tables in the schema used by this database.
+func (p *PostgreSQL) ListTables(ctx context.Context) ([]string, error) {
+	rows, err := p.pool.Query(ctx, p.sql["list_tables"], p.schema)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables in %s: %w", p.schema, err)
+	}
+	t, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error reading tables in %s: %w", p.schema, err)
+	}
+	return t, nil
+}
+
+// TableExists checks whether a table exists in the schema used by this
+// database.
+func (p *PostgreSQL) TableExists(ctx context.Context, name string) (bool, error) {
+	ts, err := p.ListTables(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range ts {
+		if t == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
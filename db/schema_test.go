@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateSchemaName(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		valid bool
+	}{
+		{"public", true},
+		{"_client_42", true},
+		{"client42", true},
+		{"", false},
+		{"42client", false},
+		{"Client", false},
+		{"client-42", false},
+		{"public; DROP TABLE cnpj", false},
+	} {
+		err := validateSchemaName(c.name)
+		if c.valid && err != nil {
+			t.Errorf("expected %q to be valid, got %s", c.name, err)
+		}
+		if !c.valid && !errors.Is(err, ErrInvalidSchemaName) {
+			t.Errorf("expected %q to be invalid, got %v", c.name, err)
+		}
+	}
+}
+
+func TestSchemaManagerRejectsInvalidNames(t *testing.T) {
+	m := NewSchemaManager(&PostgreSQL{})
+	if err := m.CreateSchema(context.Background(), "a;b"); !errors.Is(err, ErrInvalidSchemaName) {
+		t.Errorf("expected ErrInvalidSchemaName creating schema, got %v", err)
+	}
+	if err := m.DropSchema(context.Background(), "a;b", true); !errors.Is(err, ErrInvalidSchemaName) {
+		t.Errorf("expected ErrInvalidSchemaName dropping schema, got %v", err)
+	}
+	if _, err := m.SchemaExists(context.Background(), "a;b"); !errors.Is(err, ErrInvalidSchemaName) {
+		t.Errorf("expected ErrInvalidSchemaName checking schema, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidCPF is returned when a CPF used in a search is not valid.
+var ErrInvalidCPF = errors.New("invalid cpf")
+
+// ErrInvalidCursor is returned when the cursor of `GetCompaniesByBasePaged`
+// does not belong to the requested base CNPJ.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// the Federal Revenue publishes partners' CPF with only the 6 middle digits
+var maskedCPF = regexp.MustCompile(`^\*{3}\d{6}\*{2}$`)
+
+// partnerCPF converts a CPF (formatted or not) to the masked version published
+// by the Federal Revenue, e.g. 123.456.789-01 becomes ***456789**.
+func partnerCPF(cpf string) (string, error) {
+	c := strings.NewReplacer(".", "", "-", "").Replace(strings.TrimSpace(cpf))
+	if maskedCPF.MatchString(c) {
+		return c, nil
+	}
+	if len(c) != 11 {
+		return "", fmt.Errorf("%w: %s should have 11 digits", ErrInvalidCPF, cpf)
+	}
+	for _, r := range c {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: %s should have only digits", ErrInvalidCPF, cpf)
+		}
+	}
+	return "***" + c[3:9] + "**", nil
+}
+
+// CreateJSONBIndexes creates the indexes used to search inside the JSON data,
+// such as the GIN index for `SearchByPartner` and the municipality index for
+// `GetCompaniesByMunicipality`. They are optional, and can take
+// long to build, but they are created concurrently not to lock the table.
+func (p *PostgreSQL) CreateJSONBIndexes(ctx context.Context) error {
+	p.log().InfoContext(ctx, "Creating JSONB indexes…", "table", p.CompanyTableFullName())
+	if err := p.execStatements(ctx, "create_jsonb_indexes"); err != nil {
+		return fmt.Errorf("error creating jsonb indexes: %w", err)
+	}
+	return nil
+}
+
+// SearchByPartner returns the JSON of the companies that have a partner with
+// the given CPF. Since the Federal Revenue publishes only the 6 middle digits
+// of partners' CPF, different people might match the same search.
+//
+// Privacy: searching companies by people's CPF deals with personal data, and
+// deployments subject to LGPD (Lei Geral de Proteção de Dados) might require
+// authorization before exposing this search.
+func (p *PostgreSQL) SearchByPartner(ctx context.Context, cpf string, limit, offset int) ([]string, error) {
+	c, err := partnerCPF(cpf)
+	if err != nil {
+		return nil, err
+	}
+	q, err := json.Marshal([]map[string]string{{"cnpj_cpf_do_socio": c}})
+	if err != nil {
+		return nil, fmt.Errorf("error creating the partner query: %w", err)
+	}
+	rows, err := p.pool.Query(ctx, p.sql["search_by_partner"], string(q), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error searching for partner %s: %w", c, err)
+	}
+	r, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error reading companies for partner %s: %w", c, err)
+	}
+	return r, nil
+}
+
+// Page is a page of results of a paginated query.
+type Page struct {
+	Results []string `json:"results"`
+	Total   int64    `json:"total"`
+	HasNext bool     `json:"has_next"`
+}
+
+// GetCompaniesByMunicipality returns a page of the JSON of the companies
+// registered in a municipality, using the Federal Revenue municipality code.
+// The total is calculated in the same query, so there is no need for an extra
+// count query. When the offset is beyond the last result, the total is zero.
+func (p *PostgreSQL) GetCompaniesByMunicipality(ctx context.Context, municipioCode string, limit, offset int) (Page, error) {
+	var pg Page
+	rows, err := p.pool.Query(ctx, p.sql["companies_by_municipality"], municipioCode, limit, offset)
+	if err != nil {
+		return pg, fmt.Errorf("error looking for companies in municipality %s: %w", municipioCode, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var j string
+		if err := rows.Scan(&j, &pg.Total); err != nil {
+			return pg, fmt.Errorf("error reading companies in municipality %s: %w", municipioCode, err)
+		}
+		pg.Results = append(pg.Results, j)
+	}
+	if err := rows.Err(); err != nil {
+		return pg, fmt.Errorf("error reading companies in municipality %s: %w", municipioCode, err)
+	}
+	pg.HasNext = int64(offset+len(pg.Results)) < pg.Total
+	return pg, nil
+}
+
+// GetCompaniesByBasePaged returns a page of the JSON of the venues of a
+// company, given its base CNPJ (first 8 digits), using the ID as cursor. The
+// first page is requested with cursor 0, and the next ones with the cursor
+// returned by the previous call, which is 0 when there are no more results.
+// Unlike offset pagination, each page costs the same regardless of how many
+// venues come before it.
+func (p *PostgreSQL) GetCompaniesByBasePaged(ctx context.Context, base string, pageSize int, cursor int64) ([]string, int64, error) {
+	if pageSize < 1 {
+		return nil, 0, fmt.Errorf("page size should be positive, got %d", pageSize)
+	}
+	first, last, err := rangeFor(base)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cursor == 0 {
+		cursor = first - 1
+	} else if cursor < first || cursor > last {
+		return nil, 0, fmt.Errorf("%w: %d is not a cnpj with base %s", ErrInvalidCursor, cursor, base)
+	}
+	rows, err := p.pool.Query(ctx, p.sql["companies_by_base_paged"], cursor, last, pageSize+1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error looking for companies with base cnpj %s: %w", base, err)
+	}
+	defer rows.Close()
+	var r []string
+	var next int64
+	for rows.Next() {
+		if len(r) == pageSize {
+			return r, next, nil
+		}
+		var j string
+		if err := rows.Scan(&next, &j); err != nil {
+			return nil, 0, fmt.Errorf("error reading companies with base cnpj %s: %w", base, err)
+		}
+		r = append(r, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error reading companies with base cnpj %s: %w", base, err)
+	}
+	return r, 0, nil
+}
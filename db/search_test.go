@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPartnerCPF(t *testing.T) {
+	for _, c := range []struct {
+		cpf      string
+		expected string
+		err      bool
+	}{
+		{"12345678901", "***456789**", false},
+		{"123.456.789-01", "***456789**", false},
+		{"***456789**", "***456789**", false},
+		{"1234567890", "", true},
+		{"1234567890a", "", true},
+		{"", "", true},
+	} {
+		got, err := partnerCPF(c.cpf)
+		if c.err {
+			if !errors.Is(err, ErrInvalidCPF) {
+				t.Errorf("expected ErrInvalidCPF for %q, got %v", c.cpf, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error for %q, got %s", c.cpf, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected %q to become %s, got %s", c.cpf, c.expected, got)
+		}
+	}
+}
+
+func TestGetCompaniesByBasePagedInvalidArguments(t *testing.T) {
+	p := PostgreSQL{}
+	for _, c := range []struct {
+		base     string
+		pageSize int
+		cursor   int64
+	}{
+		{"19131243", 0, 0},
+		{"42", 10, 0},
+		{"19131243", 10, 33683111000280},
+	} {
+		if _, _, err := p.GetCompaniesByBasePaged(context.Background(), c.base, c.pageSize, c.cursor); err == nil {
+			t.Errorf("expected an error for base %s, page size %d and cursor %d, got nil", c.base, c.pageSize, c.cursor)
+		}
+	}
+	if _, _, err := p.GetCompaniesByBasePaged(context.Background(), "19131243", 10, 42); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoPrimaryKey is returned by `ShrinkConcurrent` when the companies table
+// was not indexed yet (see `CreateIndex`).
+var ErrNoPrimaryKey = errors.New("table has no primary key")
+
+// shrink runs a template that rewrites the companies table, logging its size
+// before and after it.
+func (p *PostgreSQL) shrink(ctx context.Context, tmpl string) error {
+	before, err := p.TableSize(ctx)
+	if err != nil {
+		return err
+	}
+	p.log().InfoContext(ctx, "Shrinking table…", "table", p.CompanyTableFullName(), "total_bytes", before.TotalBytes)
+	t := time.Now()
+	if _, err := p.pool.Exec(ctx, p.sql[tmpl]); err != nil {
+		return fmt.Errorf("error shrinking table with: %s\n%w", p.sql[tmpl], err)
+	}
+	after, err := p.TableSize(ctx)
+	if err != nil {
+		return err
+	}
+	p.log().InfoContext(ctx, "Table shrunk", "table", p.CompanyTableFullName(), "total_bytes", after.TotalBytes, "reclaimed_bytes", before.TotalBytes-after.TotalBytes, "duration", time.Since(t))
+	return nil
+}
+
+// Shrink rewrites the companies table with VACUUM FULL, returning to the
+// operating system the disk space of deleted rows (e.g. after `BulkDelete`),
+// which a plain VACUUM (e.g. autovacuum) only makes available for new rows in
+// the table. The table is locked, even for reading, while it runs.
+func (p *PostgreSQL) Shrink(ctx context.Context) error {
+	return p.shrink(ctx, "vacuum_full")
+}
+
+// ShrinkConcurrent works as `Shrink`, but rewrites the table with CLUSTER using
+// the primary key, which also sorts the rows by CNPJ. CLUSTER locks the table
+// as well, yet it usually takes less time than VACUUM FULL in tables with few
+// dead rows. It requires the primary key created by `CreateIndex`.
+func (p *PostgreSQL) ShrinkConcurrent(ctx context.Context) error {
+	ok, err := p.hasPrimaryKey(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoPrimaryKey, p.CompanyTableFullName())
+	}
+	return p.shrink(ctx, "cluster")
+}
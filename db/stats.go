@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// metadata key with the result of the last `RowCountExact`
+const exactRowCountKey = "exact_row_count"
+
+// how far (as a fraction) the approximate row count can be from the last exact
+// count before a warning is logged
+const rowCountTolerance = 0.05
+
+// TableSizeInfo has the disk space, in bytes, used by the companies table.
+type TableSizeInfo struct {
+	TableBytes int64 `json:"table_bytes"`
+	IndexBytes int64 `json:"index_bytes"`
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// TableSize returns the disk space used by the companies table and its
+// indexes.
+func (p *PostgreSQL) TableSize(ctx context.Context) (TableSizeInfo, error) {
+	var s TableSizeInfo
+	if err := p.pool.QueryRow(ctx, p.sql["table_size"]).Scan(&s.TableBytes, &s.IndexBytes, &s.TotalBytes); err != nil {
+		return s, fmt.Errorf("error getting the size of %s: %w", p.CompanyTableFullName(), err)
+	}
+	return s, nil
+}
+
+// MetaAll reads all the key/value pairs from the metadata table.
+func (p *PostgreSQL) MetaAll(ctx context.Context) (map[string]string, error) {
+	rows, err := p.pool.Query(ctx, p.sql["meta_all"])
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata: %w", err)
+	}
+	defer rows.Close()
+	m := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, fmt.Errorf("error reading metadata row: %w", err)
+		}
+		m[k] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading metadata: %w", err)
+	}
+	return m, nil
+}
+
+// PoolStats is a snapshot of the connection pool.
+type PoolStats struct {
+	TotalConns    int32 `json:"total_conns"`
+	AcquiredConns int32 `json:"acquired_conns"`
+	IdleConns     int32 `json:"idle_conns"`
+	MaxConns      int32 `json:"max_conns"`
+}
+
+// PoolStats returns the current state of the connection pool.
+func (p *PostgreSQL) PoolStats() PoolStats {
+	s := p.pool.Stat()
+	return PoolStats{
+		TotalConns:    s.TotalConns(),
+		AcquiredConns: s.AcquiredConns(),
+		IdleConns:     s.IdleConns(),
+		MaxConns:      s.MaxConns(),
+	}
+}
+
+// RowCountApproximate returns the number of rows in the companies table as
+// estimated by PostgreSQL statistics, which is immediate but updated only by
+// VACUUM, ANALYZE and index creation. It logs a warning if the estimate is more
+// than 5% away from the last `RowCountExact`.
+func (p *PostgreSQL) RowCountApproximate(ctx context.Context) (int64, error) {
+	var n int64
+	if err := p.pool.QueryRow(ctx, p.sql["row_count_approximate"]).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error estimating the number of rows in %s: %w", p.CompanyTableFullName(), err)
+	}
+	if n < 0 { // table never vacuumed or analyzed
+		n = 0
+	}
+	if v, err := p.MetaRead(exactRowCountKey); err == nil {
+		if e, err := strconv.ParseInt(v, 10, 0); err == nil && e > 0 {
+			if d := float64(n-e) / float64(e); d > rowCountTolerance || d < -rowCountTolerance {
+				p.log().WarnContext(ctx, "Approximate row count differs from the last exact count, consider running ANALYZE", "table", p.CompanyTableFullName(), "approximate", n, "exact", e, "tolerance", rowCountTolerance)
+			}
+		}
+	}
+	return n, nil
+}
+
+// RowCountExact counts the rows in the companies table, which might take
+// minutes in a full database. The result is saved to the metadata table to
+// check the accuracy of `RowCountApproximate`.
+func (p *PostgreSQL) RowCountExact(ctx context.Context) (int64, error) {
+	var n int64
+	if err := p.pool.QueryRow(ctx, p.sql["row_count_exact"]).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting the rows in %s: %w", p.CompanyTableFullName(), err)
+	}
+	if err := p.MetaSave(exactRowCountKey, strconv.FormatInt(n, 10)); err != nil {
+		p.log().WarnContext(ctx, "Could not save the exact row count", "table", p.CompanyTableFullName(), "error", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Default timeouts for operations whose context has no deadline.
+const (
+	DefaultGetTimeout         = 5 * time.Second
+	DefaultUpdateTimeout      = time.Minute
+	DefaultImportBatchTimeout = 5 * time.Minute
+	DefaultIndexTimeout       = 2 * time.Hour
+)
+
+// TimeoutConfig has the timeouts used when the context of an operation has no
+// deadline. A zero timeout means no timeout.
+type TimeoutConfig struct {
+	Get         time.Duration // reading companies
+	Update      time.Duration // upserting and deleting companies
+	ImportBatch time.Duration // saving each batch in `CreateCompanies`
+	Index       time.Duration // creating indexes
+}
+
+// DefaultTimeoutConfig returns a `TimeoutConfig` with the default timeouts.
+func DefaultTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{
+		Get:         DefaultGetTimeout,
+		Update:      DefaultUpdateTimeout,
+		ImportBatch: DefaultImportBatchTimeout,
+		Index:       DefaultIndexTimeout,
+	}
+}
+
+// ConfigFromEnv returns the default timeouts overridden by the environment
+// variables GET_TIMEOUT_SECONDS, UPDATE_TIMEOUT_SECONDS,
+// IMPORT_BATCH_TIMEOUT_SECONDS and INDEX_TIMEOUT_MINUTES.
+func ConfigFromEnv() (TimeoutConfig, error) {
+	c := DefaultTimeoutConfig()
+	for _, e := range []struct {
+		name string
+		unit time.Duration
+		dst  *time.Duration
+	}{
+		{"GET_TIMEOUT_SECONDS", time.Second, &c.Get},
+		{"UPDATE_TIMEOUT_SECONDS", time.Second, &c.Update},
+		{"IMPORT_BATCH_TIMEOUT_SECONDS", time.Second, &c.ImportBatch},
+		{"INDEX_TIMEOUT_MINUTES", time.Minute, &c.Index},
+	} {
+		v := os.Getenv(e.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("invalid %s %q: expected a non-negative integer", e.name, v)
+		}
+		*e.dst = time.Duration(n) * e.unit
+	}
+	return c, nil
+}
+
+// withTimeout adds a timeout to a context with no deadline. The returned
+// function must be called to release its resources.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
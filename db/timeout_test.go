@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GET_TIMEOUT_SECONDS", "10")
+	t.Setenv("INDEX_TIMEOUT_MINUTES", "90")
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("expected no error reading timeouts, got %s", err)
+	}
+	expected := TimeoutConfig{
+		Get:         10 * time.Second,
+		Update:      DefaultUpdateTimeout,
+		ImportBatch: DefaultImportBatchTimeout,
+		Index:       90 * time.Minute,
+	}
+	if c != expected {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+	t.Setenv("UPDATE_TIMEOUT_SECONDS", "forty-two")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("expected an error with an invalid timeout, got nil")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("expected a deadline in a context without one")
+	}
+	d := time.Now().Add(time.Hour)
+	parent, cancelParent := context.WithDeadline(context.Background(), d)
+	defer cancelParent()
+	ctx, cancel = withTimeout(parent, time.Second)
+	defer cancel()
+	if got, _ := ctx.Deadline(); !got.Equal(d) {
+		t.Errorf("expected the deadline of the parent context %s, got %s", d, got)
+	}
+	ctx, cancel = withTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline with a zero timeout")
+	}
+}
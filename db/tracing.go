@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Span is a unit of work in a trace.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(error)
+	End()
+}
+
+// Tracer starts spans. It is the subset of the OpenTelemetry tracing API used
+// by `OTELQueryTracer`, so a `trace.Tracer` from OpenTelemetry can be used
+// through a thin adapter, without making OpenTelemetry a dependency of
+// Minha Receita.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type spanKey struct{}
+
+// OTELQueryTracer implements `pgx.QueryTracer` creating a child span (of the
+// span in the context, if any) for each SQL query, with attributes named
+// after the OpenTelemetry semantic conventions for databases.
+type OTELQueryTracer struct {
+	tracer Tracer
+}
+
+// NewOTELQueryTracer creates a `OTELQueryTracer` using the given tracer.
+func NewOTELQueryTracer(t Tracer) *OTELQueryTracer { return &OTELQueryTracer{t} }
+
+// sanitizeQuery removes line breaks and indentation from a query. Queries use
+// placeholders for values, so arguments are never included in the span.
+func sanitizeQuery(q string) string { return strings.Join(strings.Fields(q), " ") }
+
+// TraceQueryStart starts the span of a query.
+func (t *OTELQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, s := t.tracer.Start(ctx, "postgresql.query")
+	s.SetAttribute("db.system", "postgresql")
+	s.SetAttribute("db.statement", sanitizeQuery(data.SQL))
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// TraceQueryEnd records the number of rows affected, or the error, and ends
+// the span of a query.
+func (t *OTELQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	s, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return
+	}
+	if data.Err != nil {
+		s.RecordError(data.Err)
+	} else {
+		s.SetAttribute("db.rows_affected", data.CommandTag.RowsAffected())
+	}
+	s.End()
+}
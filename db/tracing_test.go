@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type fakeSpan struct {
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (s *fakeSpan) SetAttribute(k string, v any) { s.attrs[k] = v }
+func (s *fakeSpan) RecordError(err error)        { s.err = err }
+func (s *fakeSpan) End()                         { s.ended = true }
+
+type fakeTracer struct{ spans []*fakeSpan }
+
+func (t *fakeTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	s := &fakeSpan{attrs: make(map[string]any)}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestOTELQueryTracer(t *testing.T) {
+	ft := &fakeTracer{}
+	qt := NewOTELQueryTracer(ft)
+	ctx := qt.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT json\n    FROM cnpj\n    WHERE id = $1;"})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+	ctx = qt.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 42"})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("forty-two")})
+
+	if len(ft.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(ft.spans))
+	}
+	s := ft.spans[0]
+	if got := s.attrs["db.statement"]; got != "SELECT json FROM cnpj WHERE id = $1;" {
+		t.Errorf("expected sanitized query in the span, got %q", got)
+	}
+	if got := s.attrs["db.rows_affected"]; got != int64(1) {
+		t.Errorf("expected 1 row affected, got %v", got)
+	}
+	if !s.ended {
+		t.Error("expected span to be ended")
+	}
+	if s := ft.spans[1]; s.err == nil || !s.ended {
+		t.Errorf("expected span with error to be ended, got %+v", s)
+	}
+}
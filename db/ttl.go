@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CompanyUpdatedAt reads the `updated_at` field of the `_meta` object of a
+// company JSON (in RFC 3339 format), returning false if it is not set.
+func CompanyUpdatedAt(j []byte) (time.Time, bool) {
+	var c struct {
+		Meta struct {
+			UpdatedAt time.Time `json:"updated_at"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(j, &c); err != nil || c.Meta.UpdatedAt.IsZero() {
+		return time.Time{}, false
+	}
+	return c.Meta.UpdatedAt, true
+}
+
+// GetCompanyWithTTL works as `GetCompany`, but also tells whether the company
+// data is stale, that is to say, older than maxAge, allowing callers to serve
+// the stale data while refreshing it in the background. The age comes from
+// `_meta.updated_at` in the company JSON, or from the date of the imported
+// data (see `GetImportSource`) if the company does not have it. If neither is
+// available, the data is not considered stale.
+func (p *PostgreSQL) GetCompanyWithTTL(ctx context.Context, id string, maxAge time.Duration) (string, bool, error) {
+	j, err := p.GetCompany(ctx, id)
+	if err != nil {
+		return "", false, err
+	}
+	t, ok := CompanyUpdatedAt([]byte(j))
+	if !ok {
+		src, err := p.GetImportSource(ctx)
+		if err != nil {
+			return j, false, nil
+		}
+		t = src.Date
+	}
+	return j, time.Since(t) > maxAge, nil
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompanyUpdatedAt(t *testing.T) {
+	for _, c := range []struct {
+		json     string
+		expected time.Time
+		ok       bool
+	}{
+		{`{"cnpj": "19131243000197", "_meta": {"updated_at": "2024-01-15T10:30:00Z"}}`, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), true},
+		{`{"cnpj": "19131243000197", "_meta": {}}`, time.Time{}, false},
+		{`{"cnpj": "19131243000197"}`, time.Time{}, false},
+		{`{"_meta": {"updated_at": "2024-01-15"}}`, time.Time{}, false},
+		{`{"_meta": 42}`, time.Time{}, false},
+	} {
+		got, ok := CompanyUpdatedAt([]byte(c.json))
+		if ok != c.ok || !got.Equal(c.expected) {
+			t.Errorf("expected %s and %t for %s, got %s and %t", c.expected, c.ok, c.json, got, ok)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// rough size, in bytes, of the JSON of a company
+	estimatedRowSize = 2 << 10
+
+	minBatchSize = 1024
+	maxBatchSize = 65536
+)
+
+// batchSizeFor estimates a safe batch size using up to half of the memory
+// available for each database operation (work_mem).
+func batchSizeFor(workMem int64) int {
+	n := int(workMem / 2 / estimatedRowSize)
+	if n < minBatchSize {
+		return minBatchSize
+	}
+	if n > maxBatchSize {
+		return maxBatchSize
+	}
+	return n
+}
+
+// AutoTuneBatchSize estimates a batch size for the import based on the
+// PostgreSQL memory settings and saves it to `BatchSize`.
+func (p *PostgreSQL) AutoTuneBatchSize(ctx context.Context) (int, error) {
+	var mem, conns int64
+	if err := p.pool.QueryRow(ctx, p.sql["memory_settings"]).Scan(&mem, &conns); err != nil {
+		return 0, fmt.Errorf("error reading postgres memory settings: %w", err)
+	}
+	p.BatchSize = batchSizeFor(mem)
+	p.log().InfoContext(ctx, "Using auto tuned batch size", "batch_size", p.BatchSize, "work_mem", mem, "max_connections", conns)
+	return p.BatchSize, nil
+}
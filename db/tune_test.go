@@ -0,0 +1,19 @@
+package db
+
+import "testing"
+
+func TestBatchSizeFor(t *testing.T) {
+	for _, c := range []struct {
+		workMem  int64
+		expected int
+	}{
+		{4 << 20, 1024},
+		{64 << 20, 16384},
+		{1 << 20, minBatchSize},
+		{4 << 30, maxBatchSize},
+	} {
+		if got := batchSizeFor(c.workMem); got != c.expected {
+			t.Errorf("expected batch size for work_mem of %d to be %d, got %d", c.workMem, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// customTypes are the names of the PostgreSQL types registered with
+// `RegisterCustomTypes`, loaded by every new connection of the pool.
+type customTypes struct {
+	mutex sync.RWMutex
+	names []string
+}
+
+func (c *customTypes) add(ns []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.names = append(c.names, ns...)
+}
+
+// register loads the types (in the order they were added, so composite types
+// can use the ones registered before them) into the type map of a connection.
+func (c *customTypes) register(ctx context.Context, conn *pgx.Conn) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return registerTypes(ctx, conn, c.names)
+}
+
+func registerTypes(ctx context.Context, conn *pgx.Conn, ns []string) error {
+	for _, n := range ns {
+		t, err := conn.LoadType(ctx, n)
+		if err != nil {
+			return fmt.Errorf("could not load type %s: %w", n, err)
+		}
+		conn.TypeMap().RegisterType(t)
+	}
+	return nil
+}
+
+// RegisterCustomTypes looks for PostgreSQL types by name in `pg_type` (e.g.
+// enums, domains or composite types created by extensions) and registers them
+// in the type map of every connection, so queries can use them as arguments
+// and results. Array types have to be registered after the type of their
+// elements. The connections of the pool are recreated, so queries running
+// when this is called are not affected.
+func (p *PostgreSQL) RegisterCustomTypes(ctx context.Context, types []string) error {
+	err := p.pool.AcquireFunc(ctx, func(c *pgxpool.Conn) error {
+		if err := p.types.register(ctx, c.Conn()); err != nil {
+			return err
+		}
+		return registerTypes(ctx, c.Conn(), types)
+	})
+	if err != nil {
+		return fmt.Errorf("error registering custom types: %w", err)
+	}
+	p.types.add(types)
+	p.pool.Reset()
+	return nil
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultUpdateBatchSize is how many records `UpdateCompaniesFromReader` sends
+// to the database at once, unless `UpdateOptions.BatchSize` is set.
+const DefaultUpdateBatchSize = 1024
+
+// UpdateOptions configures `UpdateCompaniesFromReader`.
+type UpdateOptions struct {
+	BatchSize int
+}
+
+// updateRecord is a line of the JSONL read by `UpdateCompaniesFromReader`.
+type updateRecord struct {
+	BaseCNPJ string          `json:"cnpj_basico"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// updateBatch has the ranges of IDs and the data of a batch of updates.
+type updateBatch struct {
+	firsts, lasts []int64
+	data          []string
+	line          int // last line in the batch, used in error messages
+}
+
+func (b *updateBatch) len() int { return len(b.data) }
+
+// updateCompanies merges the data of a batch in the JSON of the companies in
+// its ranges of IDs. Companies with compressed JSON are left untouched and
+// returned as an `ErrCompressedJSON` error.
+func (p *PostgreSQL) updateCompanies(ctx context.Context, b *updateBatch) error {
+	if p.CompressJSON {
+		return ErrCompressedJSON
+	}
+	ctx, cancel := withTimeout(ctx, p.Timeouts.Update)
+	defer cancel()
+	rows, err := p.pool.Query(ctx, p.sql["update_by_base"], b.firsts, b.lasts, b.data)
+	if err != nil {
+		return fmt.Errorf("error updating companies: %w", err)
+	}
+	var ids []int64
+	var compressed int64
+	var id int64
+	var c bool
+	if _, err := pgx.ForEachRow(rows, []any{&id, &c}, func() error {
+		if c {
+			compressed++
+		} else {
+			ids = append(ids, id)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("error reading updated companies: %w", err)
+	}
+	if err := p.companiesChanged(ctx, ids); err != nil {
+		return err
+	}
+	if compressed > 0 {
+		return errCompressedRows(compressed)
+	}
+	return nil
+}
+
+// UpdateCompaniesFromReader updates companies from a JSONL stream in which
+// each line has the base CNPJ (first 8 digits) and an object with the data to
+// be merged in the JSON of all the venues of this company, e.g.:
+//
+//	{"cnpj_basico": "19131243", "data": {"razao_social": "OPEN KNOWLEDGE BRASIL"}}
+//
+// The lines are read and sent to the database in batches (see
+// `UpdateOptions`), so the stream is never fully loaded to memory. It returns
+// the number of records processed.
+func (p *PostgreSQL) UpdateCompaniesFromReader(ctx context.Context, r io.Reader) (int64, error) {
+	return readUpdates(r, p.UpdateOptions.BatchSize, func(b *updateBatch) error {
+		return p.updateCompanies(ctx, b)
+	})
+}
+
+// ValidateUpdates reads a JSONL stream in the format of
+// `UpdateCompaniesFromReader` without writing to the database, e.g. for dry
+// runs. It returns the number of valid records read before the first invalid
+// one.
+func ValidateUpdates(r io.Reader) (int64, error) {
+	return readUpdates(r, DefaultUpdateBatchSize, func(*updateBatch) error { return nil })
+}
+
+// readUpdates reads the JSONL of `UpdateCompaniesFromReader` calling save for
+// each batch of up to size records (or `DefaultUpdateBatchSize` if size is not
+// positive). It returns the number of records in the batches saved.
+func readUpdates(r io.Reader, size int, save func(*updateBatch) error) (int64, error) {
+	if size <= 0 {
+		size = DefaultUpdateBatchSize
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var t int64
+	var b updateBatch
+	for l := 1; s.Scan(); l++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var u updateRecord
+		if err := json.Unmarshal(s.Bytes(), &u); err != nil {
+			return t, fmt.Errorf("error decoding line %d: %w", l, err)
+		}
+		first, last, err := rangeFor(u.BaseCNPJ)
+		if err != nil {
+			return t, fmt.Errorf("error in line %d: %w", l, err)
+		}
+		var o map[string]json.RawMessage
+		if err := json.Unmarshal(u.Data, &o); err != nil {
+			return t, fmt.Errorf("error in line %d, data should be an object: %w", l, err)
+		}
+		b.firsts = append(b.firsts, first)
+		b.lasts = append(b.lasts, last)
+		b.data = append(b.data, string(u.Data))
+		if b.len() == size {
+			if err := save(&b); err != nil {
+				return t, err
+			}
+			t += int64(b.len())
+			b = updateBatch{}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return t, fmt.Errorf("error reading lines: %w", err)
+	}
+	if b.len() > 0 {
+		if err := save(&b); err != nil {
+			return t, err
+		}
+		t += int64(b.len())
+	}
+	return t, nil
+}
+
+// rangeForKey returns the range of IDs updated by a key of
+// `BulkUpdateFromJSONL`: all the venues of a company for a base CNPJ (first 8
+// digits), or a single venue for a complete CNPJ (14 digits).
+func rangeForKey(k string) (int64, int64, error) {
+	if len(k) != 14 {
+		return rangeFor(k)
+	}
+	n, err := strconv.ParseInt(k, 10, 64)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("cnpj %q should have only digits", k)
+	}
+	return n, n, nil
+}
+
+// bulkUpdateRecord parses a line of `BulkUpdateFromJSONL`, returning the range
+// of IDs to update and the remaining fields as the data to be merged.
+func bulkUpdateRecord(l []byte, idField string) (int64, int64, string, error) {
+	var o map[string]json.RawMessage
+	if err := json.Unmarshal(l, &o); err != nil {
+		return 0, 0, "", fmt.Errorf("line should be an object: %w", err)
+	}
+	v, ok := o[idField]
+	if !ok {
+		return 0, 0, "", fmt.Errorf("missing %s", idField)
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return 0, 0, "", fmt.Errorf("%s should be a string (numbers lose leading zeros), got %s", idField, v)
+	}
+	first, last, err := rangeForKey(s)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	delete(o, idField)
+	d, err := json.Marshal(o)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error encoding data: %w", err)
+	}
+	return first, last, string(d), nil
+}
+
+// BulkUpdateFromJSONL updates companies from a JSONL file in which each line
+// is an object with the key in idField and the data to be merged, e.g. with
+// idField as cnpj_basico:
+//
+//	{"cnpj_basico": "19131243", "razao_social": "OPEN KNOWLEDGE BRASIL"}
+//
+// Keys with 8 digits update all the venues of a company, and keys with 14
+// digits update a single venue. Lines are sent to the database in batches
+// (see `UpdateOptions`). Unlike `UpdateCompaniesFromReader`, invalid lines
+// and failed batches do not stop the update: their errors are accumulated and
+// returned together with the number of records processed.
+func (p *PostgreSQL) BulkUpdateFromJSONL(ctx context.Context, path string, idField string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+	size := p.UpdateOptions.BatchSize
+	if size <= 0 {
+		size = DefaultUpdateBatchSize
+	}
+	var t int64
+	var errs []error
+	var b updateBatch
+	flush := func() {
+		if err := p.updateCompanies(ctx, &b); err != nil {
+			errs = append(errs, fmt.Errorf("error in batch ending at line %d: %w", b.line, err))
+		} else {
+			t += int64(b.len())
+		}
+		b = updateBatch{}
+	}
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for l := 1; s.Scan(); l++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		first, last, d, err := bulkUpdateRecord(s.Bytes(), idField)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error in line %d: %w", l, err))
+			continue
+		}
+		b.firsts = append(b.firsts, first)
+		b.lasts = append(b.lasts, last)
+		b.data = append(b.data, d)
+		b.line = l
+		if b.len() == size {
+			flush()
+		}
+	}
+	if err := s.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("error reading %s: %w", path, err))
+	}
+	if b.len() > 0 {
+		flush()
+	}
+	return t, errors.Join(errs...)
+}
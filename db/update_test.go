@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateCompaniesFromReaderInvalidData(t *testing.T) {
+	p := PostgreSQL{}
+	for _, c := range []string{
+		"forty-two",
+		`{"cnpj_basico": "42", "data": {}}`,
+		`{"cnpj_basico": "19131243", "data": [42]}`,
+		`{"cnpj_basico": "19131243"}`,
+	} {
+		n, err := p.UpdateCompaniesFromReader(context.Background(), strings.NewReader(c))
+		if err == nil {
+			t.Errorf("expected an error for %s, got nil", c)
+		}
+		if n != 0 {
+			t.Errorf("expected no records processed for %s, got %d", c, n)
+		}
+	}
+}
+
+func TestBulkUpdateRecord(t *testing.T) {
+	for _, c := range []struct {
+		line         string
+		first, last  int64
+		data         string
+		expectsError bool
+	}{
+		{`{"cnpj_basico": "19131243", "answer": 42}`, 19131243000000, 19131243999999, `{"answer":42}`, false},
+		{`{"cnpj_basico": "19131243000197", "answer": 42}`, 19131243000197, 19131243000197, `{"answer":42}`, false},
+		{`{"cnpj_basico": 19131243, "answer": 42}`, 0, 0, "", true},
+		{`{"cnpj_basico": "42", "answer": 42}`, 0, 0, "", true},
+		{`{"cnpj_basico": "1913124300019a"}`, 0, 0, "", true},
+		{`{"cnpj": "19131243"}`, 0, 0, "", true},
+		{`[42]`, 0, 0, "", true},
+	} {
+		first, last, data, err := bulkUpdateRecord([]byte(c.line), "cnpj_basico")
+		if c.expectsError {
+			if err == nil {
+				t.Errorf("expected an error for %s, got nil", c.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error for %s, got %s", c.line, err)
+		}
+		if first != c.first || last != c.last || data != c.data {
+			t.Errorf("expected %d, %d and %s for %s, got %d, %d and %s", c.first, c.last, c.data, c.line, first, last, data)
+		}
+	}
+}
+
+func TestBulkUpdateFromJSONLInvalidData(t *testing.T) {
+	p := PostgreSQL{}
+	pth := filepath.Join(t.TempDir(), "updates.jsonl")
+	if err := os.WriteFile(pth, []byte("forty-two\n\n{\"cnpj_basico\": \"42\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := p.BulkUpdateFromJSONL(context.Background(), pth, "cnpj_basico")
+	if err == nil || !strings.Contains(err.Error(), "line 1") || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected errors for lines 1 and 3, got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected no records processed, got %d", n)
+	}
+	if _, err := p.BulkUpdateFromJSONL(context.Background(), filepath.Join(t.TempDir(), "missing.jsonl"), "cnpj_basico"); err == nil {
+		t.Error("expected an error for a missing file, got nil")
+	}
+}
+
+func TestValidateUpdates(t *testing.T) {
+	n, err := ValidateUpdates(strings.NewReader(`{"cnpj_basico": "19131243", "data": {"answer": 42}}
+
+{"cnpj_basico": "33683111", "data": {}}
+`))
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 valid records, got %d and %v", n, err)
+	}
+	if _, err := ValidateUpdates(strings.NewReader(`{"cnpj_basico": "42", "data": {}}`)); err == nil {
+		t.Error("expected an error for an invalid base cnpj, got nil")
+	}
+}
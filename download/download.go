@@ -62,7 +62,7 @@ func Download(dir string, timeout time.Duration, skip, restart bool, parallel, r
 		return fmt.Errorf("error downloading files from the national treasure: %w", err)
 	}
 	log.Output(1, "Downloading files from the Federal Revenue…")
-	urls, err := getURLs(federalRevenueURL, federalRevenueGetURLs, dir, skip)
+	urls, err := getURLs(FederalRevenueURL, federalRevenueGetURLs, dir, skip)
 	if err != nil {
 		return fmt.Errorf("error gathering resources for download: %w", err)
 	}
@@ -77,7 +77,7 @@ func Download(dir string, timeout time.Duration, skip, restart bool, parallel, r
 
 // URLs shows the URLs to be downloaded.
 func URLs(dir string, skip bool) error {
-	urls := []string{federalRevenueURL, nationalTreasureBaseURL}
+	urls := []string{FederalRevenueURL, nationalTreasureBaseURL}
 	handlers := []getURLsHandler{federalRevenueGetURLsNoUpdatedAt, nationalTreasureGetURLs}
 	var out []string
 	for idx := range urls {
@@ -94,7 +94,7 @@ func URLs(dir string, skip bool) error {
 
 // UpdatedAt shows the updated at of the files to be downloaded.
 func UpdatedAt() error {
-	u, err := fetchUpdatedAt(federalRevenueURL)
+	u, err := fetchUpdatedAt(FederalRevenueURL)
 	if err != nil {
 		return fmt.Errorf("error getting updated at: %w", err)
 	}
@@ -104,7 +104,7 @@ func UpdatedAt() error {
 
 // HasUpdate checks if there is an update available.
 func HasUpdate(dir string) error {
-	h, err := hasUpdate(federalRevenueURL, dir)
+	h, err := hasUpdate(FederalRevenueURL, dir)
 	if err != nil {
 		return fmt.Errorf("error getting updated at: %w", err)
 	}
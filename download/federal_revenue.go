@@ -17,7 +17,10 @@ const (
 	// extracted by the Federal Revenue
 	FederalRevenueUpdatedAt = "updated_at.txt"
 
-	federalRevenueURL        = "https://dados.gov.br/api/publico/conjuntos-dados/cadastro-nacional-da-pessoa-jurdica---cnpj"
+	// FederalRevenueURL is the dataset page for the CNPJ data in the open data
+	// portal of the Brazilian government
+	FederalRevenueURL = "https://dados.gov.br/api/publico/conjuntos-dados/cadastro-nacional-da-pessoa-jurdica---cnpj"
+
 	federalRevenueFormat     = "zip+csv"
 	federalRevenueDateFormat = "02/01/2006 15:04:05"
 )
@@ -1,12 +1,13 @@
 module github.com/cuducos/minha-receita
 
-go 1.19
+go 1.21
 
 require (
 	github.com/cuducos/chunk v1.0.0
 	github.com/cuducos/go-cnpj v0.1.1
 	github.com/dgraph-io/badger/v3 v3.2103.5
 	github.com/jackc/pgx/v5 v5.3.1
+	github.com/klauspost/compress v1.12.3
 	github.com/newrelic/go-agent/v3 v3.20.3
 	github.com/schollz/progressbar/v3 v3.13.0
 	github.com/spf13/cobra v1.6.1
@@ -29,7 +30,6 @@ require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
 	github.com/jackc/puddle/v2 v2.2.0 // indirect
-	github.com/klauspost/compress v1.12.3 // indirect
 	github.com/mattn/go-runewidth v0.0.14 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -46,4 +46,4 @@ require (
 	google.golang.org/protobuf v1.27.1 // indirect
 )
 
-// +heroku goVersion go1.19
+// +heroku goVersion go1.21
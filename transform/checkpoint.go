@@ -0,0 +1,66 @@
+package transform
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// checkpoint keeps track of the source files fully saved to the database, so
+// an interrupted import can be resumed skipping them. A file is complete once
+// it was read until the end and all its rows were saved.
+type checkpoint struct {
+	mu    sync.Mutex
+	files []string
+	read  []int
+	saved []int
+	eof   []bool
+	done  []string
+}
+
+func (c *checkpoint) readRow(f int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.read[f]++
+}
+
+func (c *checkpoint) finished(f int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eof[f] = true
+}
+
+func (c *checkpoint) savedRows(fs []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range fs {
+		c.saved[f]++
+	}
+}
+
+// completed lists the files fully saved to the database, including the ones
+// skipped when resuming the import.
+func (c *checkpoint) completed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ls := append([]string{}, c.done...)
+	for i, f := range c.files {
+		if c.eof[i] && c.read[i] == c.saved[i] {
+			ls = append(ls, f)
+		}
+	}
+	return ls
+}
+
+func newCheckpoint(paths []string, done []string) *checkpoint {
+	c := checkpoint{
+		files: make([]string, len(paths)),
+		read:  make([]int, len(paths)),
+		saved: make([]int, len(paths)),
+		eof:   make([]bool, len(paths)),
+		done:  done,
+	}
+	for i, p := range paths {
+		c.files[i] = filepath.Base(p)
+	}
+	return &c
+}
@@ -0,0 +1,23 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	c := newCheckpoint([]string{"data/Estabelecimentos1.zip", "data/Estabelecimentos2.zip"}, []string{"Estabelecimentos0.zip"})
+	c.readRow(0)
+	c.readRow(0)
+	c.readRow(1)
+	c.savedRows([]int{0, 1})
+	c.finished(0)
+	c.finished(1)
+	if got := c.completed(); !reflect.DeepEqual(got, []string{"Estabelecimentos0.zip", "Estabelecimentos2.zip"}) {
+		t.Errorf("expected only the files fully saved to be completed, got %q", got)
+	}
+	c.savedRows([]int{0})
+	if got := c.completed(); !reflect.DeepEqual(got, []string{"Estabelecimentos0.zip", "Estabelecimentos1.zip", "Estabelecimentos2.zip"}) {
+		t.Errorf("expected all files to be completed, got %q", got)
+	}
+}
@@ -131,6 +131,35 @@ func (s *source) countLines() error {
 	}
 }
 
+// skip removes from the source the files listed (by name, not path) in `ls`,
+// and re-counts the lines of the remaining files.
+func (s *source) skip(ls []string) error {
+	m := make(map[string]struct{}, len(ls))
+	for _, f := range ls {
+		m[f] = struct{}{}
+	}
+	var fs []string
+	for _, f := range s.files {
+		if _, ok := m[filepath.Base(f)]; ok {
+			log.Output(1, fmt.Sprintf("Skipping %s, already imported", f))
+			continue
+		}
+		fs = append(fs, f)
+	}
+	if err := s.close(); err != nil {
+		return fmt.Errorf("error closing readers: %w", err)
+	}
+	s.files = fs
+	s.totalLines = 0
+	if err := s.createReaders(); err != nil {
+		return fmt.Errorf("error re-creating readers: %w", err)
+	}
+	if len(s.readers) == 0 {
+		return nil
+	}
+	return s.countLines()
+}
+
 func newSource(t sourceType, d string) (*source, error) {
 	log.Output(1, fmt.Sprintf("Loading %s files…", string(t)))
 	ls, err := pathsForSource(t, d)
@@ -1,10 +1,15 @@
 package transform
 
 import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/cuducos/minha-receita/download"
 )
@@ -18,9 +23,14 @@ const MaxParallelDBQueries = 8
 const BatchSize = 8192
 
 type database interface {
-	CreateCompanies([][]any) error
+	CreateCompaniesWithCheckpoint([][]any, []string) error
+	Checkpoint(context.Context) ([]string, error)
+	ClearCheckpoint(context.Context) error
 	CreateIndex() error
 	MetaSave(string, string) error
+	RecordImportSource(context.Context, time.Time, string, string) error
+	SetImportStatus(string) error
+	SaveImportReport(string, error) error
 }
 
 type kvStorage interface {
@@ -37,18 +47,79 @@ func saveUpdatedAt(db database, dir string) error {
 		return fmt.Errorf("error reading %s: %w", p, err)
 
 	}
-	return db.MetaSave("updated-at", string(v))
+	if err := db.MetaSave("updated-at", string(v)); err != nil {
+		return err
+	}
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(string(v)))
+	if err != nil {
+		return fmt.Errorf("error parsing updated at date %s: %w", string(v), err)
+	}
+	c, err := sourceChecksum(dir)
+	if err != nil {
+		return fmt.Errorf("error calculating the checksum of the source files: %w", err)
+	}
+	return db.RecordImportSource(context.Background(), t, download.FederalRevenueURL, c)
+}
+
+// sourceChecksum combines the MD5 checksum files created by the `check`
+// command (if any) into a single checksum representing the source files.
+func sourceChecksum(dir string) (string, error) {
+	ls, err := filepath.Glob(filepath.Join(dir, "*.md5"))
+	if err != nil {
+		return "", fmt.Errorf("error listing checksum files in %s: %w", dir, err)
+	}
+	if len(ls) == 0 {
+		return "", nil
+	}
+	h := md5.New()
+	for _, f := range ls { // filepath.Glob returns the files sorted by name
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", f, err)
+		}
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// reportStep saves the import report of a step, logging (but not returning)
+// errors saving it.
+func reportStep(db database, step string, err error) error {
+	if e := db.SaveImportReport(step, err); e != nil {
+		log.Output(1, fmt.Sprintf("Warning: could not save the import report: %s", e))
+	}
+	return err
 }
 
 // Transform the downloaded files for company venues creating a database record
-// per CNPJ
-func Transform(dir string, db database, maxParallelDBQueries, batchSize int, privacy, mem bool) error {
+// per CNPJ. With `resume`, the venues files saved to the database by a previous
+// import that was interrupted are skipped.
+func Transform(dir string, db database, maxParallelDBQueries, batchSize int, privacy, mem, resume bool) (err error) {
+	if err := db.SetImportStatus("running"); err != nil {
+		return fmt.Errorf("error saving the import status: %w", err)
+	}
+	defer func() {
+		s := "done"
+		if err != nil {
+			s = "failed"
+		}
+		if e := db.SetImportStatus(s); e != nil && err == nil {
+			err = fmt.Errorf("error saving the import status: %w", e)
+		}
+	}()
+	done := []string{}
+	if resume {
+		if done, err = db.Checkpoint(context.Background()); err != nil {
+			return fmt.Errorf("error reading the checkpoint: %w", err)
+		}
+		log.Output(1, fmt.Sprintf("Resuming the import, %d venues files already imported", len(done)))
+	}
 	if err := saveUpdatedAt(db, dir); err != nil {
 		return fmt.Errorf("error saving the update at date: %w", err)
 	}
 	l, err := newLookups(dir)
 	if err != nil {
-		return fmt.Errorf("error creating look up tables from %s: %w", dir, err)
+		return reportStep(db, "lookups", fmt.Errorf("error creating look up tables from %s: %w", dir, err))
 	}
 	kv, err := newBadgerStorage(mem)
 	if err != nil {
@@ -56,18 +127,21 @@ func Transform(dir string, db database, maxParallelDBQueries, batchSize int, pri
 	}
 	defer kv.close()
 	if err := kv.load(dir, &l); err != nil {
-		return fmt.Errorf("error loading data to badger: %w", err)
+		return reportStep(db, "load", fmt.Errorf("error loading data to badger: %w", err))
 	}
-	j, err := createJSONRecordsTask(dir, db, &l, kv, batchSize, privacy)
+	j, err := createJSONRecordsTask(dir, db, &l, kv, batchSize, privacy, done)
 	if err != nil {
-		return fmt.Errorf("error creating new task for venues in %s: %w", dir, err)
+		return reportStep(db, "companies", fmt.Errorf("error creating new task for venues in %s: %w", dir, err))
 	}
 	err = func() error {
 		defer j.bar.Close()
 		return j.run(maxParallelDBQueries)
 	}()
 	if err != nil {
-		return err
+		return reportStep(db, "companies", err)
+	}
+	if err := db.ClearCheckpoint(context.Background()); err != nil {
+		return fmt.Errorf("error clearing the checkpoint: %w", err)
 	}
-	return nil
+	return reportStep(db, "companies", nil)
 }
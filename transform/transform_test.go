@@ -33,11 +33,11 @@ func newTestDB(t *testing.T) *db.PostgreSQL {
 		t.Errorf("expected no error creating a test database, got %s", err)
 		return nil
 	}
-	if err := r.DropTable(); err != nil {
+	if err := r.DropTable(r.CompanyTableName); err != nil {
 		t.Errorf("expected no error droping the table in the test database, got %s", err)
 		return nil
 	}
-	if err := r.CreateTable(); err != nil {
+	if _, err := r.CreateTable(); err != nil {
 		t.Errorf("expected no error creating the table in the test database, got %s", err)
 		return nil
 	}
@@ -11,28 +11,46 @@ import (
 	"github.com/schollz/progressbar/v3"
 )
 
-func saveBatch(db database, b []company) (int, error) {
-	if len(b) == 0 {
-		return 0, nil
-	}
+func batchRows(b []company) ([][]any, error) {
 	s := make([][]any, len(b))
 	for i, c := range b {
 		j, err := c.JSON()
 		if err != nil {
-			return 0, fmt.Errorf("error getting company %s as json: %w", cnpj.Mask(c.CNPJ), err)
+			return nil, fmt.Errorf("error getting company %s as json: %w", cnpj.Mask(c.CNPJ), err)
 		}
 		n, err := strconv.Atoi(c.CNPJ)
 		if err != nil {
-			return 0, fmt.Errorf("copuld not convert cnpj %s to int: %w", c.CNPJ, err)
+			return nil, fmt.Errorf("copuld not convert cnpj %s to int: %w", c.CNPJ, err)
 		}
 		s[i] = []any{n, j}
 	}
-	if err := db.CreateCompanies(s); err != nil {
+	return s, nil
+}
+
+// saveBatchWithCheckpoint saves a batch along with the files completed so far
+// (so an interrupted import can be resumed), and then registers the rows of the batch (`fs` has the index of the source
+// file of each company) as saved.
+func saveBatchWithCheckpoint(db database, c *checkpoint, b []company, fs []int) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	s, err := batchRows(b)
+	if err != nil {
+		return 0, err
+	}
+	if err := db.CreateCompaniesWithCheckpoint(s, c.completed()); err != nil {
 		return 0, fmt.Errorf("error saving companies: %w", err)
 	}
+	c.savedRows(fs)
 	return len(s), nil
 }
 
+// sourceRow is a line from a CSV and the index of the file it comes from.
+type sourceRow struct {
+	file int
+	line []string
+}
+
 type venuesTask struct {
 	source            *source
 	lookups           *lookups
@@ -42,19 +60,20 @@ type venuesTask struct {
 	db                database
 	batchSize         int
 	sentToBatches     int
-	rows              chan []string
+	rows              chan sourceRow
 	companies         chan struct{}
 	saved             chan int
 	errors            chan error
 	bar               *progressbar.ProgressBar
+	checkpoint        *checkpoint
 	shutdown          int32
 	shutdownWaitGroup sync.WaitGroup
 }
 
 func (t *venuesTask) produceRows() {
-	for _, r := range t.source.readers {
+	for i, r := range t.source.readers {
 		t.shutdownWaitGroup.Add(1)
-		go func(t *venuesTask, a *archivedCSV) {
+		go func(t *venuesTask, i int, a *archivedCSV) {
 			defer t.shutdownWaitGroup.Done()
 			for {
 				if atomic.LoadInt32(&t.shutdown) == 1 { // check if must continue.
@@ -62,6 +81,7 @@ func (t *venuesTask) produceRows() {
 				}
 				r, err := a.read()
 				if err == io.EOF {
+					t.checkpoint.finished(i)
 					break
 				}
 				if err != nil { // initiate graceful shutdown.
@@ -69,29 +89,32 @@ func (t *venuesTask) produceRows() {
 					atomic.StoreInt32(&t.shutdown, 1)
 					return
 				}
-				t.rows <- r
+				t.checkpoint.readRow(i)
+				t.rows <- sourceRow{i, r}
 			}
-		}(t, r)
+		}(t, i, r)
 	}
 }
 
 func (t *venuesTask) consumeRows() {
 	defer t.shutdownWaitGroup.Done()
 	var b []company
+	var fs []int
 	for r := range t.rows {
 		if atomic.LoadInt32(&t.shutdown) == 1 { // check if must continue.
 			return
 		}
-		c, err := newCompany(r, t.lookups, t.kv, t.privacy)
+		c, err := newCompany(r.line, t.lookups, t.kv, t.privacy)
 		if err != nil { // initiate graceful shutdown.
-			t.errors <- fmt.Errorf("error parsing company from %q: %w", r, err)
+			t.errors <- fmt.Errorf("error parsing company from %q: %w", r.line, err)
 			atomic.StoreInt32(&t.shutdown, 1)
 			return
 		}
 		b = append(b, c)
+		fs = append(fs, r.file)
 		t.companies <- struct{}{}
 		if len(b) >= t.batchSize {
-			n, err := saveBatch(t.db, b)
+			n, err := saveBatchWithCheckpoint(t.db, t.checkpoint, b, fs)
 			if err != nil { // initiate graceful shutdown.
 				t.errors <- fmt.Errorf("error saving companies: %w", err)
 				atomic.StoreInt32(&t.shutdown, 1)
@@ -99,13 +122,14 @@ func (t *venuesTask) consumeRows() {
 			}
 			t.saved <- n
 			b = []company{}
+			fs = []int{}
 		}
 	}
 	if len(b) == 0 || atomic.LoadInt32(&t.shutdown) == 1 { // check if must continue.
 		return
 	}
 	// send the remaining items in the batch
-	n, err := saveBatch(t.db, b)
+	n, err := saveBatchWithCheckpoint(t.db, t.checkpoint, b, fs)
 	if err != nil { // initiate graceful shutdown.
 		t.errors <- fmt.Errorf("error saving companies: %w", err)
 		atomic.StoreInt32(&t.shutdown, 1)
@@ -119,6 +143,9 @@ func (t *venuesTask) run(m int) error {
 	if err := t.bar.RenderBlank(); err != nil {
 		return fmt.Errorf("error rendering the progress bar: %w", err)
 	}
+	if t.source.totalLines == 0 { // e.g. all files were imported before resuming
+		return t.db.CreateIndex()
+	}
 	t.produceRows()
 	for i := 0; i < m; i++ {
 		t.shutdownWaitGroup.Add(1)
@@ -150,11 +177,16 @@ func (t *venuesTask) run(m int) error {
 	}
 }
 
-func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b int, p bool) (*venuesTask, error) {
+func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b int, p bool, done []string) (*venuesTask, error) {
 	v, err := newSource(venues, dir)
 	if err != nil {
 		return nil, fmt.Errorf("error creating a source for venues from %s: %w", dir, err)
 	}
+	if len(done) > 0 {
+		if err := v.skip(done); err != nil {
+			return nil, fmt.Errorf("error skipping venues files already imported: %w", err)
+		}
+	}
 	t := venuesTask{
 		source:        v,
 		lookups:       l,
@@ -164,11 +196,12 @@ func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b
 		db:            db,
 		batchSize:     b,
 		sentToBatches: 0,
-		rows:          make(chan []string),
+		rows:          make(chan sourceRow),
 		companies:     make(chan struct{}),
 		saved:         make(chan int),
 		errors:        make(chan error),
 		bar:           progressbar.Default(int64(v.totalLines)),
+		checkpoint:    newCheckpoint(v.files, done),
 	}
 	t.bar.Describe("Creating the JSON data for each CNPJ")
 	return &t, nil
@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"context"
 	"testing"
 )
 
@@ -18,7 +19,7 @@ func TestTaskRun(t *testing.T) {
 	if err := kv.load(testdata, &lookups); err != nil {
 		t.Errorf("expected no error loading values to badger, got %s", err)
 	}
-	r, err := createJSONRecordsTask(testdata, db, &lookups, kv, 2, false)
+	r, err := createJSONRecordsTask(testdata, db, &lookups, kv, 2, false, []string{})
 	if err != nil {
 		t.Errorf("expected no error creating task, got %s", err)
 	}
@@ -26,7 +27,7 @@ func TestTaskRun(t *testing.T) {
 		t.Errorf("expected no error running task, got %s", err)
 	}
 	expected := "33683111000280"
-	s, err := db.GetCompany(expected)
+	s, err := db.GetCompany(context.Background(), expected)
 	if err != nil {
 		t.Errorf("expected no error getting the created company, got %s", err)
 	}